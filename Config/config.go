@@ -5,8 +5,110 @@ import (
 )
 
 const API = "https://api.mangadex.org"
+const ANILIST_URL = "https://graphql.anilist.co"
+const MYANIMELIST_API = "https://api.myanimelist.net/v2"
+const MYANIMELIST_AUTH_URL = "https://myanimelist.net/v1/oauth2/token"
+const MANGADEX_AUTH_URL = "https://auth.mangadex.org/realms/mangadex/protocol/openid-connect/token"
 const EMPTY_VOLUME_NAME = "Extras"
 const GIN_URL = "localhost"
 const GIN_PORT = "8080"
 const DB_PATH = "test.db"
 const DEFAULT_API_KEY_EXPIRATION = 30 * time.Hour * 24
+const LIBRARY_PATH = "library"
+const COVER_URL = "https://uploads.mangadex.org/covers"
+const COVER_CACHE_MAX_AGE = 7 * time.Hour * 24
+
+// Widths of the generated cover thumbnails, by size name
+var THUMBNAIL_SIZES = map[string]int{
+	"small":  128,
+	"medium": 256,
+	"large":  512,
+}
+const DEFAULT_PAGE_SIZE = 50
+const MAX_PAGE_SIZE = 100
+const PREFETCH_PAGES = 2
+const PAGE_CACHE_MAX_AGE = time.Hour
+
+// Refuse to start if sqlite was built without FTS5 (go build -tags sqlite_fts5)
+// When false the library search falls back to matching substrings with LIKE
+const REQUIRE_FULL_TEXT_SEARCH = false
+
+// Folder of existing manga to import, one folder per series
+const IMPORT_PATH = "import"
+
+// Uploads waiting for a job to process them, like backups to import
+const UPLOAD_PATH = "uploads"
+// Largest backup accepted by the import endpoint, bigger uploads are refused
+const MAX_BACKUP_UPLOAD_SIZE = 32 << 20
+
+// Folder of YAML/JSON site definitions, each one is added as a provider
+const SITES_PATH = "sites"
+
+// Folder mirroring the library for Komga or Kavita, empty disables the export
+const EXPORT_PATH = ""
+// Export one CBZ per volume instead of one per chapter
+const EXPORT_PER_VOLUME = false
+
+// Jobs talking to outside services are retried this many times, waiting twice as long each time
+const JOB_MAX_ATTEMPTS = 5
+const JOB_RETRY_DELAY = time.Minute
+
+// Address the API is reached at, used in links sent by email
+const PUBLIC_URL = "http://localhost:8080"
+
+// Emails are sent through this SMTP server, or written to MAIL_PATH if the host is empty
+const MAIL_SMTP_HOST = ""
+const MAIL_SMTP_PORT = "587"
+const MAIL_SMTP_USERNAME = ""
+// Environment variable holding the SMTP password, so it stays out of the source
+const MAIL_SMTP_PASSWORD_ENV = "MANGASCRIBE_SMTP_PASSWORD"
+const MAIL_FROM = "mangascribe@localhost"
+const MAIL_PATH = "mail"
+
+// How long the tokens sent by email can be used
+const EMAIL_VERIFICATION_EXPIRATION = 24 * time.Hour
+const PASSWORD_RESET_EXPIRATION = time.Hour
+
+// Two-factor authentication, the issuer is the name authenticator apps show
+const TOTP_ISSUER = "mangascribe"
+const RECOVERY_CODE_COUNT = 10
+
+// Failed logins within the window lock out the account (and the IP) for a while
+// Past the free attempts, each failure doubles the lockout up to the maximum
+const LOGIN_ATTEMPT_WINDOW = time.Hour
+const LOGIN_FREE_ATTEMPTS = 5
+const LOGIN_FREE_ATTEMPTS_PER_IP = 20
+const LOGIN_BASE_LOCKOUT = 30 * time.Second
+const LOGIN_MAX_LOCKOUT = 15 * time.Minute
+
+// Reverse proxies trusted to pass on the address of the client in X-Forwarded-For, as IPs or CIDR ranges like "10.0.0.0/8"
+// The login lockout and login history use that address, so only list proxies that overwrite the header
+// nil trusts no proxy and uses the address of the connection
+var TRUSTED_PROXIES []string = nil
+
+// Whether anyone can register until an admin changes it, the first account can always register and becomes an admin
+const OPEN_REGISTRATION = true
+
+// Single sign-on through an OpenID Connect identity provider, an empty issuer turns it off
+// The redirect URL to register at the provider is PUBLIC_URL + "/v1/oidc/callback"
+const OIDC_ISSUER = ""
+const OIDC_CLIENT_ID = ""
+// Environment variable holding the client secret, left unset for public clients
+const OIDC_CLIENT_SECRET_ENV = "MANGASCRIBE_OIDC_CLIENT_SECRET"
+var OIDC_SCOPES = []string{"openid", "profile", "email"}
+// How long a user has to log in at the provider
+const OIDC_LOGIN_EXPIRATION = 10 * time.Minute
+// Accounts are created the first time someone logs in while registration is open, otherwise only existing accounts can use single sign-on
+const OIDC_AUTO_PROVISION = true
+// Link an existing account to the first single sign-on login with the same email, if the provider verified it
+// Off by default, since it trusts the provider with every account whose email it can vouch for
+const OIDC_LINK_BY_EMAIL = false
+// Accounts created through single sign-on have no password, without two-factor authentication they
+// confirm changes like deleting the account with an API key from a login made within this long
+const OIDC_REAUTH_WINDOW = 5 * time.Minute
+
+// Roles given by the groups in the ID token, the most powerful match wins
+// When groups are mapped, the role of an account is updated on every login
+const OIDC_GROUPS_CLAIM = "groups"
+var OIDC_GROUP_ROLES = map[string]string{}
+const OIDC_DEFAULT_ROLE = "user"
@@ -0,0 +1,50 @@
+package DB
+
+import (
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/golang/glog"
+	"gorm.io/gorm"
+)
+
+// Puts a manga in categories of an account, creating the categories that do not exist yet
+// A manga already in a category is left as is
+func (dbm *DBManager) AddMangaToCategories(accountID uint, mangaID uint, names []string) error {
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		for _, name := range names {
+			category := Models.Category{AccountID: accountID, Name: name}
+			if err := tx.Where(category).FirstOrCreate(&category).Error; err != nil {
+				return err
+			}
+
+			entry := Models.CategoryManga{CategoryID: category.ID, MangaID: mangaID}
+			if err := tx.Where(entry).FirstOrCreate(&entry).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		err = fmt.Errorf("Error adding manga to categories: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Get the categories of an account with their manga, ordered by name
+func (dbm *DBManager) GetCategories(accountID uint) ([]Models.Category, error) {
+	var categories []Models.Category
+	err := dbm.DB.Preload("Manga", func(db *gorm.DB) *gorm.DB { return db.Order("manga_id") }).
+		Where("account_id = ?", accountID).Order("name").Find(&categories).Error
+	if err != nil {
+		err = fmt.Errorf("Error getting categories: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	return categories, nil
+}
@@ -6,10 +6,14 @@ import (
 	"github.com/golang/glog"
 	"github.com/CookieUzen/mangascribe/Config"
 	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/Tools"
+	"fmt"
+	"strings"
 )
 
 type DBManager struct {
 	DB *gorm.DB
+	SearchIndex bool // Whether the FTS5 search table is available
 }
 
 func Open() DBManager {
@@ -28,18 +32,203 @@ func Open() DBManager {
 // Migrate the database
 // Panic if there is an error migrating the database
 func (dbm *DBManager) Migrate() {
+	// Volumes used to have a composite primary key that never got an id assigned,
+	// the old table is set aside and copied into the new one after migrating
+	if dbm.DB.Migrator().HasColumn("volumes", "volume_id") {
+		glog.Info("Rebuilding the volumes table")
+		if err := dbm.DB.Migrator().RenameTable("volumes", "volumes_old"); err != nil {
+			glog.Fatalf("Failed to set aside the volumes table: %v", err)
+		}
+	}
+
 	err := dbm.DB.AutoMigrate(
 		&Models.Manga{},
 		&Models.Volume{},
 		&Models.Chapter{},
 		&Models.Page{},
+		&Models.Cover{},
+		&Models.Tag{},
+		&Models.AltTitle{},
+		&Models.Person{},
+		&Models.Link{},
+		&Models.Series{},
+		&Models.ChapterSource{},
+		&Models.ReadProgress{},
+		&Models.Follow{},
+		&Models.Category{},
+		&Models.CategoryManga{},
+		&Models.MangaDexLink{},
+		&Models.TrackerAccount{},
+		&Models.TrackerEntry{},
 		&Models.Account{},
 		Models.APIKey{},
+		&Models.AccountToken{},
+		&Models.RecoveryCode{},
+		&Models.LoginAttempt{},
+		&Models.Settings{},
+		&Models.OIDCLogin{},
+		&Models.Job{},
 	)
 
 	if err != nil {
 		glog.Fatalf("Failed to migrate the database: %v", err)
 	}
+
+	dbm.rebuildVolumes()
+
+	// MangaDex manga used to be stored under the placeholder provider name "API"
+	if err := dbm.DB.Model(&Models.Manga{}).Where("api_provider IN ?", []string{"API", ""}).
+		Update("api_provider", "mangadex").Error; err != nil {
+		glog.Fatalf("Failed to rename the MangaDex provider: %v", err)
+	}
+
+	dbm.assignFolders()
+
+	dbm.hashAPIKeys()
+
+	// API keys made before scopes existed had full access
+	if err := dbm.DB.Model(&Models.APIKey{}).Where("scopes IS NULL OR scopes = ''").
+		Update("scopes", strings.Join(Models.AllScopes, " ")).Error; err != nil {
+		glog.Fatalf("Failed to give API keys their scopes: %v", err)
+	}
+
+	dbm.assignRoles()
+
+	dbm.SearchIndex = dbm.createSearchIndex()
+}
+
+// rebuildVolumes Copies the volumes set aside by Migrate into the new table and relinks their chapters
+func (dbm *DBManager) rebuildVolumes() {
+	if !dbm.DB.Migrator().HasTable("volumes_old") {
+		return
+	}
+
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		// One volume per name of each manga, from the old rows and from the chapters naming them
+		if err := tx.Exec(`INSERT INTO volumes (created_at, updated_at, manga_id, name)
+			SELECT min(created_at), max(updated_at), manga_id, name FROM volumes_old
+			WHERE deleted_at IS NULL GROUP BY manga_id, name`).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec(`INSERT INTO volumes (created_at, updated_at, manga_id, name)
+			SELECT min(created_at), max(updated_at), manga_id, volume FROM chapters c
+			WHERE deleted_at IS NULL AND NOT EXISTS (
+				SELECT 1 FROM volumes v WHERE v.manga_id = c.manga_id AND v.name = c.volume
+			) GROUP BY manga_id, volume`).Error; err != nil {
+			return err
+		}
+
+		// The old volume ids are gone, chapters find theirs again by name
+		if err := tx.Exec(`UPDATE chapters SET volume_id = coalesce((
+			SELECT v.id FROM volumes v WHERE v.manga_id = chapters.manga_id AND v.name = chapters.volume
+		), 0)`).Error; err != nil {
+			return err
+		}
+
+		return tx.Migrator().DropTable("volumes_old")
+	})
+
+	if err != nil {
+		glog.Fatalf("Failed to rebuild the volumes table: %v", err)
+	}
+}
+
+// assignFolders Stores the folder of manga added before it was kept on the row
+// Older versions named the folder after the manga alone, so existing downloads keep that folder
+func (dbm *DBManager) assignFolders() {
+	var mangas []Models.Manga
+	if err := dbm.DB.Select("manga_id", "name").Where("folder IS NULL OR folder = ''").Find(&mangas).Error; err != nil {
+		glog.Fatalf("Failed to find manga without a folder: %v", err)
+	}
+
+	for _, manga := range mangas {
+		if err := dbm.DB.Model(&Models.Manga{}).Where("manga_id = ?", manga.MangaID).
+			Update("folder", Tools.SanitizeFilename(manga.Name)).Error; err != nil {
+			glog.Fatalf("Failed to store the folder of %s: %v", manga.Name, err)
+		}
+	}
+}
+
+// hashAPIKeys Replaces the plaintext API keys stored by older versions with their digest
+func (dbm *DBManager) hashAPIKeys() {
+	// HasColumn matches the column name anywhere in the table definition, "key" is in "PRIMARY KEY"
+	var count int64
+	if err := dbm.DB.Raw("SELECT count(*) FROM pragma_table_info('api_keys') WHERE name = 'key'").Scan(&count).Error; err != nil {
+		glog.Fatalf("Failed to check the API keys table: %v", err)
+	}
+	if count == 0 {
+		return
+	}
+
+	glog.Info("Hashing stored API keys")
+	var keys []struct {
+		ID  uint
+		Key string
+	}
+	if err := dbm.DB.Table("api_keys").Select("id", "key").Where("key IS NOT NULL AND key <> ''").Scan(&keys).Error; err != nil {
+		glog.Fatalf("Failed to read the stored API keys: %v", err)
+	}
+
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		for _, key := range keys {
+			prefix := key.Key
+			if len(prefix) > Models.APIKeyPrefixLength {
+				prefix = prefix[:Models.APIKeyPrefixLength]
+			}
+
+			err := tx.Table("api_keys").Where("id = ?", key.ID).Updates(map[string]any{
+				"digest": Models.HashAPIKey(key.Key),
+				"prefix": prefix,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Exec("ALTER TABLE api_keys DROP COLUMN key").Error
+	})
+	if err != nil {
+		glog.Fatalf("Failed to hash the stored API keys: %v", err)
+	}
+}
+
+// assignRoles Gives accounts made before roles existed the user role
+// A server upgraded without any admin gets its oldest account promoted
+func (dbm *DBManager) assignRoles() {
+	if err := dbm.DB.Model(&Models.Account{}).Where("role IS NULL OR role = ''").
+		Update("role", Models.RoleUser).Error; err != nil {
+		glog.Fatalf("Failed to give accounts their roles: %v", err)
+	}
+
+	// Checked and promoted in one transaction, so an account registering meanwhile can not become a second admin
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		var admins int64
+		if err := tx.Model(&Models.Account{}).Where("role = ?", Models.RoleAdmin).Count(&admins).Error; err != nil {
+			return fmt.Errorf("Failed to count admins: %v", err)
+		}
+		if admins > 0 {
+			return nil
+		}
+
+		var oldest Models.Account
+		if err := tx.Order("id").Limit(1).Find(&oldest).Error; err != nil {
+			return fmt.Errorf("Failed to find the oldest account: %v", err)
+		}
+		if oldest.ID == 0 {
+			return nil
+		}
+
+		glog.Info("Making ", oldest.Username, " the admin of the server")
+		if err := tx.Model(&oldest).Update("role", Models.RoleAdmin).Error; err != nil {
+			return fmt.Errorf("Failed to promote the oldest account: %v", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		glog.Fatal(err)
+	}
 }
 
 // Close the database connection
@@ -0,0 +1,114 @@
+package DB
+
+import (
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/golang/glog"
+	"gorm.io/gorm"
+)
+
+// Adds a new job to the database in the pending state
+func (dbm *DBManager) CreateJob(job *Models.Job) error {
+	job.Status = Models.JobPending
+
+	if err := dbm.DB.Create(job).Error; err != nil {
+		err = fmt.Errorf("Error creating job: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Get a job from the database by id
+func (dbm *DBManager) GetJob(job *Models.Job, id uint) error {
+	if err := dbm.DB.First(job, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			err = fmt.Errorf("Job not found")
+			glog.Info(err)
+			return err
+		}
+
+		err = fmt.Errorf("Error getting job: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Saves the status, report and error of a job
+func (dbm *DBManager) UpdateJob(job *Models.Job) error {
+	if err := dbm.DB.Save(job).Error; err != nil {
+		err = fmt.Errorf("Error updating job: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Check if a job of a type is already waiting to run for a manga
+func (dbm *DBManager) HasPendingJob(jobType Models.JobType, mangaID uint) (bool, error) {
+	var count int64
+	err := dbm.DB.Model(&Models.Job{}).
+		Where("type = ? AND manga_id = ? AND status = ?", jobType, mangaID, Models.JobPending).
+		Count(&count).Error
+
+	if err != nil {
+		err = fmt.Errorf("Error checking for pending jobs: %v", err)
+		glog.Error(err)
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// Check if a job of a type is already waiting to run for a manga of an account
+func (dbm *DBManager) HasPendingAccountJob(jobType Models.JobType, accountID uint, mangaID uint) (bool, error) {
+	var count int64
+	err := dbm.DB.Model(&Models.Job{}).
+		Where("type = ? AND account_id = ? AND manga_id = ? AND status = ?", jobType, accountID, mangaID, Models.JobPending).
+		Count(&count).Error
+
+	if err != nil {
+		err = fmt.Errorf("Error checking for pending jobs: %v", err)
+		glog.Error(err)
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// Get all jobs that have not finished yet, oldest first
+// Running jobs are included since they were interrupted by a restart
+func (dbm *DBManager) GetUnfinishedJobs() ([]Models.Job, error) {
+	var jobs []Models.Job
+	if err := dbm.DB.Where("status IN ?", []Models.JobStatus{Models.JobPending, Models.JobRunning}).Order("id").Find(&jobs).Error; err != nil {
+		err = fmt.Errorf("Error getting unfinished jobs: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// Count the jobs with each status
+func (dbm *DBManager) CountJobs() (map[Models.JobStatus]int64, error) {
+	var rows []struct {
+		Status Models.JobStatus
+		Count  int64
+	}
+	if err := dbm.DB.Model(&Models.Job{}).Select("status, count(*) AS count").Group("status").Scan(&rows).Error; err != nil {
+		err = fmt.Errorf("Error counting jobs: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	counts := map[Models.JobStatus]int64{}
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,550 @@
+package DB
+
+import (
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/golang/glog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// orderPages Preload condition sorting pages by page number
+func orderPages(db *gorm.DB) *gorm.DB {
+	return db.Order("page")
+}
+
+// Adds a manga, its chapters and its volumes to the library
+// Chapters sorted into volumes are linked to their volume, the rest are kept unlinked
+func (dbm *DBManager) AddManga(manga *Models.Manga) error {
+	manga.LastChapterAt = time.Now()
+
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(manga).Error; err != nil {
+			return err
+		}
+
+		// The folder needs the id, which is only known once the manga is created
+		manga.Folder = manga.DefaultFolder()
+		if err := tx.Model(manga).Omit(clause.Associations).Update("folder", manga.Folder).Error; err != nil {
+			return err
+		}
+
+		if err := saveMetadata(tx, manga); err != nil {
+			return err
+		}
+
+		if err := indexManga(tx, manga); err != nil {
+			return err
+		}
+
+		for i := range manga.Covers {
+			manga.Covers[i].MangaID = manga.MangaID
+			if err := tx.Omit(clause.Associations).Create(&manga.Covers[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		// Save every chapter, remembering the new ids by provider id
+		chapterIDs := make(map[string]uint)
+		for i := range manga.Chapters {
+			chapter := &manga.Chapters[i]
+			chapter.MangaID = manga.MangaID
+			chapter.State = Models.ChapterPending
+
+			if err := tx.Omit(clause.Associations).Create(chapter).Error; err != nil {
+				return err
+			}
+			chapterIDs[chapter.ID] = chapter.ChapterID
+		}
+
+		// Save the volumes and link their chapters
+		for i := range manga.Volumes {
+			volume := &manga.Volumes[i]
+			volume.MangaID = manga.MangaID
+
+			if err := tx.Omit(clause.Associations).Create(volume).Error; err != nil {
+				return err
+			}
+
+			for j := range volume.Chapters {
+				chapter := &volume.Chapters[j]
+				chapter.MangaID = manga.MangaID
+				chapter.ChapterID = chapterIDs[chapter.ID]
+				chapter.VolumeID = volume.ID
+				chapter.State = Models.ChapterPending
+
+				if err := tx.Model(chapter).Update("volume_id", volume.ID).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		err = fmt.Errorf("Error adding manga to the library: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Columns refreshed from the provider on every sync
+var metadataColumns = []string{
+	"name", "description", "status", "year", "demographic", "content_rating",
+	"original_language", "last_volume", "last_chapter",
+}
+
+// saveMetadata Replaces the tags, alternative titles, links, authors and artists of a manga
+func saveMetadata(tx *gorm.DB, manga *Models.Manga) error {
+	// Tags and people are shared, match them by provider id so every manga links to the same row
+	for i := range manga.Tags {
+		tag := &manga.Tags[i]
+		if err := tx.Where(Models.Tag{ProviderID: sharedKey(tag.ProviderID, tag.Name)}).
+			Assign(Models.Tag{Name: tag.Name, Group: tag.Group}).
+			FirstOrCreate(tag).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, people := range [][]Models.Person{manga.Authors, manga.Artists} {
+		for i := range people {
+			person := &people[i]
+			if err := tx.Where(Models.Person{ProviderID: sharedKey(person.ProviderID, person.Name)}).
+				Assign(Models.Person{Name: person.Name}).
+				FirstOrCreate(person).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Model(manga).Association("Tags").Replace(manga.Tags); err != nil {
+		return err
+	}
+	if err := tx.Model(manga).Association("Authors").Replace(manga.Authors); err != nil {
+		return err
+	}
+	if err := tx.Model(manga).Association("Artists").Replace(manga.Artists); err != nil {
+		return err
+	}
+
+	// Alternative titles and links belong to a single manga, recreate them
+	if err := tx.Unscoped().Where("manga_id = ?", manga.MangaID).Delete(&Models.AltTitle{}).Error; err != nil {
+		return err
+	}
+	for i := range manga.AltTitles {
+		manga.AltTitles[i].ID = 0
+		manga.AltTitles[i].MangaID = manga.MangaID
+	}
+	if len(manga.AltTitles) > 0 {
+		if err := tx.Create(&manga.AltTitles).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Unscoped().Where("manga_id = ?", manga.MangaID).Delete(&Models.Link{}).Error; err != nil {
+		return err
+	}
+	for i := range manga.Links {
+		manga.Links[i].ID = 0
+		manga.Links[i].MangaID = manga.MangaID
+	}
+	if len(manga.Links) > 0 {
+		if err := tx.Create(&manga.Links).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sharedKey Returns the provider id of a shared row, or a key derived from its name
+// for providers that have no ids
+func sharedKey(providerID string, name string) string {
+	if providerID != "" {
+		return providerID
+	}
+
+	return "name:" + name
+}
+
+// Refreshes the metadata of a manga in the library with freshly fetched metadata
+// A changed series cover is reset so the next cover job downloads it again
+func (dbm *DBManager) UpdateMangaMetadata(manga *Models.Manga, fresh *Models.Manga) error {
+	manga.Name = fresh.Name
+	manga.Description = fresh.Description
+	manga.Status = fresh.Status
+	manga.Year = fresh.Year
+	manga.Demographic = fresh.Demographic
+	manga.ContentRating = fresh.ContentRating
+	manga.OriginalLanguage = fresh.OriginalLanguage
+	manga.LastVolume = fresh.LastVolume
+	manga.LastChapter = fresh.LastChapter
+	manga.AltTitles = fresh.AltTitles
+	manga.Links = fresh.Links
+	manga.Tags = fresh.Tags
+	manga.Authors = fresh.Authors
+	manga.Artists = fresh.Artists
+
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(manga).Select(metadataColumns).Updates(manga).Error; err != nil {
+			return err
+		}
+
+		if err := saveMetadata(tx, manga); err != nil {
+			return err
+		}
+
+		if err := indexManga(tx, manga); err != nil {
+			return err
+		}
+
+		// Check the series cover
+		if len(fresh.Covers) == 0 {
+			return nil
+		}
+		for i := range manga.Covers {
+			cover := &manga.Covers[i]
+			if cover.Volume != "" || cover.URL == fresh.Covers[0].URL {
+				continue
+			}
+
+			cover.URL = fresh.Covers[0].URL
+			cover.Hash = ""
+			if err := tx.Model(cover).Select("url", "hash").Updates(cover).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		err = fmt.Errorf("Error updating manga metadata: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Adds newly fetched chapters to a manga in the library
+// New chapters go into the volume of the same name, which is created if needed,
+// unless the volume already has a chapter with the same number
+// Returns the chapters that were put into a volume
+func (dbm *DBManager) SyncChapters(manga *Models.Manga, fetched []Models.Chapter) ([]Models.Chapter, error) {
+	known := make(map[string]bool)
+	for _, chapter := range manga.Chapters {
+		known[chapter.ID] = true
+	}
+
+	// Index the volumes and the chapter numbers they already hold
+	volumes := make(map[string]*Models.Volume)
+	taken := make(map[string]map[string]bool)
+	for i := range manga.Volumes {
+		volume := &manga.Volumes[i]
+		volumes[volume.Name] = volume
+		taken[volume.Name] = make(map[string]bool)
+		for _, chapter := range volume.Chapters {
+			taken[volume.Name][chapter.Chapter] = true
+		}
+	}
+
+	var added []Models.Chapter
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		for _, chapter := range fetched {
+			if known[chapter.ID] {
+				continue
+			}
+			known[chapter.ID] = true
+
+			chapter.MangaID = manga.MangaID
+			chapter.State = Models.ChapterPending
+			if err := tx.Omit(clause.Associations).Create(&chapter).Error; err != nil {
+				return err
+			}
+			manga.Chapters = append(manga.Chapters, chapter)
+
+			volume, exists := volumes[chapter.Volume]
+			if !exists {
+				manga.Volumes = append(manga.Volumes, Models.Volume{MangaID: manga.MangaID, Name: chapter.Volume})
+				volume = &manga.Volumes[len(manga.Volumes)-1]
+				if err := tx.Omit(clause.Associations).Create(volume).Error; err != nil {
+					return err
+				}
+
+				// Appending may have moved the volumes, so rebuild the index
+				for i := range manga.Volumes {
+					volumes[manga.Volumes[i].Name] = &manga.Volumes[i]
+				}
+				taken[volume.Name] = make(map[string]bool)
+			}
+
+			if taken[volume.Name][chapter.Chapter] {
+				continue
+			}
+			taken[volume.Name][chapter.Chapter] = true
+
+			chapter.VolumeID = volume.ID
+			if err := tx.Model(&chapter).Update("volume_id", volume.ID).Error; err != nil {
+				return err
+			}
+			volume.Chapters = append(volume.Chapters, chapter)
+			added = append(added, chapter)
+		}
+
+		if len(added) == 0 {
+			return nil
+		}
+
+		manga.LastChapterAt = time.Now()
+		return tx.Model(manga).Update("last_chapter_at", manga.LastChapterAt).Error
+	})
+
+	if err != nil {
+		err = fmt.Errorf("Error syncing chapters: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	glog.Info("Added ", len(added), " new chapters to ", manga.Name)
+	return added, nil
+}
+
+// Get a manga with its volumes and chapters from the library
+func (dbm *DBManager) GetManga(manga *Models.Manga, mangaID uint) error {
+	err := dbm.DB.
+		Preload("Volumes", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Volumes.Chapters", func(db *gorm.DB) *gorm.DB { return db.Order("chapter_id") }).
+		Preload("Chapters", func(db *gorm.DB) *gorm.DB { return db.Order("chapter_id") }).
+		Preload("Covers").
+		Preload("AltTitles").
+		Preload("Links").
+		Preload("Tags").
+		Preload("Authors").
+		Preload("Artists").
+		First(manga, mangaID).Error
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			err = fmt.Errorf("Manga not found")
+			glog.Info(err)
+			return err
+		}
+
+		err = fmt.Errorf("Error getting manga: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Get a manga with its metadata but without its chapters
+func (dbm *DBManager) GetMangaMetadata(manga *Models.Manga, mangaID uint) error {
+	err := dbm.DB.Preload("Covers").Preload("AltTitles").Preload("Links").
+		Preload("Tags").Preload("Authors").Preload("Artists").
+		First(manga, mangaID).Error
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			err = fmt.Errorf("Manga not found")
+			glog.Info(err)
+			return err
+		}
+
+		err = fmt.Errorf("Error getting manga: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Get a volume with its chapters and their pages
+func (dbm *DBManager) GetVolume(volume *Models.Volume, volumeID uint) error {
+	err := dbm.DB.Preload("Chapters").Preload("Chapters.Pages", orderPages).First(volume, volumeID).Error
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			err = fmt.Errorf("Volume not found")
+			glog.Info(err)
+			return err
+		}
+
+		err = fmt.Errorf("Error getting volume: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	Models.SortChapters(volume.Chapters)
+	return nil
+}
+
+// Check if a manga from a provider is already in the library
+func (dbm *DBManager) IsMangaInLibrary(provider string, id string) (bool, error) {
+	var count int64
+	if err := dbm.DB.Model(&Models.Manga{}).Where("api_provider = ? AND id = ?", provider, id).Count(&count).Error; err != nil {
+		err = fmt.Errorf("Error checking if manga is in the library: %v", err)
+		glog.Error(err)
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// Get a manga from the library by its provider and provider id, without its chapters
+func (dbm *DBManager) GetMangaByProviderID(manga *Models.Manga, provider string, id string) error {
+	var mangaID uint
+	err := dbm.DB.Model(&Models.Manga{}).Where("api_provider = ? AND id = ?", provider, id).
+		Limit(1).Pluck("manga_id", &mangaID).Error
+	if err != nil {
+		err = fmt.Errorf("Error getting manga: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	if mangaID == 0 {
+		err := fmt.Errorf("Manga not found")
+		glog.Info(err)
+		return err
+	}
+
+	return dbm.GetMangaMetadata(manga, mangaID)
+}
+
+// Check if a manga id exists in the library
+func (dbm *DBManager) IsMangaIDInLibrary(mangaID uint) (bool, error) {
+	var count int64
+	if err := dbm.DB.Model(&Models.Manga{}).Where("manga_id = ?", mangaID).Count(&count).Error; err != nil {
+		err = fmt.Errorf("Error checking if manga is in the library: %v", err)
+		glog.Error(err)
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// Check if a chapter id exists in the library
+func (dbm *DBManager) IsChapterIDInLibrary(chapterID uint) (bool, error) {
+	var count int64
+	if err := dbm.DB.Model(&Models.Chapter{}).Where("chapter_id = ?", chapterID).Count(&count).Error; err != nil {
+		err = fmt.Errorf("Error checking if chapter is in the library: %v", err)
+		glog.Error(err)
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// Get a chapter with its pages and manga from the database
+func (dbm *DBManager) GetChapter(chapter *Models.Chapter, chapterID uint) error {
+	err := dbm.DB.Preload("Pages", orderPages).Preload("Manga").First(chapter, chapterID).Error
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			err = fmt.Errorf("Chapter not found")
+			glog.Info(err)
+			return err
+		}
+
+		err = fmt.Errorf("Error getting chapter: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Get every completely downloaded chapter, along with its pages
+func (dbm *DBManager) GetDownloadedChapters() ([]Models.Chapter, error) {
+	var chapters []Models.Chapter
+	err := dbm.DB.Preload("Pages", orderPages).Where("state = ?", Models.ChapterComplete).Find(&chapters).Error
+
+	if err != nil {
+		err = fmt.Errorf("Error getting downloaded chapters: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	return chapters, nil
+}
+
+// Count the manga, chapters and downloaded pages of the library
+func (dbm *DBManager) CountLibrary(storage *Models.StorageStatusJSON) error {
+	counts := []struct {
+		query *gorm.DB
+		count *int64
+	}{
+		{dbm.DB.Model(&Models.Manga{}), &storage.Manga},
+		{dbm.DB.Model(&Models.Chapter{}), &storage.Chapters},
+		{dbm.DB.Model(&Models.Chapter{}).Where("state = ?", Models.ChapterComplete), &storage.ChaptersComplete},
+		{dbm.DB.Model(&Models.Page{}).Where("file_name <> ''"), &storage.Pages},
+	}
+	for _, c := range counts {
+		if err := c.query.Count(c.count).Error; err != nil {
+			err = fmt.Errorf("Error counting the library: %v", err)
+			glog.Error(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Saves a downloaded page, implements Models.DownloadStore
+func (dbm *DBManager) SavePage(page *Models.Page) error {
+	if err := dbm.DB.Save(page).Error; err != nil {
+		err = fmt.Errorf("Error saving page: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Saves the download state and path of a chapter, implements Models.DownloadStore
+func (dbm *DBManager) SaveChapterState(chapter *Models.Chapter) error {
+	err := dbm.DB.Model(chapter).Select("state", "download_path").Updates(chapter).Error
+	if err != nil {
+		err = fmt.Errorf("Error saving chapter state: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Saves a cover of a manga, creating it if it is new
+func (dbm *DBManager) SaveCover(cover *Models.Cover) error {
+	if err := dbm.DB.Omit(clause.Associations).Save(cover).Error; err != nil {
+		err = fmt.Errorf("Error saving cover: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Get the cover of a manga along with the manga
+// An empty volume gets the series cover
+func (dbm *DBManager) GetCover(cover *Models.Cover, mangaID uint, volume string) error {
+	err := dbm.DB.Preload("Manga").Where("manga_id = ? AND volume = ?", mangaID, volume).First(cover).Error
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			err = fmt.Errorf("Cover not found")
+			glog.Info(err)
+			return err
+		}
+
+		err = fmt.Errorf("Error getting cover: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package DB
+
+import (
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/golang/glog"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// loginAccountID Finds the id of the account a login identifier names, without logging a miss
+func (dbm *DBManager) loginAccountID(identifier string) *uint {
+	var account Models.Account
+	if err := dbm.DB.Select("id").Where("username = ?", identifier).Or("email = ?", identifier).First(&account).Error; err != nil {
+		return nil
+	}
+
+	return &account.ID
+}
+
+// RecordLoginAttempt Stores the audit record of a login
+func (dbm *DBManager) RecordLoginAttempt(identifier string, ip string, success bool, reason string) error {
+	attempt := Models.LoginAttempt{
+		AccountID:  dbm.loginAccountID(identifier),
+		Identifier: strings.ToLower(identifier),
+		IP:         ip,
+		Success:    success,
+		Reason:     reason,
+	}
+
+	if !success {
+		glog.Warning("Failed login for ", attempt.Identifier, " from ", ip, ": ", reason)
+	}
+
+	if err := dbm.DB.Create(&attempt).Error; err != nil {
+		err = fmt.Errorf("Error recording login attempt: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// lockout Gets how long the failures matched by the query lock out logins
+// Failures before since are not counted
+func lockout(query *gorm.DB, since time.Time, free int) (time.Duration, error) {
+	// A new session so the conditions can be reused for both queries
+	failures := query.Model(&Models.LoginAttempt{}).
+		Where("success = ? AND reason IN ? AND created_at > ?", false, []string{Models.LoginFailedPassword, Models.LoginFailedOTP}, since).
+		Session(&gorm.Session{})
+
+	var count int64
+	if err := failures.Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	if count <= int64(free) {
+		return 0, nil
+	}
+
+	var last Models.LoginAttempt
+	if err := failures.Order("created_at DESC").Limit(1).Find(&last).Error; err != nil {
+		return 0, err
+	}
+
+	delay := Config.LOGIN_MAX_LOCKOUT
+	if doublings := count - int64(free) - 1; doublings < 16 {
+		if scaled := Config.LOGIN_BASE_LOCKOUT << doublings; scaled < delay {
+			delay = scaled
+		}
+	}
+
+	return time.Until(last.CreatedAt.Add(delay)), nil
+}
+
+// LoginLockout Gets how long logins for an identifier from an IP are refused, 0 if they are not
+// Failures are counted per account (or per identifier if there is no such account, so lockouts do not
+// tell which accounts exist) since its last successful login, and per IP
+func (dbm *DBManager) LoginLockout(identifier string, ip string) (time.Duration, error) {
+	windowStart := time.Now().Add(-Config.LOGIN_ATTEMPT_WINDOW)
+
+	var account *gorm.DB
+	since := windowStart
+	if accountID := dbm.loginAccountID(identifier); accountID != nil {
+		account = dbm.DB.Where("account_id = ?", *accountID)
+
+		var lastSuccess Models.LoginAttempt
+		err := dbm.DB.Where("account_id = ? AND success = ?", *accountID, true).Order("created_at DESC").Limit(1).Find(&lastSuccess).Error
+		if err == nil && lastSuccess.ID != 0 && lastSuccess.CreatedAt.After(since) {
+			since = lastSuccess.CreatedAt
+		}
+	} else {
+		account = dbm.DB.Where("account_id IS NULL AND identifier = ?", strings.ToLower(identifier))
+	}
+
+	accountWait, err := lockout(account, since, Config.LOGIN_FREE_ATTEMPTS)
+	if err != nil {
+		err = fmt.Errorf("Error checking failed logins: %v", err)
+		glog.Error(err)
+		return 0, err
+	}
+
+	ipWait, err := lockout(dbm.DB.Where("ip = ?", ip), windowStart, Config.LOGIN_FREE_ATTEMPTS_PER_IP)
+	if err != nil {
+		err = fmt.Errorf("Error checking failed logins: %v", err)
+		glog.Error(err)
+		return 0, err
+	}
+
+	if ipWait > accountWait {
+		return ipWait, nil
+	}
+	return accountWait, nil
+}
+
+// GetLoginAttempts Gets the latest login attempts of an account, newest first
+func (dbm *DBManager) GetLoginAttempts(accountID uint, limit int) ([]Models.LoginAttempt, error) {
+	var attempts []Models.LoginAttempt
+	if err := dbm.DB.Where("account_id = ?", accountID).Order("created_at DESC").Limit(limit).Find(&attempts).Error; err != nil {
+		err = fmt.Errorf("Error getting login attempts: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	return attempts, nil
+}
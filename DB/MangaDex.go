@@ -0,0 +1,99 @@
+package DB
+
+import (
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/golang/glog"
+	"gorm.io/gorm"
+)
+
+// Saves the MangaDex account linked to an account, replacing any previous link
+func (dbm *DBManager) SaveMangaDexLink(link *Models.MangaDexLink) error {
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		if link.ID == 0 {
+			err := tx.Unscoped().Where("account_id = ?", link.AccountID).Delete(&Models.MangaDexLink{}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Save(link).Error
+	})
+
+	if err != nil {
+		err = fmt.Errorf("Error saving MangaDex link: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Get the MangaDex account linked to an account
+func (dbm *DBManager) GetMangaDexLink(link *Models.MangaDexLink, accountID uint) error {
+	err := dbm.DB.Where("account_id = ?", accountID).First(link).Error
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			err = fmt.Errorf("No MangaDex account is linked")
+			glog.Info(err)
+			return err
+		}
+
+		err = fmt.Errorf("Error getting MangaDex link: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Unlinks the MangaDex account of an account, along with its tokens
+func (dbm *DBManager) DeleteMangaDexLink(accountID uint) error {
+	result := dbm.DB.Unscoped().Where("account_id = ?", accountID).Delete(&Models.MangaDexLink{})
+
+	if result.Error != nil {
+		err := fmt.Errorf("Error deleting MangaDex link: %v", result.Error)
+		glog.Error(err)
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		err := fmt.Errorf("No MangaDex account is linked")
+		glog.Info(err)
+		return err
+	}
+
+	return nil
+}
+
+// Get the provider ids of the chapters of a manga an account has read and has started but not finished
+func (dbm *DBManager) GetReadMarkers(accountID uint, mangaID uint) ([]string, []string, error) {
+	var chapters []struct {
+		ID   string
+		Read bool
+	}
+
+	err := dbm.DB.Model(&Models.ReadProgress{}).
+		Select("chapters.id, read_progresses.read").
+		Joins("JOIN chapters ON chapters.chapter_id = read_progresses.chapter_id").
+		Where("read_progresses.account_id = ? AND read_progresses.manga_id = ?", accountID, mangaID).
+		Scan(&chapters).Error
+	if err != nil {
+		err = fmt.Errorf("Error getting read markers: %v", err)
+		glog.Error(err)
+		return nil, nil, err
+	}
+
+	read := []string{}
+	unread := []string{}
+	for _, chapter := range chapters {
+		if chapter.Read {
+			read = append(read, chapter.ID)
+		} else {
+			unread = append(unread, chapter.ID)
+		}
+	}
+
+	return read, unread, nil
+}
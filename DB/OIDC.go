@@ -0,0 +1,131 @@
+package DB
+
+import (
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/golang/glog"
+	"gorm.io/gorm"
+	"time"
+)
+
+// How many numbered usernames are tried when the username from the identity provider is taken
+const maxUsernameSuffix = 100
+
+// CreateOIDCLogin Saves a single sign-on login until the identity provider redirects back
+// Logins that were never finished are cleared out at the same time
+func (dbm *DBManager) CreateOIDCLogin(login *Models.OIDCLogin) error {
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("expires_at < ?", time.Now()).Delete(&Models.OIDCLogin{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(login).Error
+	})
+	if err != nil {
+		err = fmt.Errorf("Error creating single sign-on login: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// UseOIDCLogin Finds the login with a state and deletes it, so it can only be used once
+func (dbm *DBManager) UseOIDCLogin(login *Models.OIDCLogin, state string) error {
+	invalid := fmt.Errorf("Invalid or expired login state")
+
+	err := dbm.DB.Where("state = ?", Models.HashAPIKey(state)).First(login).Error
+	if err == gorm.ErrRecordNotFound {
+		glog.Info(invalid)
+		return invalid
+	}
+	if err != nil {
+		err = fmt.Errorf("Error getting single sign-on login: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	// Only the request that deletes the login gets to use it
+	result := dbm.DB.Unscoped().Delete(login)
+	if result.Error != nil {
+		err := fmt.Errorf("Error using single sign-on login: %v", result.Error)
+		glog.Error(err)
+		return err
+	}
+	if result.RowsAffected == 0 || login.IsExpired() {
+		glog.Info(invalid)
+		return invalid
+	}
+
+	return nil
+}
+
+// Get the account linked to a subject at the identity provider
+func (dbm *DBManager) GetAccountBySSO(account *Models.Account, subject string) error {
+	if err := dbm.DB.Where("sso_subject = ?", subject).First(account).Error; err != nil {
+		err = fmt.Errorf("Error getting account: %v", err)
+		glog.Info(err)
+		return err
+	}
+
+	return nil
+}
+
+// Link an account to a subject at the identity provider, which verified the email of the account
+func (dbm *DBManager) LinkSSO(account *Models.Account, subject string) error {
+	if err := dbm.DB.Model(account).Updates(map[string]any{"sso_subject": subject, "email_verified": true}).Error; err != nil {
+		err = fmt.Errorf("Error linking account: %v", err)
+		glog.Error(err)
+		return err
+	}
+	account.SSOSubject = &subject
+	account.EmailVerified = true
+
+	return nil
+}
+
+// Create an account for someone logging in through the identity provider for the first time
+// The account has no password, a number is added to the username if it is taken
+func (dbm *DBManager) CreateSSOAccount(identity Models.Identity) (*Models.Account, error) {
+	if taken, err := dbm.IsEmailTaken(identity.Email); err != nil {
+		return nil, err
+	} else if taken {
+		err = fmt.Errorf("Email is taken")
+		glog.Info(err)
+		return nil, err
+	}
+
+	username := identity.Username
+	for i := 2; ; i++ {
+		taken, err := dbm.IsUsernameTaken(username)
+		if err != nil {
+			return nil, err
+		}
+		if !taken {
+			break
+		}
+
+		if i > maxUsernameSuffix {
+			err = fmt.Errorf("Username is taken")
+			glog.Info(err)
+			return nil, err
+		}
+		username = fmt.Sprintf("%s%d", identity.Username, i)
+	}
+
+	subject := identity.Subject
+	account := Models.Account{
+		Username:      username,
+		Email:         identity.Email,
+		EmailVerified: identity.EmailVerified,
+		Role:          identity.Role, // Unless it is the first account, which administers the server
+		SSOSubject:    &subject,
+		API_Keys:      []Models.APIKey{},
+	}
+
+	if err := dbm.createAccount(&account); err != nil {
+		return nil, err
+	}
+
+	return &account, nil
+}
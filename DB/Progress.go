@@ -0,0 +1,274 @@
+package DB
+
+import (
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/golang/glog"
+	"gorm.io/gorm"
+	"math"
+	"time"
+)
+
+// setProgress Creates or updates the progress of an account on a chapter inside tx
+func setProgress(tx *gorm.DB, accountID uint, chapter *Models.Chapter, lastPage int, read bool) (*Models.ReadProgress, error) {
+	var progress Models.ReadProgress
+	err := tx.Where(Models.ReadProgress{AccountID: accountID, ChapterID: chapter.ChapterID}).
+		FirstOrInit(&progress).Error
+	if err != nil {
+		return nil, err
+	}
+
+	progress.MangaID = chapter.MangaID
+	progress.LastPage = lastPage
+	if read && !progress.Read {
+		now := time.Now()
+		progress.CompletedAt = &now
+	} else if !read {
+		progress.CompletedAt = nil
+	}
+	progress.Read = read
+
+	if err := tx.Save(&progress).Error; err != nil {
+		return nil, err
+	}
+
+	return &progress, nil
+}
+
+// Records how far an account got into a chapter
+// Marking a chapter read sets its completion time, marking it unread clears it
+func (dbm *DBManager) SetProgress(accountID uint, chapter *Models.Chapter, lastPage int, read bool) (*Models.ReadProgress, error) {
+	progress, err := setProgress(dbm.DB, accountID, chapter, lastPage, read)
+	if err != nil {
+		err = fmt.Errorf("Error saving progress: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	return progress, nil
+}
+
+// Imports reading progress recorded elsewhere, like in a backup of another reader
+// Progress is only moved forward: read chapters stay read and pages already passed are kept
+// Returns the number of chapters updated
+func (dbm *DBManager) ImportProgress(accountID uint, imported []Models.ReadProgress) (int, error) {
+	updated := 0
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		for _, entry := range imported {
+			var progress Models.ReadProgress
+			err := tx.Where(Models.ReadProgress{AccountID: accountID, ChapterID: entry.ChapterID}).
+				FirstOrInit(&progress).Error
+			if err != nil {
+				return err
+			}
+
+			if progress.Read || (!entry.Read && progress.LastPage >= entry.LastPage) {
+				continue
+			}
+
+			progress.MangaID = entry.MangaID
+			progress.Read = entry.Read
+			if entry.LastPage > progress.LastPage {
+				progress.LastPage = entry.LastPage
+			}
+			if entry.Read {
+				progress.CompletedAt = entry.CompletedAt
+				if progress.CompletedAt == nil {
+					now := time.Now()
+					progress.CompletedAt = &now
+				}
+			}
+
+			if err := tx.Save(&progress).Error; err != nil {
+				return err
+			}
+			updated++
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		err = fmt.Errorf("Error importing progress: %v", err)
+		glog.Error(err)
+		return 0, err
+	}
+
+	return updated, nil
+}
+
+// Marks every chapter of a volume read or unread for an account
+// Returns the number of chapters updated
+func (dbm *DBManager) MarkVolumeRead(accountID uint, volumeID uint, read bool) (int, error) {
+	var chapters []Models.Chapter
+	if err := dbm.DB.Where("volume_id = ?", volumeID).Find(&chapters).Error; err != nil {
+		err = fmt.Errorf("Error getting volume chapters: %v", err)
+		glog.Error(err)
+		return 0, err
+	}
+
+	if len(chapters) == 0 {
+		err := fmt.Errorf("Volume not found")
+		glog.Info(err)
+		return 0, err
+	}
+
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range chapters {
+			lastPage := 0
+			if read {
+				lastPage = chapters[i].PageNumber
+			}
+
+			if _, err := setProgress(tx, accountID, &chapters[i], lastPage, read); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		err = fmt.Errorf("Error marking volume read: %v", err)
+		glog.Error(err)
+		return 0, err
+	}
+
+	return len(chapters), nil
+}
+
+// Get the progress of an account on every chapter of a manga, by chapter id
+func (dbm *DBManager) GetMangaProgress(accountID uint, mangaID uint) (map[uint]Models.ReadProgress, error) {
+	var progresses []Models.ReadProgress
+	if err := dbm.DB.Where("account_id = ? AND manga_id = ?", accountID, mangaID).Find(&progresses).Error; err != nil {
+		err = fmt.Errorf("Error getting progress: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	byChapter := make(map[uint]Models.ReadProgress)
+	for _, progress := range progresses {
+		byChapter[progress.ChapterID] = progress
+	}
+
+	return byChapter, nil
+}
+
+// Get the chapters of a manga that were sorted into volumes, in reading order
+func (dbm *DBManager) GetReadingList(mangaID uint) ([]Models.Chapter, error) {
+	var chapters []Models.Chapter
+	if err := dbm.DB.Where("manga_id = ? AND volume_id <> 0", mangaID).Find(&chapters).Error; err != nil {
+		err = fmt.Errorf("Error getting chapters: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	Models.SortChapters(chapters)
+	return chapters, nil
+}
+
+// Get the highest chapter number an account has read in a manga, and whether it read every chapter
+func (dbm *DBManager) GetReadingSummary(accountID uint, mangaID uint) (int, bool, error) {
+	chapters, err := dbm.GetReadingList(mangaID)
+	if err != nil {
+		return 0, false, err
+	}
+
+	progress, err := dbm.GetMangaProgress(accountID, mangaID)
+	if err != nil {
+		return 0, false, err
+	}
+
+	last := 0
+	allRead := len(chapters) > 0
+	for i := range chapters {
+		if !progress[chapters[i].ChapterID].Read {
+			allRead = false
+			continue
+		}
+
+		// Trackers count whole chapters, 10.5 is still 10 chapters read
+		_, number := chapters[i].ReadingOrder()
+		if !math.IsInf(number, 1) && int(number) > last {
+			last = int(number)
+		}
+	}
+
+	return last, allRead, nil
+}
+
+// Follows a manga for an account, following twice is not an error
+func (dbm *DBManager) FollowManga(accountID uint, mangaID uint) error {
+	follow := Models.Follow{AccountID: accountID, MangaID: mangaID}
+	if err := dbm.DB.Where(follow).FirstOrCreate(&follow).Error; err != nil {
+		err = fmt.Errorf("Error following manga: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Stops following a manga for an account
+func (dbm *DBManager) UnfollowManga(accountID uint, mangaID uint) error {
+	if err := dbm.DB.Unscoped().Where("account_id = ? AND manga_id = ?", accountID, mangaID).Delete(&Models.Follow{}).Error; err != nil {
+		err = fmt.Errorf("Error unfollowing manga: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Get the manga an account follows, ordered by title
+func (dbm *DBManager) GetFollowedManga(accountID uint) ([]Models.Manga, error) {
+	var mangas []Models.Manga
+	err := dbm.DB.Where("manga_id IN (SELECT manga_id FROM follows WHERE account_id = ? AND deleted_at IS NULL)", accountID).
+		Order("name").Find(&mangas).Error
+	if err != nil {
+		err = fmt.Errorf("Error getting followed manga: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	return mangas, nil
+}
+
+// Finds the next chapter to read in every manga an account follows
+// Manga that have been read to the end are left out
+func (dbm *DBManager) ContinueReading(accountID uint) ([]Models.ContinueReading, error) {
+	mangas, err := dbm.GetFollowedManga(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	output := []Models.ContinueReading{}
+	for i := range mangas {
+		chapters, err := dbm.GetReadingList(mangas[i].MangaID)
+		if err != nil {
+			return nil, err
+		}
+
+		progress, err := dbm.GetMangaProgress(accountID, mangas[i].MangaID)
+		if err != nil {
+			return nil, err
+		}
+
+		for j := range chapters {
+			chapterProgress, exists := progress[chapters[j].ChapterID]
+			if exists && chapterProgress.Read {
+				continue
+			}
+
+			chapterProgress.ChapterID = chapters[j].ChapterID
+			output = append(output, Models.ContinueReading{
+				Manga:    mangas[i],
+				Chapter:  chapters[j],
+				Progress: chapterProgress,
+			})
+			break
+		}
+	}
+
+	return output, nil
+}
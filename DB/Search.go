@@ -0,0 +1,223 @@
+package DB
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/golang/glog"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// Columns the library can be sorted by, by sort name
+var sortColumns = map[string]string{
+	"title":   "name",
+	"updated": "last_chapter_at",
+	"added":   "created_at",
+}
+
+// A position in a sorted library listing, handed to clients as an opaque string
+type libraryCursor struct {
+	Title string    `json:"t,omitempty"`
+	Time  time.Time `json:"d,omitempty"`
+	ID    uint      `json:"i"`
+}
+
+// createSearchIndex Creates the FTS5 table used for full text search
+// Returns false if sqlite was built without FTS5 (build with -tags sqlite_fts5), searches then match substrings with LIKE
+// Panics instead if Config.REQUIRE_FULL_TEXT_SEARCH is set
+func (dbm *DBManager) createSearchIndex() bool {
+	if dbm.DB.Migrator().HasTable("manga_search") {
+		return true
+	}
+
+	err := dbm.DB.Exec("CREATE VIRTUAL TABLE manga_search USING fts5(manga_id UNINDEXED, name, alt_titles, description)").Error
+	if err != nil {
+		if Config.REQUIRE_FULL_TEXT_SEARCH {
+			glog.Fatalf("Full text search is unavailable, build with -tags sqlite_fts5: %v", err)
+		}
+		glog.Error("Full text search is unavailable, build with -tags sqlite_fts5. Searches match substrings with LIKE instead: ", err)
+		return false
+	}
+
+	// Index the manga that were added before the table existed
+	var mangas []Models.Manga
+	if err := dbm.DB.Preload("AltTitles").Find(&mangas).Error; err != nil {
+		glog.Fatalf("Failed to load the library for indexing: %v", err)
+	}
+	for i := range mangas {
+		if err := indexManga(dbm.DB, &mangas[i]); err != nil {
+			glog.Fatalf("Failed to index manga: %v", err)
+		}
+	}
+
+	return true
+}
+
+// indexManga Replaces the full text search entry of a manga
+// The manga's alternative titles must be loaded
+func indexManga(tx *gorm.DB, manga *Models.Manga) error {
+	if !tx.Migrator().HasTable("manga_search") {
+		return nil
+	}
+
+	titles := make([]string, len(manga.AltTitles))
+	for i, title := range manga.AltTitles {
+		titles[i] = title.Title
+	}
+
+	if err := tx.Exec("DELETE FROM manga_search WHERE manga_id = ?", manga.MangaID).Error; err != nil {
+		return err
+	}
+
+	return tx.Exec("INSERT INTO manga_search (manga_id, name, alt_titles, description) VALUES (?, ?, ?, ?)",
+		manga.MangaID, manga.Name, strings.Join(titles, "\n"), manga.Description).Error
+}
+
+// matchExpression Turns user input into an FTS5 query matching every word as a prefix
+// Each word is quoted so FTS5 operators in the input are taken literally
+func matchExpression(search string) string {
+	words := strings.Fields(search)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"*`
+	}
+
+	return strings.Join(words, " ")
+}
+
+// Lists the library with filters, sorting and cursor pagination
+// Returns a page of manga and the cursor of the next page, empty on the last page
+func (dbm *DBManager) ListLibrary(query Models.LibraryQuery) ([]Models.Manga, string, error) {
+	// Check the sorting
+	if query.Sort == "" {
+		query.Sort = "title"
+	}
+	column, ok := sortColumns[query.Sort]
+	if !ok {
+		err := fmt.Errorf("Invalid sort: %s", query.Sort)
+		glog.Info(err)
+		return nil, "", err
+	}
+
+	direction := "ASC"
+	comparison := ">"
+	switch query.Order {
+	case "", "asc":
+	case "desc":
+		direction = "DESC"
+		comparison = "<"
+	default:
+		err := fmt.Errorf("Invalid order: %s", query.Order)
+		glog.Info(err)
+		return nil, "", err
+	}
+
+	if query.Limit <= 0 {
+		query.Limit = Config.DEFAULT_PAGE_SIZE
+	} else if query.Limit > Config.MAX_PAGE_SIZE {
+		query.Limit = Config.MAX_PAGE_SIZE
+	}
+
+	tx := dbm.DB.Model(&Models.Manga{})
+
+	// Filters
+	if query.Search != "" {
+		if dbm.SearchIndex {
+			tx = tx.Where("manga_id IN (SELECT manga_id FROM manga_search WHERE manga_search MATCH ?)", matchExpression(query.Search))
+		} else {
+			like := "%" + query.Search + "%"
+			tx = tx.Where("(name LIKE ? OR description LIKE ? OR manga_id IN (SELECT manga_id FROM alt_titles WHERE title LIKE ? AND deleted_at IS NULL))", like, like, like)
+		}
+	}
+	for _, tag := range query.Tags {
+		tx = tx.Where("manga_id IN (SELECT manga_tags.manga_manga_id FROM manga_tags JOIN tags ON tags.id = manga_tags.tag_id WHERE tags.name = ? COLLATE NOCASE OR tags.provider_id = ?)", tag, tag)
+	}
+	if query.Status != "" {
+		tx = tx.Where("status = ?", query.Status)
+	}
+	if query.ContentRating != "" {
+		tx = tx.Where("content_rating = ?", query.ContentRating)
+	}
+	if query.Language != "" {
+		tx = tx.Where("manga_id IN (SELECT manga_id FROM chapters WHERE translated_language = ? AND deleted_at IS NULL)", query.Language)
+	}
+	if query.Provider != "" {
+		tx = tx.Where("api_provider = ?", query.Provider)
+	}
+
+	// Unread means a chapter sorted into a volume the account has not read
+	unread := "manga_id IN (SELECT manga_id FROM chapters WHERE volume_id <> 0 AND deleted_at IS NULL AND chapter_id NOT IN " +
+		"(SELECT chapter_id FROM read_progresses WHERE account_id = ? AND read = true AND deleted_at IS NULL))"
+	switch query.HasUnread {
+	case "":
+	case "true":
+		tx = tx.Where(unread, query.AccountID)
+	case "false":
+		tx = tx.Where("NOT "+unread, query.AccountID)
+	default:
+		err := fmt.Errorf("Invalid has_unread: %s", query.HasUnread)
+		glog.Info(err)
+		return nil, "", err
+	}
+
+	// Continue after the cursor
+	if query.Cursor != "" {
+		var cursor libraryCursor
+		raw, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+		if err == nil {
+			err = json.Unmarshal(raw, &cursor)
+		}
+		if err != nil {
+			err = fmt.Errorf("Invalid cursor")
+			glog.Info(err)
+			return nil, "", err
+		}
+
+		var value interface{} = cursor.Time
+		if query.Sort == "title" {
+			value = cursor.Title
+		}
+		tx = tx.Where(fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND manga_id %[2]s ?))", column, comparison), value, value, cursor.ID)
+	}
+
+	// Fetch one extra to know if there is a next page
+	var mangas []Models.Manga
+	err := tx.Order(column + " " + direction).Order("manga_id " + direction).
+		Limit(query.Limit + 1).
+		Preload("AltTitles").Preload("Links").Preload("Tags").Preload("Authors").Preload("Artists").
+		Find(&mangas).Error
+	if err != nil {
+		err = fmt.Errorf("Error listing the library: %v", err)
+		glog.Error(err)
+		return nil, "", err
+	}
+
+	if len(mangas) <= query.Limit {
+		return mangas, "", nil
+	}
+	mangas = mangas[:query.Limit]
+
+	// Build the cursor from the last manga on the page
+	last := mangas[len(mangas)-1]
+	cursor := libraryCursor{ID: last.MangaID}
+	switch query.Sort {
+	case "title":
+		cursor.Title = last.Name
+	case "updated":
+		cursor.Time = last.LastChapterAt
+	case "added":
+		cursor.Time = last.CreatedAt
+	}
+
+	raw, err := json.Marshal(cursor)
+	if err != nil {
+		err = fmt.Errorf("Error encoding cursor: %v", err)
+		glog.Error(err)
+		return nil, "", err
+	}
+
+	return mangas, base64.RawURLEncoding.EncodeToString(raw), nil
+}
@@ -0,0 +1,336 @@
+package DB
+
+import (
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/golang/glog"
+	"gorm.io/gorm"
+	"sort"
+	"strings"
+)
+
+// Links manga from different providers as one series
+// A manga already in another series is moved over, the series is named after the first manga if name is empty
+func (dbm *DBManager) CreateSeries(series *Models.Series, name string, mangaIDs []uint) error {
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		var manga []Models.Manga
+		if err := tx.Where("manga_id IN ?", mangaIDs).Order("manga_id").Find(&manga).Error; err != nil {
+			return err
+		}
+		if len(manga) != len(uniqueIDs(mangaIDs)) {
+			return fmt.Errorf("Manga not found")
+		}
+
+		series.Name = name
+		if series.Name == "" {
+			series.Name = manga[0].Name
+		}
+		if err := tx.Create(series).Error; err != nil {
+			return err
+		}
+
+		return linkManga(tx, series.ID, mangaIDs)
+	})
+
+	if err != nil {
+		err = fmt.Errorf("Error creating series: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Adds a manga to a series, moving it out of any other series
+func (dbm *DBManager) AddMangaToSeries(seriesID uint, mangaID uint) error {
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&Models.Series{}, seriesID).Error; err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&Models.Manga{}).Where("manga_id = ?", mangaID).Count(&count).Error; err != nil {
+			return err
+		} else if count == 0 {
+			return fmt.Errorf("Manga not found")
+		}
+
+		return linkManga(tx, seriesID, []uint{mangaID})
+	})
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			err = fmt.Errorf("Series not found")
+			glog.Info(err)
+			return err
+		}
+
+		err = fmt.Errorf("Error adding manga to series: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// linkManga Points manga at a series, dropping the series left empty or with a single manga
+func linkManga(tx *gorm.DB, seriesID uint, mangaIDs []uint) error {
+	var previous []uint
+	if err := tx.Model(&Models.Manga{}).Where("manga_id IN ? AND series_id IS NOT NULL AND series_id <> ?", mangaIDs, seriesID).
+		Distinct().Pluck("series_id", &previous).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Model(&Models.Manga{}).Where("manga_id IN ?", mangaIDs).Update("series_id", seriesID).Error; err != nil {
+		return err
+	}
+
+	for _, id := range previous {
+		if err := pruneSeries(tx, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Removes a manga from its series
+func (dbm *DBManager) RemoveMangaFromSeries(seriesID uint, mangaID uint) error {
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Models.Manga{}).Where("manga_id = ? AND series_id = ?", mangaID, seriesID).Update("series_id", nil)
+		if result.Error != nil {
+			return result.Error
+		} else if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return pruneSeries(tx, seriesID)
+	})
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			err = fmt.Errorf("Manga is not in this series")
+			glog.Info(err)
+			return err
+		}
+
+		err = fmt.Errorf("Error removing manga from series: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// pruneSeries Deletes a series once it no longer links manga together
+func pruneSeries(tx *gorm.DB, seriesID uint) error {
+	var count int64
+	if err := tx.Model(&Models.Manga{}).Where("series_id = ?", seriesID).Count(&count).Error; err != nil {
+		return err
+	}
+
+	if count > 1 {
+		return nil
+	}
+
+	return deleteSeries(tx, seriesID)
+}
+
+// Unlinks every manga of a series and deletes it
+func (dbm *DBManager) DeleteSeries(seriesID uint) error {
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&Models.Series{}, seriesID).Error; err != nil {
+			return err
+		}
+
+		return deleteSeries(tx, seriesID)
+	})
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			err = fmt.Errorf("Series not found")
+			glog.Info(err)
+			return err
+		}
+
+		err = fmt.Errorf("Error deleting series: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func deleteSeries(tx *gorm.DB, seriesID uint) error {
+	if err := tx.Model(&Models.Manga{}).Where("series_id = ?", seriesID).Update("series_id", nil).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("series_id = ?", seriesID).Delete(&Models.ChapterSource{}).Error; err != nil {
+		return err
+	}
+
+	return tx.Delete(&Models.Series{}, seriesID).Error
+}
+
+// Get a series with its manga, their chapters and the picked sources
+func (dbm *DBManager) GetSeries(series *Models.Series, seriesID uint) error {
+	err := dbm.DB.
+		Preload("Manga", func(db *gorm.DB) *gorm.DB { return db.Order("manga_id") }).
+		Preload("Manga.Chapters", func(db *gorm.DB) *gorm.DB { return db.Order("chapter_id") }).
+		Preload("Manga.AltTitles").
+		Preload("Manga.Links").
+		Preload("Manga.Tags").
+		Preload("Manga.Authors").
+		Preload("Manga.Artists").
+		Preload("Sources").
+		First(series, seriesID).Error
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			err = fmt.Errorf("Series not found")
+			glog.Info(err)
+			return err
+		}
+
+		err = fmt.Errorf("Error getting series: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Picks the chapter a chapter number of a series is read from
+func (dbm *DBManager) SelectChapterSource(series *Models.Series, chapterID uint) error {
+	var chapter Models.Chapter
+	for _, manga := range series.Manga {
+		for _, candidate := range manga.Chapters {
+			if candidate.ChapterID == chapterID {
+				chapter = candidate
+			}
+		}
+	}
+
+	if chapter.ChapterID == 0 {
+		err := fmt.Errorf("Chapter is not part of this series")
+		glog.Info(err)
+		return err
+	}
+
+	source := Models.ChapterSource{SeriesID: series.ID, Key: Models.ChapterKey(&chapter)}
+	err := dbm.DB.Where(source).Assign(Models.ChapterSource{ChapterID: chapterID}).FirstOrCreate(&source).Error
+	if err != nil {
+		err = fmt.Errorf("Error selecting chapter source: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	// Keep the loaded series in sync
+	for i := range series.Sources {
+		if series.Sources[i].Key == source.Key {
+			series.Sources[i] = source
+			return nil
+		}
+	}
+	series.Sources = append(series.Sources, source)
+
+	return nil
+}
+
+// Finds groups of manga that look like the same series but are not linked yet
+// Manga are grouped when they share a normalized title or alternative title, or an id on another site
+func (dbm *DBManager) FindDuplicates() ([]Models.DuplicateGroup, error) {
+	var manga []Models.Manga
+	if err := dbm.DB.Preload("AltTitles").Preload("Links").Order("manga_id").Find(&manga).Error; err != nil {
+		err = fmt.Errorf("Error finding duplicates: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	// Union the manga sharing a key
+	parent := make([]int, len(manga))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	owner := make(map[string]int)
+	reasons := make(map[int]map[string]bool)
+	for i := range manga {
+		for _, key := range Models.DuplicateKeys(&manga[i]) {
+			j, seen := owner[key]
+			if !seen {
+				owner[key] = i
+				continue
+			}
+
+			if find(i) != find(j) {
+				parent[find(i)] = find(j)
+			}
+			root := find(j)
+			if reasons[root] == nil {
+				reasons[root] = make(map[string]bool)
+			}
+			reasons[root][key] = true
+		}
+	}
+
+	members := make(map[int][]Models.Manga)
+	for i := range manga {
+		root := find(i)
+		members[root] = append(members[root], manga[i])
+	}
+
+	groups := []Models.DuplicateGroup{}
+	for root, group := range members {
+		if len(group) < 2 || sameSeries(group) {
+			continue
+		}
+
+		// Reasons may have been recorded under a root that was merged later
+		found := []string{}
+		for other, keys := range reasons {
+			if find(other) != root {
+				continue
+			}
+			for key := range keys {
+				found = append(found, strings.Replace(key, ":", " ", 1))
+			}
+		}
+		sort.Strings(found)
+
+		groups = append(groups, Models.DuplicateGroup{Manga: group, Reasons: found})
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Manga[0].MangaID < groups[j].Manga[0].MangaID
+	})
+
+	return groups, nil
+}
+
+// sameSeries Returns true if every manga is already linked to the same series
+func sameSeries(manga []Models.Manga) bool {
+	for _, m := range manga {
+		if m.SeriesID == nil || *m.SeriesID != *manga[0].SeriesID {
+			return false
+		}
+	}
+
+	return true
+}
+
+func uniqueIDs(ids []uint) map[uint]bool {
+	unique := make(map[uint]bool)
+	for _, id := range ids {
+		unique[id] = true
+	}
+
+	return unique
+}
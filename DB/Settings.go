@@ -0,0 +1,48 @@
+package DB
+
+import (
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/golang/glog"
+)
+
+// Get the settings of the server, creating them with the defaults of Config the first time
+func (dbm *DBManager) GetSettings(settings *Models.Settings) error {
+	defaults := Models.Settings{OpenRegistration: Config.OPEN_REGISTRATION}
+	if err := dbm.DB.Attrs(defaults).FirstOrCreate(settings).Error; err != nil {
+		err = fmt.Errorf("Error getting settings: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Save changed settings of the server
+func (dbm *DBManager) SaveSettings(settings *Models.Settings) error {
+	if err := dbm.DB.Save(settings).Error; err != nil {
+		err = fmt.Errorf("Error saving settings: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Check if new accounts can register
+// The first account always can, so a new server gets its admin
+func (dbm *DBManager) RegistrationOpen() (bool, error) {
+	if count, err := dbm.CountAccounts(); err != nil {
+		return false, err
+	} else if count == 0 {
+		return true, nil
+	}
+
+	var settings Models.Settings
+	if err := dbm.GetSettings(&settings); err != nil {
+		return false, err
+	}
+
+	return settings.OpenRegistration, nil
+}
@@ -0,0 +1,118 @@
+package DB
+
+import (
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/golang/glog"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Returned for tokens sent to an address the account no longer uses
+var ErrTokenEmailChanged = fmt.Errorf("Email was changed after the token was sent")
+
+// CreateAccountToken Generates a token for an account, replacing its earlier tokens for the same purpose
+// Returns the plaintext token to send
+func (dbm *DBManager) CreateAccountToken(account *Models.Account, purpose string, duration time.Duration) (string, error) {
+	token, plaintext, err := Models.NewAccountToken(account, purpose, duration)
+	if err != nil {
+		return "", err
+	}
+
+	err = dbm.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("account_id = ? AND purpose = ?", account.ID, purpose).Delete(&Models.AccountToken{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(token).Error
+	})
+	if err != nil {
+		err = fmt.Errorf("Error creating token: %v", err)
+		glog.Error(err)
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+// UseAccountToken Finds the token for a purpose and deletes it, so it can only be used once
+func (dbm *DBManager) UseAccountToken(token *Models.AccountToken, plaintext string, purpose string) error {
+	invalid := fmt.Errorf("Invalid or expired token")
+
+	err := dbm.DB.Where("digest = ? AND purpose = ?", Models.HashAPIKey(plaintext), purpose).First(token).Error
+	if err == gorm.ErrRecordNotFound || (err == nil && !token.Matches(plaintext)) {
+		glog.Info(invalid)
+		return invalid
+	}
+	if err != nil {
+		err = fmt.Errorf("Error getting token: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	// Only the request that deletes the token gets to use it
+	result := dbm.DB.Unscoped().Delete(token)
+	if result.Error != nil {
+		err := fmt.Errorf("Error using token: %v", result.Error)
+		glog.Error(err)
+		return err
+	}
+	if result.RowsAffected == 0 || token.IsExpired() {
+		glog.Info(invalid)
+		return invalid
+	}
+
+	return nil
+}
+
+// VerifyEmail Marks the email a verification token was sent to as verified
+func (dbm *DBManager) VerifyEmail(token *Models.AccountToken) error {
+	result := dbm.DB.Model(&Models.Account{}).Where("id = ? AND email = ?", token.AccountID, token.Email).
+		Update("email_verified", true)
+	if result.Error != nil {
+		err := fmt.Errorf("Error verifying email: %v", result.Error)
+		glog.Error(err)
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		glog.Info(ErrTokenEmailChanged)
+		return ErrTokenEmailChanged
+	}
+
+	return nil
+}
+
+// ResetPassword Sets the password of the account a reset token was sent to, revoking every API key
+// The token stops working once the email of the account changes, like verification tokens
+func (dbm *DBManager) ResetPassword(token *Models.AccountToken, newPassword string) error {
+	hashedPassword, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	err = dbm.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Models.Account{}).Where("id = ? AND email = ?", token.AccountID, token.Email).
+			Update("password", hashedPassword)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTokenEmailChanged
+		}
+
+		return tx.Unscoped().Where("account_id = ?", token.AccountID).Delete(&Models.APIKey{}).Error
+	})
+	if err == ErrTokenEmailChanged {
+		glog.Info(err)
+		return err
+	}
+	if err != nil {
+		err = fmt.Errorf("Error resetting password: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
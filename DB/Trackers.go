@@ -0,0 +1,153 @@
+package DB
+
+import (
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/golang/glog"
+	"gorm.io/gorm"
+)
+
+// Saves the login of an account on a tracker, replacing any previous login
+func (dbm *DBManager) SaveTrackerAccount(account *Models.TrackerAccount) error {
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		if account.ID == 0 {
+			err := tx.Unscoped().Where("account_id = ? AND tracker = ?", account.AccountID, account.Tracker).
+				Delete(&Models.TrackerAccount{}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Save(account).Error
+	})
+
+	if err != nil {
+		err = fmt.Errorf("Error saving tracker login: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Get the login of an account on a tracker
+func (dbm *DBManager) GetTrackerAccount(account *Models.TrackerAccount, accountID uint, tracker string) error {
+	err := dbm.DB.Where("account_id = ? AND tracker = ?", accountID, tracker).First(account).Error
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			err = fmt.Errorf("Tracker %s is not linked", tracker)
+			glog.Info(err)
+			return err
+		}
+
+		err = fmt.Errorf("Error getting tracker login: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Get the trackers an account is logged in to, ordered by name
+func (dbm *DBManager) GetTrackerAccounts(accountID uint) ([]Models.TrackerAccount, error) {
+	var accounts []Models.TrackerAccount
+	if err := dbm.DB.Where("account_id = ?", accountID).Order("tracker").Find(&accounts).Error; err != nil {
+		err = fmt.Errorf("Error getting tracker logins: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+// Logs an account out of a tracker and forgets the manga it linked to it
+func (dbm *DBManager) DeleteTrackerAccount(accountID uint, tracker string) error {
+	var deleted int64
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("account_id = ? AND tracker = ?", accountID, tracker).Delete(&Models.TrackerAccount{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+
+		return tx.Unscoped().Where("account_id = ? AND tracker = ?", accountID, tracker).Delete(&Models.TrackerEntry{}).Error
+	})
+
+	if err != nil {
+		err = fmt.Errorf("Error deleting tracker login: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	if deleted == 0 {
+		err := fmt.Errorf("Tracker %s is not linked", tracker)
+		glog.Info(err)
+		return err
+	}
+
+	return nil
+}
+
+// Saves the tracker entry of a manga
+func (dbm *DBManager) SaveTrackerEntry(entry *Models.TrackerEntry) error {
+	if err := dbm.DB.Save(entry).Error; err != nil {
+		err = fmt.Errorf("Error saving tracker entry: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Get the entry of a manga on a tracker for an account
+func (dbm *DBManager) GetTrackerEntry(entry *Models.TrackerEntry, accountID uint, mangaID uint, tracker string) error {
+	err := dbm.DB.Where("account_id = ? AND manga_id = ? AND tracker = ?", accountID, mangaID, tracker).First(entry).Error
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			err = fmt.Errorf("Manga is not tracked on %s", tracker)
+			glog.Info(err)
+			return err
+		}
+
+		err = fmt.Errorf("Error getting tracker entry: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Get the tracker entries of a manga for an account, ordered by tracker
+func (dbm *DBManager) GetTrackerEntries(accountID uint, mangaID uint) ([]Models.TrackerEntry, error) {
+	var entries []Models.TrackerEntry
+	err := dbm.DB.Where("account_id = ? AND manga_id = ?", accountID, mangaID).Order("tracker").Find(&entries).Error
+	if err != nil {
+		err = fmt.Errorf("Error getting tracker entries: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Stops tracking a manga on a tracker for an account
+func (dbm *DBManager) DeleteTrackerEntry(accountID uint, mangaID uint, tracker string) error {
+	result := dbm.DB.Unscoped().Where("account_id = ? AND manga_id = ? AND tracker = ?", accountID, mangaID, tracker).
+		Delete(&Models.TrackerEntry{})
+
+	if result.Error != nil {
+		err := fmt.Errorf("Error deleting tracker entry: %v", result.Error)
+		glog.Error(err)
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		err := fmt.Errorf("Manga is not tracked on %s", tracker)
+		glog.Info(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package DB
+
+import (
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/Tools"
+	"github.com/golang/glog"
+	"gorm.io/gorm"
+	"time"
+)
+
+// SetTOTPSecret Stores the secret of an enrollment, two-factor authentication stays off until it is confirmed
+func (dbm *DBManager) SetTOTPSecret(account *Models.Account, secret string) error {
+	if err := dbm.DB.Model(account).Update("totp_secret", secret).Error; err != nil {
+		err = fmt.Errorf("Error saving TOTP secret: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// replaceRecoveryCodes Deletes the recovery codes of an account and generates new ones
+func replaceRecoveryCodes(tx *gorm.DB, account *Models.Account) ([]string, error) {
+	codes, plaintext, err := Models.NewRecoveryCodes(account, Config.RECOVERY_CODE_COUNT)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Unscoped().Where("account_id = ?", account.ID).Delete(&Models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Create(&codes).Error; err != nil {
+		return nil, err
+	}
+
+	return plaintext, nil
+}
+
+// EnableTOTP Turns on two-factor authentication once the first code was checked
+// Returns the recovery codes of the account
+func (dbm *DBManager) EnableTOTP(account *Models.Account, counter int64) ([]string, error) {
+	var plaintext []string
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(account).Updates(map[string]any{"totp_enabled": true, "totp_counter": counter}).Error
+		if err != nil {
+			return err
+		}
+
+		plaintext, err = replaceRecoveryCodes(tx, account)
+		return err
+	})
+	if err != nil {
+		err = fmt.Errorf("Error enabling two-factor authentication: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	return plaintext, nil
+}
+
+// ReplaceRecoveryCodes Generates new recovery codes, the old ones stop working
+func (dbm *DBManager) ReplaceRecoveryCodes(account *Models.Account) ([]string, error) {
+	var plaintext []string
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		plaintext, err = replaceRecoveryCodes(tx, account)
+		return err
+	})
+	if err != nil {
+		err = fmt.Errorf("Error generating recovery codes: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	return plaintext, nil
+}
+
+// DisableTOTP Turns off two-factor authentication and deletes the secret and recovery codes
+func (dbm *DBManager) DisableTOTP(account *Models.Account) error {
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(account).Updates(map[string]any{"totp_secret": "", "totp_enabled": false, "totp_counter": 0}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Where("account_id = ?", account.ID).Delete(&Models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		err = fmt.Errorf("Error disabling two-factor authentication: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// CheckSecondFactor Checks a TOTP or recovery code of an account
+// A TOTP code is refused if it or a later one was already used, a recovery code is used up
+func (dbm *DBManager) CheckSecondFactor(account *Models.Account, code string) (bool, error) {
+	if counter, ok := Tools.ValidateTOTP(account.TOTPSecret, code, time.Now()); ok {
+		result := dbm.DB.Model(&Models.Account{}).Where("id = ? AND totp_counter < ?", account.ID, counter).
+			Update("totp_counter", counter)
+		if result.Error != nil {
+			err := fmt.Errorf("Error checking TOTP code: %v", result.Error)
+			glog.Error(err)
+			return false, err
+		}
+
+		account.TOTPCounter = counter
+		return result.RowsAffected == 1, nil
+	}
+
+	result := dbm.DB.Unscoped().Where("account_id = ? AND digest = ?", account.ID, Models.HashRecoveryCode(code)).
+		Delete(&Models.RecoveryCode{})
+	if result.Error != nil {
+		err := fmt.Errorf("Error checking recovery code: %v", result.Error)
+		glog.Error(err)
+		return false, err
+	}
+
+	if result.RowsAffected == 1 {
+		glog.Info("Recovery code used for account ", account.ID)
+		return true, nil
+	}
+
+	return false, nil
+}
@@ -6,6 +6,7 @@ import (
 	"golang.org/x/crypto/bcrypt"
 	"github.com/golang/glog"
 	"fmt"
+	"sync"
 	"time"
 )
 
@@ -18,9 +19,14 @@ func HashPassword(password string) (string, error) {
 	return string(hash), nil 
 }
 
+// Checks a password against its hash
+// A wrong password is not an error, errors are only returned for broken hashes
 func VerifyPassword(hashedPassword, password string) (bool, error) {
 	// Compare the hashed password with the password
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
 	if err != nil {
 		return false, err
 	}
@@ -28,6 +34,18 @@ func VerifyPassword(hashedPassword, password string) (bool, error) {
 	return true, nil
 }
 
+// Hash checked when logging in to an account that does not exist, so it takes as long as a wrong password
+var dummyHash string
+var dummyHashOnce sync.Once
+
+func getDummyHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = HashPassword("mangascribe dummy password")
+	})
+
+	return dummyHash
+}
+
 // Checks if a password is valid
 func ValidatePassword(password string) error {
 	// If password is too long
@@ -132,19 +150,51 @@ func (dbm *DBManager) CreateAccount(account Models.NewAccountRequest) (*Models.A
 		Username: account.Username,
 		Password: hashedPassword,
 		Email: account.Email,
+		Role: Models.RoleUser,
 		API_Keys: []Models.APIKey{},
 	}
 
 	// Create the account
-	if err := dbm.DB.Create(&newAccount).Error; err != nil {
-		err = fmt.Errorf("Error creating account: %v", err)
-		glog.Error(err)
+	if err := dbm.createAccount(&newAccount); err != nil {
 		return nil, err
 	}
 
 	return &newAccount, nil
 }
 
+// createAccount Saves a new account, making it the admin if it is the first one
+// Counting and saving happen in one transaction, so two accounts made at once on a new server can not both become admins
+func (dbm *DBManager) createAccount(account *Models.Account) error {
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		// Saving first locks the database for writing, so the count can not change before the transaction ends
+		if err := tx.Create(account).Error; err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&Models.Account{}).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 1 {
+			return nil
+		}
+
+		if err := tx.Model(account).Update("role", Models.RoleAdmin).Error; err != nil {
+			return err
+		}
+		account.Role = Models.RoleAdmin
+
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("Error creating account: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
 // Get an account from the database
 func (dbm *DBManager) GetAccount(account *Models.Account, identifier string) error {
 	if err := dbm.DB.Where("username = ?", identifier).Or("email = ?", identifier).First(&account).Error; err != nil {
@@ -156,14 +206,98 @@ func (dbm *DBManager) GetAccount(account *Models.Account, identifier string) err
 	return nil
 }
 
+// Get an account by id
+func (dbm *DBManager) GetAccountByID(account *Models.Account, id uint) error {
+	if err := dbm.DB.First(account, id).Error; err != nil {
+		err = fmt.Errorf("Error getting account: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Get an account by email only, unlike GetAccount
+func (dbm *DBManager) GetAccountByEmail(account *Models.Account, email string) error {
+	if err := dbm.DB.Where("email = ?", email).First(account).Error; err != nil {
+		err = fmt.Errorf("Error getting account: %v", err)
+		glog.Info(err)
+		return err
+	}
+
+	return nil
+}
+
+// Get every account, oldest first
+func (dbm *DBManager) ListAccounts() ([]Models.Account, error) {
+	var accounts []Models.Account
+	if err := dbm.DB.Order("id").Find(&accounts).Error; err != nil {
+		err = fmt.Errorf("Error listing accounts: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+// Count the accounts of the server
+func (dbm *DBManager) CountAccounts() (int64, error) {
+	var count int64
+	if err := dbm.DB.Model(&Models.Account{}).Count(&count).Error; err != nil {
+		err = fmt.Errorf("Error counting accounts: %v", err)
+		glog.Error(err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Count the admins that are not disabled
+func (dbm *DBManager) CountAdmins() (int64, error) {
+	var count int64
+	if err := dbm.DB.Model(&Models.Account{}).Where("role = ? AND disabled = ?", Models.RoleAdmin, false).Count(&count).Error; err != nil {
+		err = fmt.Errorf("Error counting admins: %v", err)
+		glog.Error(err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Change the role of an account and whether it is disabled
+func (dbm *DBManager) SetAccountRole(account *Models.Account, role string, disabled bool) error {
+	if err := dbm.DB.Model(account).Updates(map[string]any{"role": role, "disabled": disabled}).Error; err != nil {
+		err = fmt.Errorf("Error changing account role: %v", err)
+		glog.Error(err)
+		return err
+	}
+	account.Role = role
+	account.Disabled = disabled
+
+	return nil
+}
+
 // Get an account and check if the password is correct
-// Returns true if the password is correct, false if it is not
+// Returns true if the password is correct, false if it is not or there is no such account
 func (dbm *DBManager) AuthAccount(account *Models.Account, login Models.LoginRequest) (bool, error) {
 	var newAccount Models.Account
-	if err := dbm.GetAccount(&newAccount, login.Identifier); err != nil {
+	err := dbm.DB.Where("username = ?", login.Identifier).Or("email = ?", login.Identifier).First(&newAccount).Error
+	if err == gorm.ErrRecordNotFound {
+		VerifyPassword(getDummyHash(), login.Password)
+		return false, nil
+	}
+	if err != nil {
+		err = fmt.Errorf("Error getting account: %v", err)
+		glog.Error(err)
 		return false, err
 	}
 
+	// Accounts made through single sign-on have no password to log in with
+	if newAccount.Password == "" {
+		VerifyPassword(getDummyHash(), login.Password)
+		return false, nil
+	}
+
 	if ok, err := VerifyPassword(newAccount.Password, login.Password); err != nil {
 		return false, err
 	} else if !ok {	// Password is incorrect
@@ -198,9 +332,45 @@ func (dbm *DBManager) ChangePassword(account *Models.Account, newPassword string
 	return hashedPassword, nil
 }
 
-// Delete an account from the database
+// Delete an account from the database, with its API keys, reading progress, library links and jobs
+// Everything is deleted for good so the username and email can be used again
 func (dbm *DBManager) DeleteAccount(account *Models.Account) error {
-	if err := dbm.DB.Delete(&account).Error; err != nil {
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		// Library jobs the account queued still have to run for everyone else, they just lose their owner
+		accountJobs := []Models.JobType{Models.MangaDexReadJob, Models.MangaDexSyncJob, Models.TrackerJob, Models.BackupImportJob}
+		err := tx.Model(&Models.Job{}).Where("account_id = ? AND type NOT IN ?", account.ID, accountJobs).
+			Update("account_id", 0).Error
+		if err != nil {
+			return err
+		}
+
+		categories := tx.Model(&Models.Category{}).Select("id").Where("account_id = ?", account.ID)
+		if err := tx.Unscoped().Where("category_id IN (?)", categories).Delete(&Models.CategoryManga{}).Error; err != nil {
+			return err
+		}
+
+		owned := []any{
+			&Models.APIKey{},
+			&Models.AccountToken{},
+			&Models.RecoveryCode{},
+			&Models.LoginAttempt{},
+			&Models.ReadProgress{},
+			&Models.Follow{},
+			&Models.Category{},
+			&Models.MangaDexLink{},
+			&Models.TrackerAccount{},
+			&Models.TrackerEntry{},
+			&Models.Job{},
+		}
+		for _, model := range owned {
+			if err := tx.Unscoped().Where("account_id = ?", account.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Unscoped().Delete(account).Error
+	})
+	if err != nil {
 		err = fmt.Errorf("Error deleting account: %v", err)
 		glog.Error(err)
 		return err
@@ -220,8 +390,8 @@ func (dbm *DBManager) ChangeEmail(account *Models.Account, newEmail string) erro
 		return err
 	}
 
-	// Change the email
-	if err := dbm.DB.Model(account).Update("email", newEmail).Error; err != nil {
+	// Change the email, the new address has not been verified yet
+	if err := dbm.DB.Model(account).Updates(map[string]any{"email": newEmail, "email_verified": false}).Error; err != nil {
 		err = fmt.Errorf("Error changing email: %v", err)
 		glog.Error(err)
 		return err
@@ -251,11 +421,65 @@ func (dbm *DBManager) ChangeUsername(account *Models.Account, newUsername string
 	return nil
 }
 
+// Change the username, email and password of an account at once, empty values are left alone
+// A new password replaces every API key of the account with key
+// Nothing is changed if any of it fails
+func (dbm *DBManager) UpdateAccount(account *Models.Account, username string, email string, password string, key *Models.APIKey) error {
+	changes := map[string]any{}
+	if username != "" {
+		changes["username"] = username
+	}
+	if email != "" {
+		// The new address has not been verified yet
+		changes["email"] = email
+		changes["email_verified"] = false
+	}
+	if password != "" {
+		if err := ValidatePassword(password); err != nil {
+			return err
+		}
+
+		hashedPassword, err := HashPassword(password)
+		if err != nil {
+			return err
+		}
+		changes["password"] = hashedPassword
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	err := dbm.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(account).Updates(changes).Error; err != nil {
+			return err
+		}
+
+		if password == "" {
+			return nil
+		}
+
+		// Anyone holding a key made with the old password loses access
+		if err := tx.Unscoped().Where("account_id = ?", account.ID).Delete(&Models.APIKey{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(account).Association("API_Keys").Append(key)
+	})
+	if err != nil {
+		err = fmt.Errorf("Error updating account: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
 // Generate an API key to an account
 // Returns the API key if it was generated successfully
-func (dbm *DBManager) GenerateAPIKey(account *Models.Account, Duration time.Duration) (*Models.APIKey, error) {
+func (dbm *DBManager) GenerateAPIKey(account *Models.Account, label string, scopes []string, Duration time.Duration) (*Models.APIKey, error) {
 	// Generate the API key
-	key, err := account.GenerateAPIKey(Duration)
+	key, err := account.GenerateAPIKey(label, scopes, Duration)
 	if err != nil {
 		return nil, err
 	}
@@ -270,14 +494,31 @@ func (dbm *DBManager) GenerateAPIKey(account *Models.Account, Duration time.Dura
 	return key, nil
 }
 
+// Generate a full access API key for a single sign-on login
+// The key is marked as coming from a login, which accounts without a password use to prove who they are
+func (dbm *DBManager) GenerateSSOAPIKey(account *Models.Account, label string, Duration time.Duration) (*Models.APIKey, error) {
+	key, err := account.GenerateAPIKey(label, Models.AllScopes, Duration)
+	if err != nil {
+		return nil, err
+	}
+	key.SSOLogin = true
+
+	if err := dbm.DB.Model(account).Association("API_Keys").Append(key); err != nil {
+		err = fmt.Errorf("Error adding API key: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	return key, nil
+}
+
 // Check if an API key is valid
-// returns the user associated with the API key if it is valid
+// returns the user and the API key record if it is valid
 // returns an error if the API key is invalid
-func (dbm *DBManager) UserFromKey(account *Models.Account, key string) error {
+func (dbm *DBManager) UserFromKey(account *Models.Account, apiKey *Models.APIKey, key string) error {
 	
-	// Search db for API key
-	var apiKey Models.APIKey
-	if err := dbm.DB.Where("key = ?", key).First(&apiKey).Error; err != nil {
+	// Search db for API key, keys are stored by their digest
+	if err := dbm.DB.Where("digest = ?", Models.HashAPIKey(key)).First(apiKey).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			err = fmt.Errorf("API key not found")
 			glog.Info(err)
@@ -289,6 +530,13 @@ func (dbm *DBManager) UserFromKey(account *Models.Account, key string) error {
 		return err
 	}
 
+	// The lookup already matched, compare again without leaking timing through the index
+	if !apiKey.Matches(key) {
+		err := fmt.Errorf("API key not found")
+		glog.Info(err)
+		return err
+	}
+
 	// Check if API key is expired
 	if apiKey.IsExpired() {
 		err := fmt.Errorf("API key is expired")
@@ -297,17 +545,32 @@ func (dbm *DBManager) UserFromKey(account *Models.Account, key string) error {
 	}
 
 	// Get the user associated with the API key
-	if err := dbm.DB.First(&account, apiKey.AccountID).Error; err != nil {
+	if err := dbm.DB.First(account, apiKey.AccountID).Error; err != nil {
 		err = fmt.Errorf("Error getting user associated with API key: %v", err)
 		glog.Error(err)
 		return err
 	}
+
+	if account.Disabled {
+		err := fmt.Errorf("Account is disabled")
+		glog.Info(err)
+		return err
+	}
 	// if err := dbm.DB.Model(&apiKey).Association("ID").Find(&account); err != nil {
 	// 	err = fmt.Errorf("Error getting user associated with API key: %v", err)
 	// 	glog.Error(err)
 	// 	return err
 	// }
 
+	// Record when the key was last used, at most once a minute to spare the database a write per request
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > time.Minute {
+		if err := dbm.DB.Model(apiKey).UpdateColumn("last_used_at", now).Error; err != nil {
+			glog.Warning("Failed to record API key use: ", err)
+		}
+		apiKey.LastUsedAt = &now
+	}
+
 	return nil
 }
 
@@ -322,3 +585,87 @@ func (dbm *DBManager) GetAPIKeys(account *Models.Account) ([]Models.APIKey, erro
 
 	return apiKeys, nil
 }
+
+// Get an API key of an account by id
+func (dbm *DBManager) GetAPIKey(account *Models.Account, apiKey *Models.APIKey, id uint) error {
+	if err := dbm.DB.Where("account_id = ?", account.ID).First(apiKey, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			err = fmt.Errorf("API key not found")
+			glog.Info(err)
+			return err
+		}
+
+		err = fmt.Errorf("Error getting API key: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Revoke an API key of an account
+// Keys are deleted for good so a revoked key can never authenticate again
+func (dbm *DBManager) RevokeAPIKey(account *Models.Account, id uint) error {
+	result := dbm.DB.Unscoped().Where("account_id = ?", account.ID).Delete(&Models.APIKey{}, id)
+	if result.Error != nil {
+		err := fmt.Errorf("Error revoking API key: %v", result.Error)
+		glog.Error(err)
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		err := fmt.Errorf("API key not found")
+		glog.Info(err)
+		return err
+	}
+
+	return nil
+}
+
+// Revoke every API key of an account, except the key with id keep if it is not 0
+// Returns how many keys were revoked
+func (dbm *DBManager) RevokeAPIKeys(account *Models.Account, keep uint) (int64, error) {
+	query := dbm.DB.Unscoped().Where("account_id = ?", account.ID)
+	if keep != 0 {
+		query = query.Where("id <> ?", keep)
+	}
+
+	result := query.Delete(&Models.APIKey{})
+	if result.Error != nil {
+		err := fmt.Errorf("Error revoking API keys: %v", result.Error)
+		glog.Error(err)
+		return 0, err
+	}
+
+	return result.RowsAffected, nil
+}
+
+// Replace an API key of an account with a new one, with the same label, scopes and lifetime
+// Returns the new API key
+func (dbm *DBManager) RotateAPIKey(account *Models.Account, id uint) (*Models.APIKey, error) {
+	var old Models.APIKey
+	if err := dbm.GetAPIKey(account, &old, id); err != nil {
+		return nil, err
+	}
+
+	key, err := account.GenerateAPIKey(old.Label, old.ScopeList(), old.Lifetime())
+	if err != nil {
+		return nil, err
+	}
+	key.AccountID = account.ID
+
+	err = dbm.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(key).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(&old).Error
+	})
+	if err != nil {
+		err = fmt.Errorf("Error rotating API key: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	return key, nil
+}
@@ -0,0 +1,279 @@
+package Export
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/Tools"
+	"github.com/golang/glog"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Mirror Keeps a copy of the library in the layout Komga and Kavita expect
+// One folder per series with a series.json, and a CBZ with a ComicInfo.xml per chapter or per volume
+type Mirror struct {
+	Root      string
+	PerVolume bool
+}
+
+// series.json in the Mylar format read by Komga
+type seriesJSON struct {
+	Metadata seriesMetadata `json:"metadata"`
+}
+
+type seriesMetadata struct {
+	Type            string `json:"type"`
+	Name            string `json:"name"`
+	ComicID         uint   `json:"comicid"`
+	Year            int    `json:"year,omitempty"`
+	DescriptionText string `json:"description_text"`
+	BookType        string `json:"booktype"`
+	AgeRating       string `json:"age_rating,omitempty"`
+	TotalIssues     int    `json:"total_issues"`
+	Status          string `json:"status"`
+}
+
+// An archive the mirror should contain
+type archive struct {
+	name     string
+	chapters []Models.Chapter
+	info     Models.ComicInfo
+}
+
+func New(root string, perVolume bool) *Mirror {
+	return &Mirror{
+		Root:      root,
+		PerVolume: perVolume,
+	}
+}
+
+// SeriesPath Returns the folder of a manga inside the mirror
+// The folder starts with the manga's id, so manga with the same name get their own folder
+func (mirror *Mirror) SeriesPath(manga *Models.Manga) string {
+	return filepath.Join(mirror.Root, manga.DefaultFolder())
+}
+
+// removeRenamed Removes the folders left in the mirror by a manga under its previous names
+func (mirror *Mirror) removeRenamed(manga *Models.Manga, dir string) {
+	folders, err := filepath.Glob(filepath.Join(mirror.Root, fmt.Sprintf("%d - *", manga.MangaID)))
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
+	for _, folder := range folders {
+		if folder == dir {
+			continue
+		}
+
+		if err := os.RemoveAll(folder); err != nil {
+			glog.Error(err)
+			continue
+		}
+		glog.Info("Removed renamed export ", folder)
+	}
+}
+
+// Export Brings the mirror of a manga up to date with its downloaded chapters
+// The volumes' chapters and pages and the manga's metadata must be loaded
+// Archives newer than their pages are kept, archives of chapters no longer in the library are removed
+func (mirror *Mirror) Export(manga *Models.Manga) error {
+	dir := mirror.SeriesPath(manga)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		err = fmt.Errorf("Failed to create export directory: %w", err)
+		glog.Error(err)
+		return err
+	}
+
+	mirror.removeRenamed(manga, dir)
+
+	archives := mirror.archives(manga)
+	if err := mirror.writeSeries(manga, dir, len(archives)); err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool)
+	for _, archive := range archives {
+		wanted[archive.name] = true
+		path := filepath.Join(dir, archive.name)
+
+		if upToDate(path, archive.chapters) {
+			continue
+		}
+
+		if err := writeArchive(path, archive); err != nil {
+			return err
+		}
+		glog.Info("Exported ", path)
+	}
+
+	// Remove archives of chapters that were replaced or deleted
+	stale, err := filepath.Glob(filepath.Join(dir, "*.cbz"))
+	if err != nil {
+		return err
+	}
+	for _, path := range stale {
+		if wanted[filepath.Base(path)] {
+			continue
+		}
+
+		if err := os.Remove(path); err != nil {
+			glog.Error(err)
+			continue
+		}
+		glog.Info("Removed stale export ", path)
+	}
+
+	return nil
+}
+
+// archives Lists the archives of the downloaded chapters of a manga
+func (mirror *Mirror) archives(manga *Models.Manga) []archive {
+	archives := []archive{}
+
+	for _, volume := range manga.Volumes {
+		chapters := []Models.Chapter{}
+		for _, chapter := range volume.Chapters {
+			if chapter.State == Models.ChapterComplete {
+				chapters = append(chapters, chapter)
+			}
+		}
+		if len(chapters) == 0 {
+			continue
+		}
+		Models.SortChapters(chapters)
+
+		if mirror.PerVolume {
+			info := Models.NewComicInfo(manga, volume.Name, nil)
+			for _, chapter := range chapters {
+				info.PageCount += len(chapter.Pages)
+			}
+
+			archives = append(archives, archive{
+				name:     archiveName(manga.Name, volume.Name, ""),
+				chapters: chapters,
+				info:     info,
+			})
+			continue
+		}
+
+		for i := range chapters {
+			archives = append(archives, archive{
+				name:     archiveName(manga.Name, volume.Name, chapters[i].Chapter),
+				chapters: chapters[i : i+1],
+				info:     Models.NewComicInfo(manga, volume.Name, &chapters[i]),
+			})
+		}
+	}
+
+	return archives
+}
+
+// archiveName Names an archive the way Komga and Kavita parse volume and chapter numbers
+// e.g. "Series Vol. 1 Ch. 12.cbz", volumes without a number are left out
+func archiveName(series string, volume string, chapter string) string {
+	name := series
+
+	volumeNumber, _ := (&Models.Chapter{Volume: volume}).ReadingOrder()
+	if !math.IsInf(volumeNumber, 1) {
+		name += " Vol. " + strings.TrimPrefix(volume, "Volume ")
+	} else if chapter == "" {
+		name += " " + volume
+	}
+
+	if chapter != "" {
+		name += " Ch. " + strings.TrimPrefix(chapter, "Chapter ")
+	}
+
+	return Tools.SanitizeFilename(name + ".cbz")
+}
+
+// upToDate Returns true if the archive exists and is newer than every page in it
+func upToDate(path string, chapters []Models.Chapter) bool {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	var newest time.Time
+	for _, chapter := range chapters {
+		for _, page := range chapter.Pages {
+			if page.DownloadedAt.After(newest) {
+				newest = page.DownloadedAt
+			}
+		}
+	}
+
+	return stat.ModTime().After(newest)
+}
+
+// writeArchive Writes an archive next to its final path and moves it in place
+// so the comic server never scans a half written file
+func writeArchive(path string, archive archive) error {
+	temp := path + ".tmp"
+	file, err := os.Create(temp)
+	if err != nil {
+		err = fmt.Errorf("Failed to create %s: %w", temp, err)
+		glog.Error(err)
+		return err
+	}
+
+	err = Models.WriteCBZ(file, archive.chapters, archive.info)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+
+	if err := os.Rename(temp, path); err != nil {
+		err = fmt.Errorf("Failed to move %s into place: %w", path, err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// writeSeries Writes the series.json of a manga
+func (mirror *Mirror) writeSeries(manga *Models.Manga, dir string, issues int) error {
+	status := "Continuing"
+	if manga.Status == "completed" || manga.Status == "cancelled" {
+		status = "Ended"
+	}
+
+	series := seriesJSON{
+		Metadata: seriesMetadata{
+			Type:            "comicSeries",
+			Name:            manga.Name,
+			ComicID:         manga.MangaID,
+			Year:            manga.Year,
+			DescriptionText: manga.Description,
+			BookType:        "Print",
+			AgeRating:       Models.NewComicInfo(manga, "", nil).AgeRating,
+			TotalIssues:     issues,
+			Status:          status,
+		},
+	}
+
+	content, err := json.MarshalIndent(series, "", "  ")
+	if err != nil {
+		err = fmt.Errorf("Failed to encode series.json: %w", err)
+		glog.Error(err)
+		return err
+	}
+
+	path := filepath.Join(dir, "series.json")
+	if err := os.WriteFile(path+".tmp", content, 0644); err != nil {
+		err = fmt.Errorf("Failed to write series.json: %w", err)
+		glog.Error(err)
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,413 @@
+package Generic
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/Tools"
+	"github.com/golang/glog"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// API A provider scraping a site described by a definition file
+type API struct {
+	Site *Site
+}
+
+var numberPattern = regexp.MustCompile(`\d+(?:\.\d+)?`)
+
+func New(site *Site) API {
+	return API{Site: site}
+}
+
+// SearchManga Returns the first search result of the site
+func (api API) SearchManga(title string) (Models.Manga, error) {
+	if api.Site.Search == nil {
+		err := fmt.Errorf("Site %s does not support search", api.Site.Name)
+		glog.Info(err)
+		return Models.Manga{}, err
+	}
+
+	results, err := api.scrape(api.Site.Search, "", title, 1)
+	if err != nil {
+		return Models.Manga{}, err
+	}
+
+	if len(results) == 0 || results[0]["id"] == "" {
+		err := fmt.Errorf("No manga found for %s", title)
+		glog.Info(err)
+		return Models.Manga{}, err
+	}
+
+	return api.FetchManga(results[0]["id"])
+}
+
+// FetchManga Scrapes the metadata of a manga from its page
+func (api API) FetchManga(id string) (Models.Manga, error) {
+	root, err := api.open(api.urlFor(api.Site.Manga.URL, id, "", 0), api.Site.Manga.Format)
+	if err != nil {
+		return Models.Manga{}, err
+	}
+
+	fields := api.Site.Manga.Fields
+	field := func(name string) string {
+		selector, ok := fields[name]
+		if !ok {
+			return ""
+		}
+		found, err := value(root, selector)
+		if err != nil {
+			glog.Warning("Failed to read ", name, " of ", id, ": ", err)
+		}
+		return found
+	}
+	list := func(name string) []string {
+		selector, ok := fields[name]
+		if !ok {
+			return []string{}
+		}
+		found, err := values(root, selector)
+		if err != nil {
+			glog.Warning("Failed to read ", name, " of ", id, ": ", err)
+		}
+		return found
+	}
+
+	manga := Models.Manga{
+		ID:          id,
+		Name:        field("title"),
+		Description: field("description"),
+		Status:      strings.ToLower(field("status")),
+		APIProvider: api.GetProvider(),
+	}
+
+	if manga.Name == "" {
+		err := fmt.Errorf("No title found for manga %s on %s", id, api.Site.Name)
+		glog.Error(err)
+		return Models.Manga{}, err
+	}
+
+	if year, err := strconv.Atoi(field("year")); err == nil {
+		manga.Year = year
+	}
+
+	if cover := field("cover"); cover != "" {
+		manga.Covers = []Models.Cover{{URL: api.resolve(api.urlFor(api.Site.Manga.URL, id, "", 0), cover)}}
+	}
+
+	for _, title := range list("alt_titles") {
+		manga.AltTitles = append(manga.AltTitles, Models.AltTitle{Title: title})
+	}
+	for _, name := range list("authors") {
+		manga.Authors = append(manga.Authors, Models.Person{ProviderID: api.sharedID(name), Name: name})
+	}
+	for _, name := range list("artists") {
+		manga.Artists = append(manga.Artists, Models.Person{ProviderID: api.sharedID(name), Name: name})
+	}
+	for _, name := range list("tags") {
+		manga.Tags = append(manga.Tags, Models.Tag{ProviderID: api.sharedID(name), Name: name, Group: "genre"})
+	}
+
+	return manga, nil
+}
+
+// FetchChapters Scrapes the chapter list of a manga, numbering chapters by position when the site doesn't
+func (api API) FetchChapters(id string) ([]Models.Chapter, error) {
+	items, err := api.scrape(&api.Site.Chapters, id, "", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	chapters := []Models.Chapter{}
+	seen := make(map[string]bool)
+	for i, item := range items {
+		if item["id"] == "" || seen[item["id"]] {
+			continue
+		}
+		seen[item["id"]] = true
+
+		chapter := Models.Chapter{
+			ID:                 item["id"],
+			Title:              item["title"],
+			Chapter:            item["chapter"],
+			Volume:             item["volume"],
+			TranslatedLanguage: item["language"],
+		}
+
+		if number := numberPattern.FindString(chapter.Chapter); number != "" {
+			chapter.Chapter = "Chapter " + number
+		} else if chapter.Chapter == "" {
+			chapter.Chapter = "Chapter " + strconv.Itoa(i+1)
+		}
+
+		if number := numberPattern.FindString(chapter.Volume); number != "" {
+			chapter.Volume = "Volume " + number
+		} else if chapter.Volume == "" {
+			chapter.Volume = Config.EMPTY_VOLUME_NAME
+		}
+
+		if chapter.TranslatedLanguage == "" {
+			chapter.TranslatedLanguage = api.Site.Language
+		}
+
+		chapters = append(chapters, chapter)
+	}
+
+	return chapters, nil
+}
+
+// FetchChapterDownload Scrapes the absolute image URLs of a chapter's pages
+func (api API) FetchChapterDownload(id string, datasaver bool) (string, []string, error) {
+	items, err := api.scrape(&api.Site.Pages, id, "", 0)
+	if err != nil {
+		return "", nil, err
+	}
+
+	links := []string{}
+	for _, item := range items {
+		if item["image"] != "" {
+			links = append(links, item["image"])
+		}
+	}
+
+	if len(links) == 0 {
+		err := fmt.Errorf("No pages found for chapter %s on %s", id, api.Site.Name)
+		glog.Error(err)
+		return "", nil, err
+	}
+
+	return "", links, nil
+}
+
+// FetchPage Downloads a page image with the site's headers
+func (api API) FetchPage(URL string, link string) (io.ReadCloser, error) {
+	content, err := api.fetch(URL + link)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+// FetchCovers Sites only have the series cover, which comes with the manga
+func (API) FetchCovers(id string) ([]Models.Cover, error) {
+	return []Models.Cover{}, nil
+}
+
+func (API) PageHash(filename string) string {
+	return ""
+}
+
+func (api API) GetProvider() string {
+	return api.Site.Name
+}
+
+func (api API) Capabilities() Models.Capabilities {
+	languages := []string{}
+	if api.Site.Language != "" {
+		languages = append(languages, api.Site.Language)
+	}
+
+	return Models.Capabilities{
+		Search:    api.Site.Search != nil,
+		Feed:      true,
+		Languages: languages,
+	}
+}
+
+// scrape Collects the fields of every item of a listing, following its pagination
+// Stops once limit items are found if limit is positive
+func (api API) scrape(listing *Listing, id string, query string, limit int) ([]map[string]string, error) {
+	pagination := listing.Pagination
+	maxPages := pagination.MaxPages
+	if maxPages <= 0 {
+		maxPages = defaultMaxPages
+	}
+	page := pagination.FirstPage
+	if page == 0 {
+		page = 1
+	}
+
+	items := []map[string]string{}
+	current := api.urlFor(listing.URL, id, query, page)
+	visited := make(map[string]bool)
+
+	for count := 0; count < maxPages && !visited[current]; count++ {
+		visited[current] = true
+
+		root, err := api.open(current, listing.Format)
+		if err != nil {
+			return nil, err
+		}
+
+		found, err := root.find(listing.Items)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			break
+		}
+
+		for _, item := range found {
+			fields := make(map[string]string)
+			for name, selector := range listing.Fields {
+				if fields[name], err = value(item, selector); err != nil {
+					return nil, err
+				}
+			}
+
+			// Ids of HTML pages are links, stored relative to the site when they can be
+			if fields["id"] != "" && listing.Format != "json" {
+				fields["id"] = api.resolve(current, fields["id"])
+				fields["id"] = strings.TrimPrefix(fields["id"], strings.TrimSuffix(api.Site.BaseURL, "/"))
+			}
+			if fields["image"] != "" {
+				fields["image"] = api.resolve(current, fields["image"])
+			}
+
+			items = append(items, fields)
+			if limit > 0 && len(items) >= limit {
+				return items, nil
+			}
+		}
+
+		// Move on to the next page, by link or by counting up
+		if pagination.Next != nil {
+			next, err := value(root, *pagination.Next)
+			if err != nil || next == "" {
+				break
+			}
+			current = api.resolve(current, next)
+		} else if strings.Contains(listing.URL, "{page}") {
+			page++
+			current = api.urlFor(listing.URL, id, query, page)
+		} else {
+			break
+		}
+	}
+
+	if listing.Reverse {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	return items, nil
+}
+
+// open Fetches and parses a page
+func (api API) open(pageURL string, format string) (node, error) {
+	content, err := api.fetch(pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := parse(content, format)
+	if err != nil {
+		err = fmt.Errorf("Failed to read %s: %w", pageURL, err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	return root, nil
+}
+
+// fetch Gets a URL with the site's headers, file:// URLs are read from disk
+// so a definition can be tried against saved pages
+// Only sites with a file:// base_url read files, and only inside their base folder,
+// so links scraped from a real site can not point at the server's files
+func (api API) fetch(pageURL string) ([]byte, error) {
+	parsed, err := url.Parse(pageURL)
+	if err != nil {
+		err = fmt.Errorf("Invalid URL %s: %w", pageURL, err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	if parsed.Scheme == "file" {
+		path, err := api.localPath(parsed)
+		if err != nil {
+			glog.Error(err)
+			return nil, err
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			err = fmt.Errorf("Failed to read %s: %w", path, err)
+			glog.Error(err)
+			return nil, err
+		}
+		return content, nil
+	}
+
+	headers := map[string]string{"Referer": api.Site.BaseURL}
+	for key, value := range api.Site.Headers {
+		headers[key] = value
+	}
+
+	return Tools.RequestGETHeaders(pageURL, nil, headers)
+}
+
+// localPath Returns the file a file:// URL points to, if the site may read it
+func (api API) localPath(fileURL *url.URL) (string, error) {
+	base, err := url.Parse(api.Site.BaseURL)
+	if err != nil || base.Scheme != "file" {
+		return "", fmt.Errorf("Site %s can not read local file %s, its base_url is not a file:// URL", api.Site.Name, fileURL.Path)
+	}
+
+	root := filepath.Clean(base.Path)
+	path := filepath.Clean(fileURL.Path)
+	if relative, err := filepath.Rel(root, path); err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Site %s can not read %s, it is outside of %s", api.Site.Name, path, root)
+	}
+
+	return path, nil
+}
+
+// urlFor Fills in a URL template, an empty template opens the id itself
+func (api API) urlFor(template string, id string, query string, page int) string {
+	if template == "" {
+		return api.resolve(api.Site.BaseURL, id)
+	}
+
+	replacer := strings.NewReplacer(
+		"{base}", strings.TrimSuffix(api.Site.BaseURL, "/"),
+		"{id}", id,
+		"{query}", url.QueryEscape(query),
+		"{page}", strconv.Itoa(page),
+	)
+
+	return replacer.Replace(template)
+}
+
+// resolve Makes a link found on a page absolute
+// With a file:// base, links from the site root stay inside the base folder
+func (api API) resolve(pageURL string, link string) string {
+	if strings.HasPrefix(api.Site.BaseURL, "file://") && strings.HasPrefix(link, "/") && !strings.HasPrefix(link, "//") {
+		return strings.TrimSuffix(api.Site.BaseURL, "/") + link
+	}
+
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return link
+	}
+
+	reference, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+
+	return base.ResolveReference(reference).String()
+}
+
+// sharedID Builds the id of a tag or person, unique to the site
+func (api API) sharedID(name string) string {
+	return api.Site.Name + ":" + strings.ToLower(name)
+}
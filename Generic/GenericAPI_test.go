@@ -0,0 +1,180 @@
+package Generic
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fixtureSite Loads the definition in testdata, reading the saved pages of testdata/site
+func fixtureSite(t *testing.T) API {
+	t.Helper()
+
+	site, err := LoadSite(filepath.Join("testdata", "site.yaml"))
+	if err != nil {
+		t.Fatalf("LoadSite: %v", err)
+	}
+
+	root, err := filepath.Abs(filepath.Join("testdata", "site"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	site.BaseURL = "file://" + filepath.ToSlash(root)
+
+	return New(site)
+}
+
+func TestSearchFollowsPages(t *testing.T) {
+	api := fixtureSite(t)
+
+	results, err := api.scrape(api.Site.Search, "", "blue", 0)
+	if err != nil {
+		t.Fatalf("scrape: %v", err)
+	}
+
+	want := []string{"/series/blue-period.html", "/series/blue-lock.html", "/series/blue-giant.html"}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d: %v", len(results), len(want), results)
+	}
+	for i, id := range want {
+		if results[i]["id"] != id {
+			t.Errorf("result %d: got id %q, want %q", i, results[i]["id"], id)
+		}
+	}
+}
+
+func TestSearchManga(t *testing.T) {
+	api := fixtureSite(t)
+
+	manga, err := api.SearchManga("blue")
+	if err != nil {
+		t.Fatalf("SearchManga: %v", err)
+	}
+
+	if manga.ID != "/series/blue-period.html" || manga.Name != "Blue Period" {
+		t.Fatalf("got %q %q, want the first result", manga.ID, manga.Name)
+	}
+	if manga.APIProvider != "fixture" {
+		t.Errorf("got provider %q, want fixture", manga.APIProvider)
+	}
+	if manga.Description != "A student discovers painting." || manga.Status != "ongoing" || manga.Year != 2017 {
+		t.Errorf("got description %q, status %q, year %d", manga.Description, manga.Status, manga.Year)
+	}
+	if len(manga.Authors) != 1 || manga.Authors[0].ProviderID != "fixture:tsubasa yamaguchi" {
+		t.Errorf("got authors %+v", manga.Authors)
+	}
+	if len(manga.Tags) != 2 {
+		t.Errorf("got tags %+v", manga.Tags)
+	}
+	if len(manga.Covers) != 1 || manga.Covers[0].URL != api.Site.BaseURL+"/covers/blue-period.jpg" {
+		t.Errorf("got covers %+v", manga.Covers)
+	}
+}
+
+func TestFetchChapters(t *testing.T) {
+	api := fixtureSite(t)
+
+	chapters, err := api.FetchChapters("/series/blue-period.html")
+	if err != nil {
+		t.Fatalf("FetchChapters: %v", err)
+	}
+
+	// The listing is newest first over two pages, and repeats chapter 2
+	want := []struct{ id, chapter, volume, title string }{
+		{"/chapters/blue-period-1.html", "Chapter 1", "Extras", "First"},
+		{"/chapters/blue-period-2.html", "Chapter 2", "Volume 1", "Second"},
+		{"/chapters/blue-period-3.html", "Chapter 3", "Volume 1", "Third"},
+	}
+	if len(chapters) != len(want) {
+		t.Fatalf("got %d chapters, want %d: %+v", len(chapters), len(want), chapters)
+	}
+	for i, w := range want {
+		chapter := chapters[i]
+		if chapter.ID != w.id || chapter.Chapter != w.chapter || chapter.Volume != w.volume || chapter.Title != w.title {
+			t.Errorf("chapter %d: got %q %q %q %q, want %q %q %q %q", i,
+				chapter.ID, chapter.Chapter, chapter.Volume, chapter.Title, w.id, w.chapter, w.volume, w.title)
+		}
+		if chapter.TranslatedLanguage != "en" {
+			t.Errorf("chapter %d: got language %q, want the site's", i, chapter.TranslatedLanguage)
+		}
+	}
+}
+
+func TestFetchPages(t *testing.T) {
+	api := fixtureSite(t)
+
+	_, links, err := api.FetchChapterDownload("/chapters/blue-period-1.html", false)
+	if err != nil {
+		t.Fatalf("FetchChapterDownload: %v", err)
+	}
+
+	want := []string{
+		api.Site.BaseURL + "/images/blue-period-1/01.png",
+		api.Site.BaseURL + "/images/blue-period-1/02.png",
+	}
+	if len(links) != len(want) {
+		t.Fatalf("got %d pages, want %d: %v", len(links), len(want), links)
+	}
+
+	for i, link := range links {
+		if link != want[i] {
+			t.Errorf("page %d: got %q, want %q", i, link, want[i])
+		}
+
+		page, err := api.FetchPage("", link)
+		if err != nil {
+			t.Fatalf("FetchPage %s: %v", link, err)
+		}
+		content, _ := io.ReadAll(page)
+		page.Close()
+		if len(content) == 0 {
+			t.Errorf("page %d is empty", i)
+		}
+	}
+}
+
+func TestLocalFilesStayInsideTheSite(t *testing.T) {
+	api := fixtureSite(t)
+
+	_, links, err := api.FetchChapterDownload("/chapters/escape.html", false)
+	if err != nil {
+		t.Fatalf("FetchChapterDownload: %v", err)
+	}
+
+	if _, err := api.FetchPage("", links[0]); err == nil {
+		t.Fatalf("read %s from outside the site folder", links[0])
+	}
+}
+
+func TestRemoteSitesDoNotReadLocalFiles(t *testing.T) {
+	fixture := fixtureSite(t)
+
+	var referer string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		referer = r.Header.Get("Referer")
+		io.WriteString(w, `<div class="reader"><img data-src="`+fixture.Site.BaseURL+`/images/blue-period-1/01.png"></div>`)
+	}))
+	defer server.Close()
+
+	site := *fixture.Site
+	site.BaseURL = server.URL
+	api := New(&site)
+
+	_, links, err := api.FetchChapterDownload("/chapters/1", false)
+	if err != nil {
+		t.Fatalf("FetchChapterDownload: %v", err)
+	}
+	if referer != server.URL {
+		t.Errorf("got Referer %q, want the base URL", referer)
+	}
+	if !strings.HasPrefix(links[0], "file://") {
+		t.Fatalf("got link %q, want the scraped file:// link", links[0])
+	}
+
+	if _, err := api.FetchPage("", links[0]); err == nil {
+		t.Fatalf("a site served over HTTP read %s", links[0])
+	}
+}
@@ -0,0 +1,190 @@
+package Generic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/antchfx/htmlquery"
+	"github.com/oliveagle/jsonpath"
+	"golang.org/x/net/html"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// node A part of a fetched page selectors run against
+type node interface {
+	find(selector Selector) ([]node, error)
+	text(attr string) string
+}
+
+// parse Reads a fetched page as HTML or JSON
+func parse(content []byte, format string) (node, error) {
+	if format == "json" {
+		var value interface{}
+		if err := json.Unmarshal(content, &value); err != nil {
+			return nil, fmt.Errorf("Failed to parse JSON: %w", err)
+		}
+		return jsonNode{value}, nil
+	}
+
+	document, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse HTML: %w", err)
+	}
+	return htmlNode{document}, nil
+}
+
+// values Returns the values a selector picks from a node, skipping empty ones
+func values(root node, selector Selector) ([]string, error) {
+	nodes, err := root.find(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	regex, err := compileRegex(selector.Regex)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []string{}
+	for _, found := range nodes {
+		value := strings.TrimSpace(found.text(selector.Attr))
+		if regex != nil {
+			groups := regex.FindStringSubmatch(value)
+			switch {
+			case groups == nil:
+				value = ""
+			case len(groups) > 1:
+				value = groups[1]
+			default:
+				value = groups[0]
+			}
+		}
+
+		if value != "" {
+			list = append(list, value)
+		}
+	}
+
+	return list, nil
+}
+
+// value Returns the first value a selector picks from a node, or ""
+func value(root node, selector Selector) (string, error) {
+	list, err := values(root, selector)
+	if err != nil || len(list) == 0 {
+		return "", err
+	}
+
+	return list[0], nil
+}
+
+var regexCache sync.Map
+
+// compileRegex Compiles a selector regex once, nil if there is none
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+
+	if cached, ok := regexCache.Load(pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %s: %w", pattern, err)
+	}
+	regexCache.Store(pattern, regex)
+
+	return regex, nil
+}
+
+type htmlNode struct {
+	node *html.Node
+}
+
+func (root htmlNode) find(selector Selector) ([]node, error) {
+	var found []*html.Node
+
+	switch {
+	case selector.CSS != "":
+		found = goquery.NewDocumentFromNode(root.node).Find(selector.CSS).Nodes
+	case selector.XPath != "":
+		var err error
+		if found, err = htmlquery.QueryAll(root.node, selector.XPath); err != nil {
+			return nil, fmt.Errorf("Invalid XPath %s: %w", selector.XPath, err)
+		}
+	case selector.JSONPath != "":
+		return nil, fmt.Errorf("JSONPath %s used on an HTML page", selector.JSONPath)
+	default:
+		found = []*html.Node{root.node}
+	}
+
+	nodes := make([]node, len(found))
+	for i := range found {
+		nodes[i] = htmlNode{found[i]}
+	}
+
+	return nodes, nil
+}
+
+func (root htmlNode) text(attr string) string {
+	if attr != "" {
+		return htmlquery.SelectAttr(root.node, attr)
+	}
+
+	return htmlquery.InnerText(root.node)
+}
+
+type jsonNode struct {
+	value interface{}
+}
+
+func (root jsonNode) find(selector Selector) ([]node, error) {
+	if selector.CSS != "" || selector.XPath != "" {
+		return nil, fmt.Errorf("CSS or XPath selector used on a JSON response")
+	}
+
+	if selector.JSONPath == "" {
+		return []node{root}, nil
+	}
+
+	found, err := jsonpath.JsonPathLookup(root.value, selector.JSONPath)
+	if err != nil {
+		// Missing keys just mean there is nothing to select
+		return []node{}, nil
+	}
+
+	if list, ok := found.([]interface{}); ok {
+		nodes := make([]node, len(list))
+		for i := range list {
+			nodes[i] = jsonNode{list[i]}
+		}
+		return nodes, nil
+	}
+
+	return []node{jsonNode{found}}, nil
+}
+
+func (root jsonNode) text(attr string) string {
+	value := root.value
+	if object, ok := value.(map[string]interface{}); ok && attr != "" {
+		value = object[attr]
+	}
+
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		encoded, _ := json.Marshal(value)
+		return string(encoded)
+	}
+}
@@ -0,0 +1,220 @@
+package Generic
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Site A website described by a YAML or JSON definition
+// URL templates can use {base}, {id}, {query} and {page}, an empty template opens the id itself
+type Site struct {
+	Name     string            `yaml:"name"`     // Stable provider name stored on manga
+	BaseURL  string            `yaml:"base_url"` // A file:// URL reads saved pages inside that folder
+	Language string            `yaml:"language"` // Language of the chapters, if the site has one
+	Headers  map[string]string `yaml:"headers"`  // Sent with every request, images included
+	Search   *Listing          `yaml:"search"`
+	Manga    MangaRules        `yaml:"manga"`
+	Chapters Listing           `yaml:"chapters"`
+	Pages    Listing           `yaml:"pages"`
+}
+
+// Listing A list of items scraped from one or more pages
+type Listing struct {
+	URL        string              `yaml:"url"`
+	Format     string              `yaml:"format"` // html (default) or json
+	Items      Selector            `yaml:"items"`
+	Fields     map[string]Selector `yaml:"fields"`
+	Reverse    bool                `yaml:"reverse"` // Items are listed newest first
+	Pagination Pagination          `yaml:"pagination"`
+}
+
+// MangaRules The fields of a manga page
+type MangaRules struct {
+	URL    string              `yaml:"url"`
+	Format string              `yaml:"format"`
+	Fields map[string]Selector `yaml:"fields"`
+}
+
+// Pagination How to find the following pages of a listing
+// Either a selector for the link to the next page, or a {page} in the URL counting up from FirstPage
+// until a page has no items
+type Pagination struct {
+	Next      *Selector `yaml:"next"`
+	FirstPage int       `yaml:"first_page"`
+	MaxPages  int       `yaml:"max_pages"`
+}
+
+// Selector Picks nodes or values from a page with exactly one of CSS, XPath or JSONPath
+// Values are the text of the node, or Attr if it is set, narrowed to the first group of Regex
+type Selector struct {
+	CSS      string `yaml:"css"`
+	XPath    string `yaml:"xpath"`
+	JSONPath string `yaml:"jsonpath"`
+	Attr     string `yaml:"attr"`
+	Regex    string `yaml:"regex"`
+}
+
+// Fields a listing or manga page can have, by where they are used
+var (
+	searchFields  = []string{"id", "title"}
+	chapterFields = []string{"id"}
+	pageFields    = []string{"image"}
+	mangaFields   = []string{"title"}
+)
+
+const defaultMaxPages = 50
+
+// LoadSites Reads every .yaml, .yml and .json site definition in a folder
+// A missing folder means there are no sites
+func LoadSites(dir string) ([]API, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []API{}, nil
+	} else if err != nil {
+		err = fmt.Errorf("Failed to read sites folder: %w", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	sites := []API{}
+	names := make(map[string]bool)
+	for _, entry := range entries {
+		extension := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (extension != ".yaml" && extension != ".yml" && extension != ".json") {
+			continue
+		}
+
+		site, err := LoadSite(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		if names[site.Name] {
+			err := fmt.Errorf("Duplicate site name %s in %s", site.Name, entry.Name())
+			glog.Error(err)
+			return nil, err
+		}
+		names[site.Name] = true
+
+		sites = append(sites, New(site))
+	}
+
+	return sites, nil
+}
+
+// LoadSite Reads and checks a site definition, JSON being a subset of YAML
+func LoadSite(path string) (*Site, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("Failed to read site %s: %w", path, err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	var site Site
+	if err := yaml.Unmarshal(content, &site); err != nil {
+		err = fmt.Errorf("Failed to parse site %s: %w", path, err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	if err := site.Validate(); err != nil {
+		err = fmt.Errorf("Invalid site %s: %w", path, err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	return &site, nil
+}
+
+// Validate Checks that the definition has everything the provider needs
+func (site *Site) Validate() error {
+	if site.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	if site.Name == "mangadex" || site.Name == "local" {
+		return fmt.Errorf("name %s is reserved", site.Name)
+	}
+	if site.BaseURL == "" {
+		return fmt.Errorf("missing base_url")
+	}
+
+	if site.Search != nil {
+		if err := site.Search.validate("search", searchFields); err != nil {
+			return err
+		}
+	}
+	if err := site.Chapters.validate("chapters", chapterFields); err != nil {
+		return err
+	}
+	if err := site.Pages.validate("pages", pageFields); err != nil {
+		return err
+	}
+
+	for _, field := range mangaFields {
+		if _, ok := site.Manga.Fields[field]; !ok {
+			return fmt.Errorf("manga is missing the %s field", field)
+		}
+	}
+	for name, selector := range site.Manga.Fields {
+		if err := selector.validate(); err != nil {
+			return fmt.Errorf("manga field %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (listing *Listing) validate(name string, required []string) error {
+	if listing.Format != "" && listing.Format != "html" && listing.Format != "json" {
+		return fmt.Errorf("%s has unknown format %s", name, listing.Format)
+	}
+	if err := listing.Items.validate(); err != nil {
+		return fmt.Errorf("%s items: %w", name, err)
+	}
+
+	for _, field := range required {
+		if _, ok := listing.Fields[field]; !ok {
+			return fmt.Errorf("%s is missing the %s field", name, field)
+		}
+	}
+	for field, selector := range listing.Fields {
+		if err := selector.validate(); err != nil {
+			return fmt.Errorf("%s field %s: %w", name, field, err)
+		}
+	}
+
+	if listing.Pagination.Next != nil {
+		if err := listing.Pagination.Next.validate(); err != nil {
+			return fmt.Errorf("%s pagination: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (selector Selector) validate() error {
+	count := 0
+	for _, query := range []string{selector.CSS, selector.XPath, selector.JSONPath} {
+		if query != "" {
+			count++
+		}
+	}
+
+	// An empty selector reads the item itself
+	if count > 1 {
+		return fmt.Errorf("use only one of css, xpath and jsonpath")
+	}
+
+	if selector.Regex != "" {
+		if _, err := compileRegex(selector.Regex); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,230 @@
+package Local
+
+import (
+	"archive/zip"
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/golang/glog"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// API Imports manga from a local folder
+// Every folder directly inside Root is a series, holding CBZ/ZIP archives, folders of images,
+// or volume folders of either. ComicInfo.xml files are used for metadata when present
+type API struct {
+	Root string
+}
+
+// ListSeries Returns the ids of every series folder in the root
+func (api API) ListSeries() ([]string, error) {
+	entries, err := os.ReadDir(api.Root)
+	if err != nil {
+		err = fmt.Errorf("Failed to read import folder: %w", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	series := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			series = append(series, entry.Name())
+		}
+	}
+
+	sortNatural(series)
+	return series, nil
+}
+
+// SearchManga Finds the series folder matching a title, exact matches (ignoring case) win
+func (api API) SearchManga(title string) (Models.Manga, error) {
+	series, err := api.ListSeries()
+	if err != nil {
+		return Models.Manga{}, err
+	}
+
+	match := ""
+	for _, id := range series {
+		if strings.EqualFold(id, title) {
+			match = id
+			break
+		}
+		if match == "" && strings.Contains(strings.ToLower(id), strings.ToLower(title)) {
+			match = id
+		}
+	}
+
+	if match == "" {
+		err := fmt.Errorf("No manga found for %s", title)
+		glog.Info(err)
+		return Models.Manga{}, err
+	}
+
+	return api.FetchManga(match)
+}
+
+// FetchManga Reads a series folder, taking metadata from the first ComicInfo.xml found
+func (api API) FetchManga(id string) (Models.Manga, error) {
+	dir, err := api.path(id)
+	if err != nil {
+		return Models.Manga{}, err
+	}
+
+	if stat, err := os.Stat(dir); err != nil || !stat.IsDir() {
+		err = fmt.Errorf("Series folder %s not found", id)
+		glog.Info(err)
+		return Models.Manga{}, err
+	}
+
+	manga := Models.Manga{
+		ID:          id,
+		Name:        id,
+		APIProvider: api.GetProvider(),
+	}
+
+	sources, err := api.scan(id)
+	if err != nil {
+		return Models.Manga{}, err
+	}
+
+	// Prefer a ComicInfo.xml next to the chapters, then the one of the first chapter that has one
+	if info := readComicInfo(dir); info != nil {
+		applyComicInfo(&manga, info)
+		return manga, nil
+	}
+	for _, source := range sources {
+		if source.info != nil {
+			applyComicInfo(&manga, source.info)
+			break
+		}
+	}
+
+	return manga, nil
+}
+
+// FetchChapters Lists the chapters found in a series folder
+// Chapter ids are the paths of their archive or folder, relative to the root
+func (api API) FetchChapters(id string) ([]Models.Chapter, error) {
+	sources, err := api.scan(id)
+	if err != nil {
+		return nil, err
+	}
+
+	chapters := make([]Models.Chapter, len(sources))
+	for i, source := range sources {
+		chapters[i] = source.chapter(i + 1)
+	}
+
+	return chapters, nil
+}
+
+// FetchChapterDownload Returns the chapter path and the names of its page images in reading order
+func (api API) FetchChapterDownload(id string, datasaver bool) (string, []string, error) {
+	path, err := api.path(id)
+	if err != nil {
+		return "", nil, err
+	}
+
+	pages, err := listPages(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return id, pages, nil
+}
+
+// FetchPage Opens a page of a chapter, from inside its archive or its folder
+func (api API) FetchPage(id string, name string) (io.ReadCloser, error) {
+	path, err := api.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isArchive(path) {
+		file, err := os.Open(filepath.Join(path, filepath.Base(name)))
+		if err != nil {
+			err = fmt.Errorf("Failed to open page %s: %w", name, err)
+			glog.Error(err)
+			return nil, err
+		}
+		return file, nil
+	}
+
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		err = fmt.Errorf("Failed to open archive %s: %w", id, err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	for _, file := range archive.File {
+		if file.Name != name {
+			continue
+		}
+
+		page, err := file.Open()
+		if err != nil {
+			archive.Close()
+			err = fmt.Errorf("Failed to open page %s: %w", name, err)
+			glog.Error(err)
+			return nil, err
+		}
+		return archivePage{page, archive}, nil
+	}
+
+	archive.Close()
+	err = fmt.Errorf("Page %s not found in %s", name, id)
+	glog.Error(err)
+	return nil, err
+}
+
+// FetchCovers Local series have no covers to fetch
+func (API) FetchCovers(id string) ([]Models.Cover, error) {
+	return []Models.Cover{}, nil
+}
+
+// PageHash Local files carry no hash to check against
+func (API) PageHash(filename string) string {
+	return ""
+}
+
+func (API) GetProvider() string {
+	return "local"
+}
+
+// Capabilities Rescanning a folder picks up new chapters, pages come as they are on disk
+func (API) Capabilities() Models.Capabilities {
+	return Models.Capabilities{
+		Search:    true,
+		Feed:      true,
+		Languages: []string{},
+	}
+}
+
+// path Resolves an id to a path inside the root, refusing ids that leave it
+func (api API) path(id string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(id))
+	if clean == "." || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		err := fmt.Errorf("Invalid local path %s", id)
+		glog.Info(err)
+		return "", err
+	}
+
+	return filepath.Join(api.Root, clean), nil
+}
+
+// archivePage Closes the archive along with the page read from it
+type archivePage struct {
+	io.ReadCloser
+	archive *zip.ReadCloser
+}
+
+func (page archivePage) Close() error {
+	err := page.ReadCloser.Close()
+	if closeErr := page.archive.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
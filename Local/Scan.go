@@ -0,0 +1,345 @@
+package Local
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/golang/glog"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var imageExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true}
+
+var (
+	volumePattern  = regexp.MustCompile(`(?i)(?:^|[^a-z])(?:v|vol\.?|volume)\s*(\d+(?:\.\d+)?)`)
+	chapterPattern = regexp.MustCompile(`(?i)(?:^|[^a-z])(?:c|ch\.?|chapter)\s*(\d+(?:\.\d+)?)`)
+	numberPattern  = regexp.MustCompile(`^\d+(?:\.\d+)?$`)
+	digitsPattern  = regexp.MustCompile(`\d+|\D+`)
+)
+
+// A chapter found on disk, either an archive or a folder of images
+type source struct {
+	id     string // Path relative to the root, slash separated
+	name   string // File or folder name without extension
+	volume string // Name of the volume folder holding it, if any
+	pages  int
+	info   *Models.ComicInfo
+}
+
+// scan Lists the chapters of a series folder in natural order
+// Images directly inside the series folder make up a single chapter
+func (api API) scan(id string) ([]source, error) {
+	dir, err := api.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := readDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := []source{}
+	loose := 0
+	for _, name := range names {
+		full := filepath.Join(dir, name)
+		rel := path.Join(id, name)
+
+		stat, err := os.Stat(full)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case stat.IsDir():
+			// A folder of images is a chapter, anything else is a volume folder
+			if chapter, ok := newSource(full, rel, ""); ok {
+				sources = append(sources, chapter)
+				continue
+			}
+
+			inner, err := readDir(full)
+			if err != nil {
+				return nil, err
+			}
+			for _, innerName := range inner {
+				if chapter, ok := newSource(filepath.Join(full, innerName), path.Join(rel, innerName), name); ok {
+					sources = append(sources, chapter)
+				}
+			}
+		case isArchive(name):
+			if chapter, ok := newSource(full, rel, ""); ok {
+				sources = append(sources, chapter)
+			}
+		case isImage(name):
+			loose++
+		}
+	}
+
+	if loose > 0 {
+		oneshot := source{id: id, name: id, pages: loose, info: readComicInfo(dir)}
+		sources = append([]source{oneshot}, sources...)
+	}
+
+	return sources, nil
+}
+
+// newSource Reads an archive or folder of images as a chapter
+// Returns false if it holds no pages
+func newSource(full string, rel string, volume string) (source, bool) {
+	stat, err := os.Stat(full)
+	if err != nil || (!stat.IsDir() && !isArchive(full)) {
+		return source{}, false
+	}
+
+	pages, err := listPages(full)
+	if err != nil || len(pages) == 0 {
+		return source{}, false
+	}
+
+	name := filepath.Base(full)
+	if !stat.IsDir() {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+
+	return source{
+		id:     rel,
+		name:   name,
+		volume: volume,
+		pages:  len(pages),
+		info:   readComicInfo(full),
+	}, true
+}
+
+// chapter Converts a source to a chapter, numbered by its position if nothing else names it
+func (source source) chapter(position int) Models.Chapter {
+	chapter := Models.Chapter{
+		ID:         source.id,
+		PageNumber: source.pages,
+		Pages:      make([]Models.Page, source.pages),
+	}
+
+	volume := ""
+	number := ""
+	if source.info != nil {
+		chapter.Title = source.info.Title
+		chapter.TranslatedLanguage = source.info.LanguageISO
+		number = source.info.Number
+		if source.info.Volume > 0 {
+			volume = strconv.Itoa(source.info.Volume)
+		}
+	}
+
+	if volume == "" {
+		volume = match(volumePattern, source.name)
+	}
+	if volume == "" && source.volume != "" {
+		volume = match(volumePattern, source.volume)
+		if volume == "" && numberPattern.MatchString(source.volume) {
+			volume = source.volume
+		}
+	}
+
+	if number == "" {
+		number = match(chapterPattern, source.name)
+	}
+	if number == "" && numberPattern.MatchString(source.name) {
+		number = source.name
+	}
+	if number == "" {
+		number = strconv.Itoa(position)
+	}
+
+	chapter.Volume = Config.EMPTY_VOLUME_NAME
+	if volume != "" {
+		chapter.Volume = "Volume " + trimNumber(volume)
+	}
+	chapter.Chapter = "Chapter " + trimNumber(number)
+
+	return chapter
+}
+
+// applyComicInfo Copies the series metadata of a ComicInfo.xml onto a manga
+func applyComicInfo(manga *Models.Manga, info *Models.ComicInfo) {
+	if info.Series != "" {
+		manga.Name = info.Series
+	}
+	manga.Description = info.Summary
+	manga.Year = info.Year
+
+	if strings.Contains(info.AgeRating, "18") {
+		manga.ContentRating = "erotica"
+	}
+
+	for _, name := range splitList(info.Writer) {
+		manga.Authors = append(manga.Authors, Models.Person{ProviderID: "local:" + strings.ToLower(name), Name: name})
+	}
+	for _, name := range splitList(info.Penciller) {
+		manga.Artists = append(manga.Artists, Models.Person{ProviderID: "local:" + strings.ToLower(name), Name: name})
+	}
+	for _, name := range splitList(info.Genre) {
+		manga.Tags = append(manga.Tags, Models.Tag{ProviderID: "local:" + strings.ToLower(name), Name: name, Group: "genre"})
+	}
+}
+
+// listPages Returns the names of the images in an archive or folder, in natural order
+func listPages(full string) ([]string, error) {
+	pages := []string{}
+
+	if isArchive(full) {
+		archive, err := zip.OpenReader(full)
+		if err != nil {
+			err = fmt.Errorf("Failed to open archive %s: %w", full, err)
+			glog.Error(err)
+			return nil, err
+		}
+		defer archive.Close()
+
+		for _, file := range archive.File {
+			if !file.FileInfo().IsDir() && isImage(file.Name) && !strings.HasPrefix(path.Base(file.Name), ".") {
+				pages = append(pages, file.Name)
+			}
+		}
+	} else {
+		names, err := readDir(full)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range names {
+			if isImage(name) {
+				pages = append(pages, name)
+			}
+		}
+	}
+
+	sortNatural(pages)
+	return pages, nil
+}
+
+// readComicInfo Reads the ComicInfo.xml of an archive or folder, nil if there is none
+func readComicInfo(full string) *Models.ComicInfo {
+	var content io.ReadCloser
+
+	if isArchive(full) {
+		archive, err := zip.OpenReader(full)
+		if err != nil {
+			return nil
+		}
+		defer archive.Close()
+
+		for _, file := range archive.File {
+			if strings.EqualFold(path.Base(file.Name), "ComicInfo.xml") {
+				content, err = file.Open()
+				if err != nil {
+					return nil
+				}
+				break
+			}
+		}
+	} else if file, err := os.Open(filepath.Join(full, "ComicInfo.xml")); err == nil {
+		content = file
+	}
+
+	if content == nil {
+		return nil
+	}
+	defer content.Close()
+
+	var info Models.ComicInfo
+	if err := xml.NewDecoder(content).Decode(&info); err != nil {
+		glog.Warning("Ignoring invalid ComicInfo.xml in ", full, ": ", err)
+		return nil
+	}
+
+	return &info
+}
+
+// readDir Returns the names in a folder, skipping hidden files, in natural order
+func readDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		err = fmt.Errorf("Failed to read folder %s: %w", dir, err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, entry.Name())
+		}
+	}
+
+	sortNatural(names)
+	return names, nil
+}
+
+func isArchive(name string) bool {
+	extension := strings.ToLower(filepath.Ext(name))
+	return extension == ".cbz" || extension == ".zip"
+}
+
+func isImage(name string) bool {
+	return imageExtensions[strings.ToLower(path.Ext(name))]
+}
+
+// match Returns the first group of a pattern in a name, or ""
+func match(pattern *regexp.Regexp, name string) string {
+	if groups := pattern.FindStringSubmatch(name); groups != nil {
+		return groups[1]
+	}
+	return ""
+}
+
+// trimNumber Drops leading zeros, "007" becomes "7"
+func trimNumber(number string) string {
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return number
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// splitList Splits a comma separated ComicInfo field
+func splitList(list string) []string {
+	values := []string{}
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// sortNatural Sorts names so embedded numbers compare by value, "2.jpg" before "10.jpg"
+func sortNatural(names []string) {
+	sort.SliceStable(names, func(i, j int) bool {
+		a := digitsPattern.FindAllString(strings.ToLower(names[i]), -1)
+		b := digitsPattern.FindAllString(strings.ToLower(names[j]), -1)
+
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] == b[k] {
+				continue
+			}
+
+			numberA, errA := strconv.Atoi(a[k])
+			numberB, errB := strconv.Atoi(b[k])
+			if errA == nil && errB == nil && numberA != numberB {
+				return numberA < numberB
+			}
+			return a[k] < b[k]
+		}
+
+		return len(a) < len(b)
+	})
+}
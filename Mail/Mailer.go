@@ -0,0 +1,107 @@
+package Mail
+
+import (
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/golang/glog"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers the emails sent to accounts, like verification and password reset
+type Mailer interface {
+	Send(message Message) error
+}
+
+// Default Gets the mailer set up in the config, SMTP if a host is set and files otherwise
+func Default() Mailer {
+	if Config.MAIL_SMTP_HOST == "" {
+		return File{Dir: Config.MAIL_PATH}
+	}
+
+	return SMTP{
+		Host:     Config.MAIL_SMTP_HOST,
+		Port:     Config.MAIL_SMTP_PORT,
+		Username: Config.MAIL_SMTP_USERNAME,
+		Password: os.Getenv(Config.MAIL_SMTP_PASSWORD_ENV),
+		From:     Config.MAIL_FROM,
+	}
+}
+
+// format Turns a message into the text of an email
+func format(from string, message Message) []byte {
+	var text strings.Builder
+	fmt.Fprintf(&text, "From: %s\r\n", from)
+	fmt.Fprintf(&text, "To: %s\r\n", message.To)
+	fmt.Fprintf(&text, "Subject: %s\r\n", message.Subject)
+	fmt.Fprintf(&text, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	text.WriteString("MIME-Version: 1.0\r\n")
+	text.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	text.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+
+	return []byte(text.String())
+}
+
+// SMTP Sends emails through an SMTP server, with STARTTLS when the server offers it
+type SMTP struct {
+	Host     string
+	Port     string
+	Username string // No authentication if empty
+	Password string
+	From     string
+}
+
+func (mailer SMTP) Send(message Message) error {
+	var auth smtp.Auth
+	if mailer.Username != "" {
+		auth = smtp.PlainAuth("", mailer.Username, mailer.Password, mailer.Host)
+	}
+
+	err := smtp.SendMail(mailer.Host+":"+mailer.Port, auth, mailer.From, []string{message.To}, format(mailer.From, message))
+	if err != nil {
+		err = fmt.Errorf("Failed to send email to %s: %v", message.To, err)
+		glog.Error(err)
+		return err
+	}
+
+	glog.Info("Sent email \"", message.Subject, "\" to ", message.To)
+	return nil
+}
+
+// File Writes emails to files instead of sending them, for local testing
+// Only the recipient and subject are logged, the bodies hold tokens that log in or reset passwords
+type File struct {
+	Dir string // Nothing is written if empty
+}
+
+func (mailer File) Send(message Message) error {
+	glog.Info("Email \"", message.Subject, "\" to ", message.To)
+	if mailer.Dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(mailer.Dir, 0755); err != nil {
+		err = fmt.Errorf("Failed to create the mail folder: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.ReplaceAll(message.To, "/", "_"))
+	if err := os.WriteFile(filepath.Join(mailer.Dir, name), format(Config.MAIL_FROM, message), 0600); err != nil {
+		err = fmt.Errorf("Failed to write email: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
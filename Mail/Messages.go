@@ -0,0 +1,51 @@
+package Mail
+
+import (
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Config"
+	"time"
+)
+
+// Verification Gets the email asking an account to confirm its address
+func Verification(username string, email string, token string, expiresIn time.Duration) Message {
+	return Message{
+		To:      email,
+		Subject: "Confirm your mangascribe email",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Open this link to confirm %s is your email address:\n\n"+
+			"%s/v1/accounts/verify?token=%s\n\n"+
+			"The link expires in %s. If you did not make a mangascribe account, you can ignore this email.\n",
+			username, email, Config.PUBLIC_URL, token, describe(expiresIn)),
+	}
+}
+
+// PasswordReset Gets the email with the token to reset the password of an account
+func PasswordReset(username string, email string, token string, expiresIn time.Duration) Message {
+	return Message{
+		To:      email,
+		Subject: "Reset your mangascribe password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone asked to reset the password of your mangascribe account. To pick a new password, send this token:\n\n"+
+			"%s\n\n"+
+			"with your new password to %s/v1/password/reset\n\n"+
+			"The token expires in %s and can only be used once. If you did not ask for this, you can ignore this email.\n",
+			username, token, Config.PUBLIC_URL, describe(expiresIn)),
+	}
+}
+
+// describe Writes a duration in words, like "24 hours" or "30 minutes"
+func describe(duration time.Duration) string {
+	if duration >= time.Hour && duration%time.Hour == 0 {
+		return plural(int(duration/time.Hour), "hour")
+	}
+
+	return plural(int(duration/time.Minute), "minute")
+}
+
+func plural(count int, unit string) string {
+	if count == 1 {
+		return fmt.Sprintf("1 %s", unit)
+	}
+
+	return fmt.Sprintf("%d %ss", count, unit)
+}
@@ -0,0 +1,301 @@
+package MangaDex
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/Tools"
+	"github.com/golang/glog"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Endpoints are the MangaDex servers a Client talks to, a local fake can be swapped in for testing
+type Endpoints struct {
+	API  string
+	Auth string // OAuth2 token endpoint
+}
+
+var DefaultEndpoints = Endpoints{
+	API:  Config.API,
+	Auth: Config.MANGADEX_AUTH_URL,
+}
+
+// Client Calls the endpoints of a linked MangaDex account
+// Tokens are refreshed in place on the link, save it after using the client
+type Client struct {
+	Endpoints Endpoints
+	Link      *Models.MangaDexLink
+}
+
+// Reading statuses of MangaDex and the category they are imported into
+var statusCategories = map[string]string{
+	"reading":      "Reading",
+	"on_hold":      "On Hold",
+	"plan_to_read": "Plan to Read",
+	"dropped":      "Dropped",
+	"re_reading":   "Re-reading",
+	"completed":    "Completed",
+}
+
+// Leeway before the expiry of an access token at which it gets refreshed
+const tokenLeeway = 30 * time.Second
+
+// Largest number of manga ids sent in a single request
+const idsPerRequest = 100
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type statusResponse struct {
+	Result   string            `json:"result"`
+	Statuses map[string]string `json:"statuses"`
+}
+
+type readMarkersResponse struct {
+	Result string              `json:"result"`
+	Data   map[string][]string `json:"data"`
+}
+
+func NewClient(endpoints Endpoints, link *Models.MangaDexLink) *Client {
+	return &Client{Endpoints: endpoints, Link: link}
+}
+
+// StatusCategory Gets the category a MangaDex reading status is imported into
+func StatusCategory(status string) (string, bool) {
+	category, exists := statusCategories[status]
+	return category, exists
+}
+
+// Login Gets tokens for the link with the password grant of a personal API client
+func (client *Client) Login(password string) error {
+	return client.requestToken(url.Values{
+		"grant_type": {"password"},
+		"username":   {client.Link.Username},
+		"password":   {password},
+	})
+}
+
+// requestToken Asks the token endpoint for new tokens and stores them on the link
+func (client *Client) requestToken(form url.Values) error {
+	form.Set("client_id", client.Link.ClientID)
+	form.Set("client_secret", client.Link.ClientSecret)
+
+	body, err := Tools.RequestPOST(client.Endpoints.Auth, "application/x-www-form-urlencoded", []byte(form.Encode()), nil)
+
+	var token tokenResponse
+	if jsonErr := json.Unmarshal(body, &token); jsonErr != nil && err == nil {
+		err = jsonErr
+	}
+	if token.ErrorDescription != "" {
+		err = errors.New(token.ErrorDescription)
+	}
+	if err == nil && token.AccessToken == "" {
+		err = errors.New("No access token returned")
+	}
+	if err != nil {
+		err = fmt.Errorf("Failed to log in to MangaDex: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	client.Link.AccessToken = token.AccessToken
+	if token.RefreshToken != "" {
+		client.Link.RefreshToken = token.RefreshToken
+	}
+	client.Link.ExpiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+
+	return nil
+}
+
+// authorization Gets the Authorization header, refreshing the access token when it is about to expire
+func (client *Client) authorization() (map[string]string, error) {
+	if time.Now().Add(tokenLeeway).After(client.Link.ExpiresAt) {
+		err := client.requestToken(url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {client.Link.RefreshToken},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("MangaDex session expired, link the account again: %v", err)
+		}
+	}
+
+	return map[string]string{"Authorization": "Bearer " + client.Link.AccessToken}, nil
+}
+
+// get Sends an authenticated GET request and parses the JSON response into output
+func (client *Client) get(fullURL string, args map[string]string, output any) error {
+	headers, err := client.authorization()
+	if err != nil {
+		return err
+	}
+
+	body, err := Tools.RequestGETHeaders(fullURL, args, headers)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(body, output); err != nil {
+		err = fmt.Errorf("Failed to parse MangaDex response: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Follows Fetches every manga the account follows, with their metadata
+func (client *Client) Follows() ([]Models.Manga, error) {
+	fullURL := fmt.Sprintf("%s/user/follows/manga%s", client.Endpoints.API, mangaIncludes)
+
+	output := []Models.Manga{}
+	for {
+		var follows searchMangaStruct
+		err := client.get(fullURL, map[string]string{
+			"limit":  strconv.Itoa(idsPerRequest),
+			"offset": strconv.Itoa(len(output)),
+		}, &follows)
+		if err != nil {
+			return nil, err
+		}
+
+		if follows.Result == "error" {
+			err := errors.New(follows.Response)
+			glog.Error("Mangadex returned an error when fetching follows: ", err)
+			return nil, err
+		}
+
+		for _, data := range follows.Data {
+			output = append(output, toManga(data))
+		}
+
+		if len(follows.Data) == 0 || len(output) >= follows.Total {
+			break
+		}
+	}
+
+	glog.Info("Found ", len(output), " followed manga")
+	return output, nil
+}
+
+// ReadingStatuses Fetches the reading status of every manga the account set one on, by manga id
+func (client *Client) ReadingStatuses() (map[string]string, error) {
+	var statuses statusResponse
+	if err := client.get(client.Endpoints.API+"/manga/status", nil, &statuses); err != nil {
+		return nil, err
+	}
+
+	if statuses.Result != "ok" {
+		err := fmt.Errorf("Mangadex returned an error when fetching reading statuses")
+		glog.Error(err)
+		return nil, err
+	}
+
+	return statuses.Statuses, nil
+}
+
+// ReadMarkers Fetches the ids of the chapters read in each of the given manga, by manga id
+func (client *Client) ReadMarkers(mangaIDs []string) (map[string][]string, error) {
+	output := make(map[string][]string)
+	for start := 0; start < len(mangaIDs); start += idsPerRequest {
+		end := start + idsPerRequest
+		if end > len(mangaIDs) {
+			end = len(mangaIDs)
+		}
+
+		// ids[] is repeated, so it goes in the URL instead of the args
+		query := url.Values{"ids[]": mangaIDs[start:end], "grouped": {"true"}}
+		fullURL := client.Endpoints.API + "/manga/read?" + query.Encode()
+
+		var markers readMarkersResponse
+		if err := client.get(fullURL, nil, &markers); err != nil {
+			return nil, err
+		}
+
+		if markers.Result != "ok" {
+			err := fmt.Errorf("Mangadex returned an error when fetching read markers")
+			glog.Error(err)
+			return nil, err
+		}
+
+		for mangaID, chapters := range markers.Data {
+			output[mangaID] = chapters
+		}
+	}
+
+	return output, nil
+}
+
+// MarkRead Sets the read markers of chapters of a manga
+func (client *Client) MarkRead(mangaID string, read []string, unread []string) error {
+	headers, err := client.authorization()
+	if err != nil {
+		return err
+	}
+
+	// MangaDex rejects null lists
+	if read == nil {
+		read = []string{}
+	}
+	if unread == nil {
+		unread = []string{}
+	}
+
+	body, err := json.Marshal(map[string][]string{
+		"chapterIdsRead":   read,
+		"chapterIdsUnread": unread,
+	})
+	if err != nil {
+		return err
+	}
+
+	fullURL := fmt.Sprintf("%s/manga/%s/read", client.Endpoints.API, mangaID)
+	if _, err := Tools.RequestPOST(fullURL, "application/json", body, headers); err != nil {
+		err = fmt.Errorf("Failed to push read markers to MangaDex: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	glog.Info("Pushed ", len(read), " read and ", len(unread), " unread markers of ", mangaID, " to MangaDex")
+	return nil
+}
+
+// ReadProgress Turns the MangaDex read markers of a manga into reading progress on its chapters
+// A marker on a chapter that was not sorted into a volume also marks the volume chapter with the same number
+func ReadProgress(manga *Models.Manga, chapterIDs []string) []Models.ReadProgress {
+	read := make(map[string]bool)
+	for _, id := range chapterIDs {
+		read[id] = true
+	}
+
+	numbers := make(map[string]bool)
+	for _, chapter := range manga.Chapters {
+		if read[chapter.ID] {
+			numbers[chapter.Chapter] = true
+		}
+	}
+
+	progress := []Models.ReadProgress{}
+	for _, chapter := range manga.Chapters {
+		if !read[chapter.ID] && !(chapter.VolumeID != 0 && numbers[chapter.Chapter]) {
+			continue
+		}
+
+		progress = append(progress, Models.ReadProgress{
+			ChapterID: chapter.ChapterID,
+			MangaID:   chapter.MangaID,
+			LastPage:  chapter.PageNumber,
+			Read:      true,
+		})
+	}
+
+	return progress
+}
@@ -0,0 +1,135 @@
+package MangaDex
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/CookieUzen/mangascribe/Models"
+)
+
+// loggedIn Starts a fake and logs a client in to it
+func loggedIn(t *testing.T) (*Fake, *Client) {
+	t.Helper()
+
+	fake := NewFake()
+	t.Cleanup(fake.Server.Close)
+
+	link := &Models.MangaDexLink{Username: fake.Username, ClientID: fake.ClientID, ClientSecret: fake.ClientSecret}
+	client := NewClient(fake.Endpoints(), link)
+	if err := client.Login(fake.Password); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	return fake, client
+}
+
+func TestLogin(t *testing.T) {
+	fake, client := loggedIn(t)
+
+	if client.Link.AccessToken != "access-1" || client.Link.RefreshToken != "refresh-1" {
+		t.Errorf("got tokens %q %q", client.Link.AccessToken, client.Link.RefreshToken)
+	}
+	if time.Until(client.Link.ExpiresAt) < 10*time.Minute {
+		t.Errorf("got expiry %v, want the token lifetime from now", client.Link.ExpiresAt)
+	}
+	if fake.Logins != 1 {
+		t.Errorf("got %d logins, want 1", fake.Logins)
+	}
+}
+
+func TestLoginWrongPassword(t *testing.T) {
+	fake := NewFake()
+	defer fake.Server.Close()
+
+	link := &Models.MangaDexLink{Username: fake.Username, ClientID: fake.ClientID, ClientSecret: fake.ClientSecret}
+	err := NewClient(fake.Endpoints(), link).Login("wrong password")
+	if err == nil {
+		t.Fatal("logged in with a wrong password")
+	}
+	if link.AccessToken != "" {
+		t.Errorf("kept access token %q from a failed login", link.AccessToken)
+	}
+}
+
+func TestRefreshExpiredToken(t *testing.T) {
+	fake, client := loggedIn(t)
+	client.Link.ExpiresAt = time.Now().Add(-time.Minute)
+
+	if _, err := client.ReadingStatuses(); err != nil {
+		t.Fatalf("ReadingStatuses: %v", err)
+	}
+
+	if fake.Refreshes != 1 {
+		t.Errorf("got %d refreshes, want 1", fake.Refreshes)
+	}
+	if client.Link.AccessToken != "access-2" || client.Link.RefreshToken != "refresh-2" {
+		t.Errorf("got tokens %q %q, want the refreshed ones", client.Link.AccessToken, client.Link.RefreshToken)
+	}
+}
+
+func TestFollowsPages(t *testing.T) {
+	fake, client := loggedIn(t)
+
+	// More than one page of idsPerRequest
+	for i := 0; i < idsPerRequest+20; i++ {
+		fake.Follows = append(fake.Follows, FakeManga{ID: fmt.Sprintf("manga-%03d", i), Title: fmt.Sprintf("Manga %d", i)})
+	}
+
+	follows, err := client.Follows()
+	if err != nil {
+		t.Fatalf("Follows: %v", err)
+	}
+
+	if len(follows) != len(fake.Follows) {
+		t.Fatalf("got %d follows, want %d", len(follows), len(fake.Follows))
+	}
+	for i, manga := range follows {
+		if manga.ID != fake.Follows[i].ID || manga.Name != fake.Follows[i].Title {
+			t.Errorf("follow %d: got %q %q, want %q %q", i, manga.ID, manga.Name, fake.Follows[i].ID, fake.Follows[i].Title)
+		}
+	}
+}
+
+func TestStatusesAndReadMarkers(t *testing.T) {
+	fake, client := loggedIn(t)
+	fake.Follows = []FakeManga{
+		{ID: "a", Title: "A", Status: "reading", Read: []string{"a1", "a2"}},
+		{ID: "b", Title: "B", Status: "plan_to_read"},
+		{ID: "c", Title: "C", Read: []string{"c1"}},
+	}
+
+	statuses, err := client.ReadingStatuses()
+	if err != nil {
+		t.Fatalf("ReadingStatuses: %v", err)
+	}
+	if len(statuses) != 2 || statuses["a"] != "reading" || statuses["b"] != "plan_to_read" {
+		t.Errorf("got statuses %v", statuses)
+	}
+
+	markers, err := client.ReadMarkers([]string{"a", "c"})
+	if err != nil {
+		t.Fatalf("ReadMarkers: %v", err)
+	}
+	sort.Strings(markers["a"])
+	if len(markers) != 2 || len(markers["a"]) != 2 || markers["a"][1] != "a2" || len(markers["c"]) != 1 {
+		t.Errorf("got read markers %v", markers)
+	}
+}
+
+func TestMarkRead(t *testing.T) {
+	fake, client := loggedIn(t)
+
+	if err := client.MarkRead("a", []string{"a1"}, nil); err != nil {
+		t.Fatalf("MarkRead: %v", err)
+	}
+
+	marked := fake.Marked["a"]
+	if len(marked["chapterIdsRead"]) != 1 || marked["chapterIdsRead"][0] != "a1" {
+		t.Errorf("got read %v", marked["chapterIdsRead"])
+	}
+	if unread, ok := marked["chapterIdsUnread"]; !ok || len(unread) != 0 {
+		t.Errorf("got unread %v, want an empty list", unread)
+	}
+}
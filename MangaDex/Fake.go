@@ -0,0 +1,206 @@
+package MangaDex
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FakeManga A followed manga served by a Fake
+type FakeManga struct {
+	ID     string
+	Title  string
+	Status string   // Reading status of the account, none if empty
+	Read   []string // Ids of the chapters the account read
+}
+
+// Fake A local stand-in for the MangaDex token endpoint and the account endpoints a Client uses, for tests
+// Logins use the password grant with Username, Password, ClientID and ClientSecret
+type Fake struct {
+	Server       *httptest.Server
+	Username     string
+	Password     string
+	ClientID     string
+	ClientSecret string
+	ExpiresIn    int // Lifetime of the access tokens in seconds
+	Follows      []FakeManga
+
+	mutex     sync.Mutex
+	tokens    int
+	access    string
+	refresh   string
+	Logins    int                            // Password grants accepted
+	Refreshes int                            // Refresh grants accepted
+	Marked    map[string]map[string][]string // Read markers pushed, by manga id then chapterIdsRead/chapterIdsUnread
+}
+
+// NewFake Starts a fake MangaDex, close its Server when done
+func NewFake() *Fake {
+	fake := &Fake{
+		Username:     "reader",
+		Password:     "correct horse",
+		ClientID:     "personal-client-reader",
+		ClientSecret: "secret",
+		ExpiresIn:    900,
+		Marked:       make(map[string]map[string][]string),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", fake.token)
+	mux.HandleFunc("/user/follows/manga", fake.authorized(fake.follows))
+	mux.HandleFunc("/manga/status", fake.authorized(fake.statuses))
+	mux.HandleFunc("/manga/read", fake.authorized(fake.readMarkers))
+	mux.HandleFunc("/manga/", fake.authorized(fake.markRead))
+	fake.Server = httptest.NewServer(mux)
+
+	return fake
+}
+
+// Endpoints Returns the endpoints to give a Client so it talks to the fake
+func (fake *Fake) Endpoints() Endpoints {
+	return Endpoints{API: fake.Server.URL, Auth: fake.Server.URL + "/token"}
+}
+
+// issue Creates a new pair of tokens and writes them as a token response
+func (fake *Fake) issue(w http.ResponseWriter) {
+	fake.tokens++
+	fake.access = fmt.Sprintf("access-%d", fake.tokens)
+	fake.refresh = fmt.Sprintf("refresh-%d", fake.tokens)
+
+	writeJSON(w, http.StatusOK, tokenResponse{AccessToken: fake.access, RefreshToken: fake.refresh, ExpiresIn: fake.ExpiresIn})
+}
+
+func (fake *Fake) token(w http.ResponseWriter, r *http.Request) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		writeJSON(w, http.StatusBadRequest, tokenResponse{Error: "invalid_request", ErrorDescription: "Invalid request"})
+		return
+	}
+	if r.PostForm.Get("client_id") != fake.ClientID || r.PostForm.Get("client_secret") != fake.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, tokenResponse{Error: "unauthorized_client", ErrorDescription: "Invalid client credentials"})
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "password":
+		if r.PostForm.Get("username") != fake.Username || r.PostForm.Get("password") != fake.Password {
+			writeJSON(w, http.StatusUnauthorized, tokenResponse{Error: "invalid_grant", ErrorDescription: "Invalid user credentials"})
+			return
+		}
+		fake.Logins++
+	case "refresh_token":
+		if fake.refresh == "" || r.PostForm.Get("refresh_token") != fake.refresh {
+			writeJSON(w, http.StatusBadRequest, tokenResponse{Error: "invalid_grant", ErrorDescription: "Token is not active"})
+			return
+		}
+		fake.Refreshes++
+	default:
+		writeJSON(w, http.StatusBadRequest, tokenResponse{Error: "unsupported_grant_type", ErrorDescription: "Unsupported grant type"})
+		return
+	}
+
+	fake.issue(w)
+}
+
+// authorized Only lets requests with the current access token through
+func (fake *Fake) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fake.mutex.Lock()
+		defer fake.mutex.Unlock()
+
+		if fake.access == "" || r.Header.Get("Authorization") != "Bearer "+fake.access {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"result": "error", "response": "Not logged in"})
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// follows Serves the followed manga a page at a time, like /user/follows/manga
+func (fake *Fake) follows(w http.ResponseWriter, r *http.Request) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 10
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+	data := []map[string]any{}
+	for i := offset; i < len(fake.Follows) && i < offset+limit; i++ {
+		manga := fake.Follows[i]
+		data = append(data, map[string]any{
+			"id":   manga.ID,
+			"type": "manga",
+			"attributes": map[string]any{
+				"title":  map[string]string{"en": manga.Title},
+				"status": "ongoing",
+			},
+			"relationships": []any{},
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"result": "ok",
+		"data":   data,
+		"limit":  limit,
+		"offset": offset,
+		"total":  len(fake.Follows),
+	})
+}
+
+func (fake *Fake) statuses(w http.ResponseWriter, r *http.Request) {
+	statuses := make(map[string]string)
+	for _, manga := range fake.Follows {
+		if manga.Status != "" {
+			statuses[manga.ID] = manga.Status
+		}
+	}
+
+	writeJSON(w, http.StatusOK, statusResponse{Result: "ok", Statuses: statuses})
+}
+
+func (fake *Fake) readMarkers(w http.ResponseWriter, r *http.Request) {
+	ids := make(map[string]bool)
+	for _, id := range r.URL.Query()["ids[]"] {
+		ids[id] = true
+	}
+
+	markers := make(map[string][]string)
+	for _, manga := range fake.Follows {
+		if ids[manga.ID] {
+			markers[manga.ID] = manga.Read
+		}
+	}
+
+	writeJSON(w, http.StatusOK, readMarkersResponse{Result: "ok", Data: markers})
+}
+
+// markRead Records the read markers pushed to /manga/{id}/read
+func (fake *Fake) markRead(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/manga/"), "/read")
+	if r.Method != http.MethodPost || id == "" || strings.Contains(id, "/") {
+		writeJSON(w, http.StatusNotFound, map[string]string{"result": "error"})
+		return
+	}
+
+	var body map[string][]string
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"result": "error"})
+		return
+	}
+	fake.Marked[id] = body
+
+	writeJSON(w, http.StatusOK, map[string]string{"result": "ok"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
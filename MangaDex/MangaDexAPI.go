@@ -9,19 +9,25 @@ import (
 	"github.com/CookieUzen/mangascribe/Tools"
 	"github.com/golang/glog"
 	"math"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type API struct{}
 
+// Relationships to expand when fetching a manga
+const mangaIncludes = "?includes[]=cover_art&includes[]=author&includes[]=artist"
+
 // Creates Manga struct from searching for a title in mangadex
 // TODO: Add support for searching for author
 // TODO: Add support for searching for tags
 // TODO: Add support for returning multiple results
 func (API) SearchManga(title string) (Models.Manga, error) {
 	// Loading in URL
-	fullURL := fmt.Sprintf("%s/manga", Config.API)
+	fullURL := fmt.Sprintf("%s/manga%s", Config.API, mangaIncludes)
 
 	// Send the request
 	glog.Info("Searching for manga: ", title)
@@ -41,15 +47,132 @@ func (API) SearchManga(title string) (Models.Manga, error) {
 		return Models.Manga{}, err
 	}
 
+	if len(outputManga.Data) == 0 {
+		err := fmt.Errorf("No manga found for %s", title)
+		glog.Info(err)
+		return Models.Manga{}, err
+	}
+
 	// Process the response into a Manga struct (get the first result)
-	var manga Models.Manga
+	return toManga(outputManga.Data[0]), nil
+}
+
+// FetchManga fetches the metadata of a manga by its mangadex id
+func (API) FetchManga(id string) (Models.Manga, error) {
+	fullURL := fmt.Sprintf("%s/manga/%s%s", Config.API, id, mangaIncludes)
+
+	glog.Info("Fetching manga: ", id)
+	body, err := Tools.RequestGET(fullURL, nil)
+	if err != nil {
+		glog.Error("Failed to send manga request:", err)
+		return Models.Manga{}, err
+	}
+
+	var outputManga getMangaStruct
+	if err := json.Unmarshal(body, &outputManga); err != nil {
+		glog.Error("Failed to parse response:", err)
+		return Models.Manga{}, err
+	}
+
+	if outputManga.Result == "error" {
+		err := errors.New(outputManga.Response)
+		glog.Error("Mangadex returned an error when fetching manga: ", err)
+		return Models.Manga{}, err
+	}
+
+	return toManga(outputManga.Data), nil
+}
+
+// toManga Converts a mangadex manga entity into a Manga struct with its metadata
+func toManga(data mangaStruct) Models.Manga {
+	attributes := data.Attributes
+
+	manga := Models.Manga{
+		ID:               data.ID,
+		Name:             localized(attributes.Title),
+		Description:      localized(attributes.Description),
+		Status:           attributes.Status,
+		Year:             attributes.Year,
+		Demographic:      attributes.PublicationDemographic,
+		ContentRating:    attributes.ContentRating,
+		OriginalLanguage: attributes.OriginalLanguage,
+		LastVolume:       attributes.LastVolume,
+		LastChapter:      attributes.LastChapter,
+		APIProvider:      API{}.GetProvider(),
+	}
 
-	manga.ID = outputManga.Data[0].ID
-	manga.Name = outputManga.Data[0].Attributes.Title["en"]
+	for _, altTitle := range attributes.AltTitles {
+		for language, title := range altTitle {
+			manga.AltTitles = append(manga.AltTitles, Models.AltTitle{
+				Language: language,
+				Title:    title,
+			})
+		}
+	}
+
+	// Fall back to an alternative title if there is no main one
+	if manga.Name == "" && len(manga.AltTitles) > 0 {
+		manga.Name = manga.AltTitles[0].Title
+	}
+
+	for _, tag := range attributes.Tags {
+		manga.Tags = append(manga.Tags, Models.Tag{
+			ProviderID: tag.ID,
+			Name:       localized(tag.Attributes.Name),
+			Group:      tag.Attributes.Group,
+		})
+	}
+
+	for site, value := range attributes.Links {
+		manga.Links = append(manga.Links, Models.Link{
+			Site:  site,
+			Value: value,
+		})
+	}
+
+	for _, relationship := range data.Relationships {
+		switch relationship.Type {
+		case "cover_art":
+			// Add the series cover
+			if relationship.Attributes.FileName != "" && len(manga.Covers) == 0 {
+				manga.Covers = append(manga.Covers, Models.Cover{
+					URL: coverURL(manga.ID, relationship.Attributes.FileName),
+				})
+			}
+		case "author":
+			manga.Authors = append(manga.Authors, Models.Person{
+				ProviderID: relationship.ID,
+				Name:       relationship.Attributes.Name,
+			})
+		case "artist":
+			manga.Artists = append(manga.Artists, Models.Person{
+				ProviderID: relationship.ID,
+				Name:       relationship.Attributes.Name,
+			})
+		}
+	}
+
+	return manga
+}
+
+// localized Picks the english entry of a localized string, or any entry if there is none
+func localized(values map[string]string) string {
+	if value, ok := values["en"]; ok {
+		return value
+	}
+
+	// Pick deterministically between the remaining languages
+	languages := make([]string, 0, len(values))
+	for language := range values {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
 
-	manga.APIProvider = "API"
+	if len(languages) == 0 {
+		return ""
+	}
 
-	return manga, nil
+	return values[languages[0]]
 }
 
 // fetchChapters fetches all the chapters for a given manga
@@ -206,6 +329,100 @@ func (API) FetchChapterDownload(id string, datasaver bool) (string, []string, er
 	return URL, linklist, nil
 }
 
+// FetchCovers fetches the covers of every volume of a manga
+// Only the first cover listed for each volume is returned
+func (API) FetchCovers(id string) ([]Models.Cover, error) {
+	fullURL := fmt.Sprintf("%s/cover", Config.API)
+
+	var output []Models.Cover
+	seen := make(map[string]bool)
+
+	for offset, total := 0, math.MaxInt; offset < total; {
+		body, err := Tools.RequestGET(fullURL, map[string]string{
+			"manga[]":       id,
+			"limit":         "100",
+			"offset":        strconv.Itoa(offset),
+			"order[volume]": "asc",
+		})
+		if err != nil {
+			glog.Error("Failed to send cover list request:", err)
+			return nil, err
+		}
+
+		var covers coverListStruct
+		if err := json.Unmarshal(body, &covers); err != nil {
+			glog.Error("Failed to parse response:", err)
+			return nil, err
+		}
+
+		if covers.Result == "error" {
+			err := errors.New(covers.Response)
+			glog.Error("Mangadex returned an error when fetching covers: ", err)
+			return nil, err
+		}
+
+		for _, cover := range covers.Data {
+			volume := cover.Attributes.Volume
+			if volume == "" || seen[volume] {
+				continue
+			}
+			seen[volume] = true
+
+			output = append(output, Models.Cover{
+				Volume: volume,
+				URL:    coverURL(id, cover.Attributes.FileName),
+			})
+		}
+
+		offset += len(covers.Data)
+		total = covers.Total
+		if len(covers.Data) == 0 {
+			break
+		}
+	}
+
+	return output, nil
+}
+
+// coverURL Builds the download URL of a cover file
+func coverURL(mangaID string, fileName string) string {
+	return fmt.Sprintf("%s/%s/%s", Config.COVER_URL, mangaID, fileName)
+}
+
+// PageHash extracts the SHA-256 hash embedded in a MangaDex page filename
+// Filenames look like "x1-<sha256>.png", returns an empty string if no hash is found
+func (API) PageHash(filename string) string {
+	name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+
+	// The hash comes after the last dash
+	index := strings.LastIndex(name, "-")
+	if index == -1 {
+		return ""
+	}
+	hash := name[index+1:]
+
+	// Make sure it actually looks like a hash
+	if len(hash) < 8 {
+		return ""
+	}
+	for _, c := range hash {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return ""
+		}
+	}
+
+	return hash
+}
+
 func (API) GetProvider() string {
-	return "API"
+	return "mangadex"
+}
+
+func (API) Capabilities() Models.Capabilities {
+	return Models.Capabilities{
+		Search:    true,
+		Feed:      true,
+		Datasaver: true,
+		Languages: []string{"en"},
+	}
 }
@@ -33,60 +33,73 @@ type MangaResponse struct {
 	Total    int                `json:"total"`
 }
 
-type searchMangaStruct struct {
-	Result   string `json:"result"`
-	Response string `json:"response"`
-	Data     []struct {
-		ID         string `json:"ID"`
-		Type       string `json:"type"`
-		Attributes struct {
-			Title                          map[string]string   `json:"title"`
-			AltTitles                      []map[string]string `json:"altTitles"`
-			Description                    map[string]string   `json:"description"`
-			IsLocked                       bool                `json:"isLocked"`
-			Links                          map[string]string   `json:"links"`
-			OriginalLanguage               string              `json:"originalLanguage"`
-			LastVolume                     string              `json:"lastVolume"`
-			LastChapter                    string              `json:"lastChapter"`
-			PublicationDemographic         string              `json:"publicationDemographic"`
-			Status                         string              `json:"status"`
-			Year                           int                 `json:"year"`
-			ContentRating                  string              `json:"contentRating"`
-			ChapterNumbersResetOnNewVolume bool                `json:"chapterNumbersResetOnNewVolume"`
-			LatestUploadedChapter          string              `json:"latestUploadedChapter"`
-			Tags                           []struct {
-				ID         string `json:"ID"`
-				Type       string `json:"type"`
-				Attributes struct {
-					Name        map[string]string `json:"Name"`
-					Description map[string]string `json:"description"`
-					Group       string            `json:"group"`
-					Version     int               `json:"version"`
-				} `json:"attributes"`
-				Relationships []struct {
-					ID         string `json:"ID"`
-					Type       string `json:"type"`
-					Related    string `json:"related"`
-					Attributes struct {
-					} `json:"attributes"`
-				} `json:"relationships"`
-			} `json:"tags"`
-			State     string `json:"state"`
-			Version   int    `json:"version"`
-			CreatedAt string `json:"createdAt"`
-			UpdatedAt string `json:"updatedAt"`
-		} `json:"attributes"`
-		Relationships []struct {
+type relationshipStruct struct {
+	ID         string `json:"ID"`
+	Type       string `json:"type"`
+	Related    string `json:"related"`
+	Attributes struct {
+		FileName string `json:"fileName"`
+		Volume   string `json:"volume"`
+		Name     string `json:"name"`
+	} `json:"attributes"`
+}
+
+type mangaStruct struct {
+	ID         string `json:"ID"`
+	Type       string `json:"type"`
+	Attributes struct {
+		Title                          map[string]string   `json:"title"`
+		AltTitles                      []map[string]string `json:"altTitles"`
+		Description                    map[string]string   `json:"description"`
+		IsLocked                       bool                `json:"isLocked"`
+		Links                          map[string]string   `json:"links"`
+		OriginalLanguage               string              `json:"originalLanguage"`
+		LastVolume                     string              `json:"lastVolume"`
+		LastChapter                    string              `json:"lastChapter"`
+		PublicationDemographic         string              `json:"publicationDemographic"`
+		Status                         string              `json:"status"`
+		Year                           int                 `json:"year"`
+		ContentRating                  string              `json:"contentRating"`
+		ChapterNumbersResetOnNewVolume bool                `json:"chapterNumbersResetOnNewVolume"`
+		LatestUploadedChapter          string              `json:"latestUploadedChapter"`
+		Tags                           []struct {
 			ID         string `json:"ID"`
 			Type       string `json:"type"`
-			Related    string `json:"related"`
 			Attributes struct {
+				Name        map[string]string `json:"Name"`
+				Description map[string]string `json:"description"`
+				Group       string            `json:"group"`
+				Version     int               `json:"version"`
 			} `json:"attributes"`
-		} `json:"relationships"`
-	} `json:"data"`
-	Limit  int `json:"limit"`
-	Offset int `json:"offset"`
-	Total  int `json:"total"`
+			Relationships []struct {
+				ID         string `json:"ID"`
+				Type       string `json:"type"`
+				Related    string `json:"related"`
+				Attributes struct {
+				} `json:"attributes"`
+			} `json:"relationships"`
+		} `json:"tags"`
+		State     string `json:"state"`
+		Version   int    `json:"version"`
+		CreatedAt string `json:"createdAt"`
+		UpdatedAt string `json:"updatedAt"`
+	} `json:"attributes"`
+	Relationships []relationshipStruct `json:"relationships"`
+}
+
+type searchMangaStruct struct {
+	Result   string        `json:"result"`
+	Response string        `json:"response"`
+	Data     []mangaStruct `json:"data"`
+	Limit    int           `json:"limit"`
+	Offset   int           `json:"offset"`
+	Total    int           `json:"total"`
+}
+
+type getMangaStruct struct {
+	Result   string      `json:"result"`
+	Response string      `json:"response"`
+	Data     mangaStruct `json:"data"`
 }
 
 type DownloadChapterRequest struct {
@@ -98,3 +111,20 @@ type DownloadChapterRequest struct {
 		DataSaver []string `json:"dataSaver"`
 	} `json:"chapter"`
 }
+
+type coverListStruct struct {
+	Result   string `json:"result"`
+	Response string `json:"response"`
+	Data     []struct {
+		ID         string `json:"ID"`
+		Type       string `json:"type"`
+		Attributes struct {
+			Volume   string `json:"volume"`
+			FileName string `json:"fileName"`
+			Locale   string `json:"locale"`
+		} `json:"attributes"`
+	} `json:"data"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+	Total  int `json:"total"`
+}
@@ -1,8 +1,28 @@
 package Models
 
+import "io"
+
 type APIProvider interface {
 	SearchManga(title string) (Manga, error)
+	FetchManga(id string) (Manga, error)
 	FetchChapters(id string) ([]Chapter, error)
 	FetchChapterDownload(id string, datasaver bool) (string, []string, error)
+	FetchCovers(id string) ([]Cover, error)
+	PageHash(filename string) string
 	GetProvider() string
+	Capabilities() Capabilities
+}
+
+// Capabilities describes what a provider supports
+type Capabilities struct {
+	Search    bool     // Can look up manga by title
+	Feed      bool     // Can list new chapters of a manga when syncing
+	Datasaver bool     // Offers lower quality pages
+	Languages []string // Chapter languages it fetches, empty for any
+}
+
+// PageFetcher is implemented by providers that read pages themselves instead of over HTTP
+// URL and link are the values returned by FetchChapterDownload
+type PageFetcher interface {
+	FetchPage(URL string, link string) (io.ReadCloser, error)
 }
@@ -4,21 +4,61 @@ import (
 	"gorm.io/gorm"
 	"time"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"github.com/golang/glog"
 	"fmt"
+	"strings"
 )
 
 type APIKey struct {
 	gorm.Model
 	ID			uint		`json:"id" gorm:"primaryKey"`
 	AccountID	uint		`json:"account_id"`
-	Key			string		`json:"key"`
+	Key			string		`json:"-" gorm:"-"`		// Plaintext, only set when the key is generated
+	Digest		string		`json:"-" gorm:"index"`	// Hex SHA-256 of the key
+	Prefix		string		`json:"prefix"`			// Start of the key, to tell keys apart
+	Label		string		`json:"label"`
+	Scopes		string		`json:"scopes"`			// Space separated, see AllScopes
 	ExpiresAt	time.Time	`json:"expires_at"`
+	LastUsedAt	*time.Time	`json:"last_used_at"`
+	SSOLogin	bool		`json:"-"`				// Created by a single sign-on login
+}
+
+// Number of characters of a key kept in plaintext as its prefix
+const APIKeyPrefixLength = 8
+
+// Scopes limit what an API key can be used for
+const (
+	ScopeLibraryRead	= "library:read"	// Browse the library, series, categories and jobs
+	ScopeLibraryWrite	= "library:write"	// Change the library, imports and linked accounts
+	ScopeDownloadsWrite	= "downloads:write"	// Add manga and queue downloads and exports
+	ScopeReader			= "reader"			// Read chapters, OPDS and reading progress
+	ScopeAdmin			= "admin"			// Manage the account and its API keys
+)
+
+// Every scope, the scopes of a key with full access
+var AllScopes = []string{ScopeLibraryRead, ScopeLibraryWrite, ScopeDownloadsWrite, ScopeReader, ScopeAdmin}
+
+type CreateAPIKeyRequest struct {
+	Label			string		`json:"label" binding:"max=100"`
+	ExpiresInDays	int			`json:"expires_in_days" binding:"min=0,max=365"` // Default expiration if 0
+	Scopes			[]string	`json:"scopes" binding:"omitempty,dive,oneof=library:read library:write downloads:write reader admin"` // Scopes of the key making the request if empty
+	OTP				string		`json:"otp"`	// TOTP or recovery code, needed if two-factor authentication is on
+}
+
+type RotateAPIKeyRequest struct {
+	OTP				string		`json:"otp"`	// TOTP or recovery code, needed if two-factor authentication is on
+}
+
+// Check if the key comes from a single sign-on login made within the window
+func (key *APIKey) FreshSSOLogin(window time.Duration) bool {
+	return key.SSOLogin && time.Since(key.CreatedAt) < window
 }
 
 // Generate a new API key
-func (account *Account) GenerateAPIKey(duration time.Duration) (*APIKey, error) {
+func (account *Account) GenerateAPIKey(label string, scopes []string, duration time.Duration) (*APIKey, error) {
 	bytes := make([]byte, 16) // 128-bit key
 	if _, err := rand.Read(bytes); err != nil {
 		error := fmt.Errorf("Error generating API key: %v", err)
@@ -26,21 +66,70 @@ func (account *Account) GenerateAPIKey(duration time.Duration) (*APIKey, error)
 		return nil, err
 	}
 
+	key := hex.EncodeToString(bytes)
 	return &APIKey{
-		Key:       hex.EncodeToString(bytes),
+		Key:       key,
+		Digest:    HashAPIKey(key),
+		Prefix:    key[:APIKeyPrefixLength],
+		Label:     label,
+		Scopes:    strings.Join(scopes, " "),
 		ExpiresAt: time.Now().Add(duration),
 	}, nil
 }
 
+// Get the scopes of an API key as a list
+func (key *APIKey) ScopeList() []string {
+	return strings.Fields(key.Scopes)
+}
+
+// Check if an API key has a scope
+func (key *APIKey) HasScope(scope string) bool {
+	for _, s := range key.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Get the digest an API key or account token is stored as
+func HashAPIKey(key string) string {
+	digest := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(digest[:])
+}
+
+// Check if a plaintext key is this API key, in constant time
+func (key *APIKey) Matches(plaintext string) bool {
+	return subtle.ConstantTimeCompare([]byte(key.Digest), []byte(HashAPIKey(plaintext))) == 1
+}
+
 // Check if an API key is expired
 func (key *APIKey) IsExpired() bool {
 	return key.ExpiresAt.Before(time.Now())
 }
 
+// Get how long an API key was issued for, so it can be rotated for the same duration
+func (key *APIKey) Lifetime() time.Duration {
+	return key.ExpiresAt.Sub(key.CreatedAt)
+}
+
 // Converts an API key to a JSON object
+// The key itself is only included right after it was generated
 func (key *APIKey) ToJSON() APIKeyJSON {
+	lastUsed := ""
+	if key.LastUsedAt != nil {
+		lastUsed = key.LastUsedAt.Format(time.RFC3339)
+	}
+
 	return APIKeyJSON{
+		ID:         key.ID,
 		Key:        key.Key,
+		Prefix:     key.Prefix,
+		Label:      key.Label,
+		Scopes:     key.ScopeList(),
 		Expiration: key.ExpiresAt.Format(time.RFC3339),
+		CreatedAt:  key.CreatedAt.Format(time.RFC3339),
+		LastUsedAt: lastUsed,
 	}
 }
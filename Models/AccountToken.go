@@ -0,0 +1,66 @@
+package Models
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"github.com/golang/glog"
+	"gorm.io/gorm"
+	"time"
+)
+
+// What an account token can be used for
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+)
+
+// AccountToken is a single use token sent to the email of an account
+// Only the digest is stored, like API keys
+type AccountToken struct {
+	gorm.Model
+	AccountID uint   `gorm:"index"`
+	Purpose   string // One of the Token constants
+	Digest    string `gorm:"uniqueIndex"`
+	Email     string // Address the token was sent to
+	ExpiresAt time.Time
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// NewAccountToken Generates a token for an account
+// Returns the token to store and the plaintext to send
+func NewAccountToken(account *Account, purpose string, duration time.Duration) (*AccountToken, string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		err = fmt.Errorf("Error generating token: %v", err)
+		glog.Error(err)
+		return nil, "", err
+	}
+
+	plaintext := hex.EncodeToString(bytes)
+	return &AccountToken{
+		AccountID: account.ID,
+		Purpose:   purpose,
+		Digest:    HashAPIKey(plaintext),
+		Email:     account.Email,
+		ExpiresAt: time.Now().Add(duration),
+	}, plaintext, nil
+}
+
+// Check if a plaintext token is this token, in constant time
+func (token *AccountToken) Matches(plaintext string) bool {
+	return subtle.ConstantTimeCompare([]byte(token.Digest), []byte(HashAPIKey(plaintext))) == 1
+}
+
+func (token *AccountToken) IsExpired() bool {
+	return token.ExpiresAt.Before(time.Now())
+}
@@ -2,6 +2,7 @@ package Models
 
 import (
 	"gorm.io/gorm"
+	"time"
 )
 
 type Account struct {
@@ -10,9 +11,26 @@ type Account struct {
 	Username	string		`json:"username" gorm:"unique"`
 	Password	string		`json:"password"`
 	Email		string		`json:"email"`
+	EmailVerified	bool	`json:"email_verified"`
+	TOTPSecret		string	`json:"-"`	// Set when enrolling, in use once TOTPEnabled
+	TOTPEnabled		bool	`json:"totp_enabled"`
+	TOTPCounter		int64	`json:"-"`	// Step of the last code used, codes can not be used twice
+	Role		string		`json:"role"`		// One of the Role constants
+	Disabled	bool		`json:"disabled"`	// Disabled accounts can not log in or use their API keys
+	SSOSubject	*string		`json:"-" gorm:"uniqueIndex"`	// Subject at the OpenID Connect issuer, nil if not linked
 	API_Keys	[]APIKey	`json:"api_keys" gorm:"foreignKey:AccountID"`
 }
 
+// Roles decide what an account can do, whatever the scopes of its API keys
+const (
+	RoleAdmin		= "admin"		// Everything, including the /v1/admin endpoints
+	RoleUser		= "user"		// Everything but administering the server
+	RoleReadOnly	= "read-only"	// Browse and read, without changing the library
+)
+
+// Scopes a read-only account can not use
+var readOnlyDenied = map[string]bool{ScopeLibraryWrite: true, ScopeDownloadsWrite: true}
+
 type NewAccountRequest struct {
 	Username	string		`json:"username" binding:"required"`
 	Password	string		`json:"password" binding:"required"`
@@ -22,4 +40,57 @@ type NewAccountRequest struct {
 type LoginRequest struct {
 	Identifier	string		`json:"email"`
 	Password	string		`json:"password" binding:"required"`
+	Label		string		`json:"label" binding:"max=100"`	// Label of the API key created for the login
+	OTP			string		`json:"otp"`	// TOTP or recovery code, needed if two-factor authentication is on
+}
+
+// Changes to an account, empty fields are left as they are
+// Changing the email or password needs the current password, and the second factor if it is on
+// Accounts created through single sign-on have no current password to give
+type UpdateAccountRequest struct {
+	Username		string		`json:"username" binding:"omitempty,max=100"`
+	Email			string		`json:"email" binding:"omitempty,email"`
+	NewPassword		string		`json:"new_password"`
+	CurrentPassword	string		`json:"current_password"`
+	OTP				string		`json:"otp"`
+}
+
+type DeleteAccountRequest struct {
+	Password	string		`json:"password"`	// Not needed by accounts created through single sign-on
+	OTP			string		`json:"otp"` // TOTP or recovery code, if two-factor authentication is on
+}
+
+// Changes an admin makes to an account, empty fields are left as they are
+type AdminUpdateAccountRequest struct {
+	Role		string		`json:"role" binding:"omitempty,oneof=admin user read-only"`
+	Disabled	*bool		`json:"disabled"`
+}
+
+type AdminResetPasswordRequest struct {
+	NewPassword	string		`json:"new_password" binding:"required"`
+}
+
+// Check if the role of an account lets it use a scope
+func (account *Account) CanUse(scope string) bool {
+	return account.Role != RoleReadOnly || !readOnlyDenied[scope]
+}
+
+// Check if an account is an admin that is not disabled
+func (account *Account) IsAdmin() bool {
+	return account.Role == RoleAdmin && !account.Disabled
+}
+
+// Converts an account to a JSON object, without its password
+func (account *Account) ToJSON() AccountJSON {
+	return AccountJSON{
+		ID:            account.ID,
+		Username:      account.Username,
+		Email:         account.Email,
+		EmailVerified: account.EmailVerified,
+		TOTPEnabled:   account.TOTPEnabled,
+		Role:          account.Role,
+		Disabled:      account.Disabled,
+		SSO:           account.SSOSubject != nil,
+		CreatedAt:     account.CreatedAt.Format(time.RFC3339),
+	}
 }
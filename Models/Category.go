@@ -0,0 +1,34 @@
+package Models
+
+import (
+	"gorm.io/gorm"
+)
+
+// A named shelf an account sorts its manga into, like the categories of Tachiyomi
+type Category struct {
+	gorm.Model
+	AccountID uint   `gorm:"uniqueIndex:idx_category_account_name"`
+	Name      string `gorm:"uniqueIndex:idx_category_account_name"`
+
+	Manga []CategoryManga `gorm:"foreignKey:CategoryID"`
+}
+
+// A manga in a category
+type CategoryManga struct {
+	CategoryID uint `gorm:"primaryKey"`
+	MangaID    uint `gorm:"primaryKey"`
+}
+
+// Converts a category to a JSON object
+func (category *Category) ToJSON() CategoryJSON {
+	mangaIDs := make([]uint, len(category.Manga))
+	for i, manga := range category.Manga {
+		mangaIDs[i] = manga.MangaID
+	}
+
+	return CategoryJSON{
+		ID:       category.ID,
+		Name:     category.Name,
+		MangaIDs: mangaIDs,
+	}
+}
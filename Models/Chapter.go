@@ -1,14 +1,23 @@
 package Models
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"github.com/CookieUzen/mangascribe/Config"
 	"github.com/CookieUzen/mangascribe/Tools"
 	"github.com/golang/glog"
 	"gorm.io/gorm"
 	"io"
 	"os"
+	"math"
+	"net/url"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Chapter struct {
@@ -25,12 +34,55 @@ type Chapter struct {
 	PageNumber         int
 	ScanlationGroup    string
 	DownloadPath       string
+	State              ChapterState
 	Pages              []Page `gorm:"foreignKey:ChapterID"`
+	Manga              *Manga `gorm:"foreignKey:MangaID;references:MangaID"`
 }
 
-// Downloads the chapters inside the volume map for a manga
-// Note that this ignores the chapters array (no duplicate scanlations or languages)
-func (chapter *Chapter) Download(API APIProvider, datasaver bool) error {
+type ChapterState string
+
+const (
+	ChapterPending  ChapterState = "pending"
+	ChapterPartial  ChapterState = "partial"
+	ChapterComplete ChapterState = "complete"
+	ChapterFailed   ChapterState = "failed"
+)
+
+// DownloadStore persists the progress of a chapter download
+// so an interrupted download can be resumed from the pages already on disk
+type DownloadStore interface {
+	SavePage(page *Page) error
+	SaveChapterState(chapter *Chapter) error
+}
+
+// Pages are numbered from 1, like in the reader endpoints
+type VerifyReport struct {
+	ChapterID uint  `json:"chapter_id"`
+	Missing   []int `json:"missing"`
+	Corrupted []int `json:"corrupted"`
+}
+
+// Downloads the chapter, recording every page and the chapter state in the store
+// Pages already on disk with a matching hash and quality are skipped
+func (chapter *Chapter) Download(API APIProvider, datasaver bool, store DownloadStore) error {
+	chapter.State = ChapterPartial
+	if err := store.SaveChapterState(chapter); err != nil {
+		return err
+	}
+
+	if err := chapter.download(API, datasaver, store); err != nil {
+		chapter.State = ChapterFailed
+		store.SaveChapterState(chapter)
+		return err
+	}
+
+	chapter.State = ChapterComplete
+	return store.SaveChapterState(chapter)
+}
+
+// download Fetches the pages of a chapter into its folder
+func (chapter *Chapter) download(API APIProvider, datasaver bool, store DownloadStore) error {
+	quality := PageQuality(datasaver)
 
 	// Get URLs
 	URL, linklist, err := API.FetchChapterDownload(chapter.ID, datasaver)
@@ -40,8 +92,7 @@ func (chapter *Chapter) Download(API APIProvider, datasaver bool) error {
 	}
 
 	// Create the tmp directory to download into
-	// tempDir, err := os.MkdirTemp("", chapter.Manga.Name+chapter.Volume+chapter.Chapter)
-	tempDir, err := os.MkdirTemp("", chapter.Volume+chapter.Chapter)
+	tempDir, err := os.MkdirTemp("", "mangascribe")
 	if err != nil {
 		glog.Error("Failed to create temporary directory")
 		return err
@@ -59,45 +110,30 @@ func (chapter *Chapter) Download(API APIProvider, datasaver bool) error {
 		glog.Error("Failed to create directory")
 		return err
 	}
+	chapter.DownloadPath = dir
+
+	// Make sure there is a page entry for every link
+	if len(chapter.Pages) < len(linklist) {
+		chapter.Pages = append(chapter.Pages, make([]Page, len(linklist)-len(chapter.Pages))...)
+	}
 
 	// Download the files into the tmp directory
 	for i, link := range linklist {
-		filename := fmt.Sprintf("%04d%s", i+1, filepath.Ext(link))
-
-		// Open the origFile for reading and writing
+		filename := fmt.Sprintf("%04d%s", i+1, pageExtension(link))
 		filePath := filepath.Join(dir, filename)
-		origFile, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
-		if err != nil {
-			glog.Error("Failed to open current file")
-			return err
-		}
-		defer func(origFile *os.File) {
-			err := origFile.Close()
-			if err != nil {
-				glog.Error(err)
-			}
-		}(origFile)
 
-		// Check if the origFile in the directory matches the hash in the chapter
+		// Check if the file in the directory matches the hash in the chapter
 		// If it does, skip the download
-		if currentHash := chapter.Pages[i].Hash; currentHash != "" {
-
-			// Hash the origFile
-			fileHash, err := Tools.HashFile(origFile)
-			if err != nil {
-				glog.Error("Failed to hash file")
+		if current := chapter.Pages[i]; current.Hash != "" && current.Quality == quality {
+			if status, err := current.Verify(dir); err != nil {
 				return err
-			}
-
-			if fileHash == currentHash {
+			} else if status == PageIntact {
 				glog.Info("Skipping page ", i+1, " as it already exists")
 				continue
 			}
 		}
-		// origFile.Close()
-		origFile, err = os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 
-		hash, downloadedFile, err := Tools.DownloadFile(URL+link, filename, tempDir)
+		hash, downloadedFile, err := fetchPage(API, URL, link, filename, tempDir)
 		if err != nil {
 			errText := fmt.Sprintf("failed to download link: %v", err)
 			err = errors.New(errText)
@@ -105,36 +141,79 @@ func (chapter *Chapter) Download(API APIProvider, datasaver bool) error {
 			return err
 		}
 
-		// Update the page
-		page := Page{
-			Hash:     hash,
-			FileName: filename,
-			Page:     i,
+		// Check the download against the hash the provider embeds in the filename
+		if expected := API.PageHash(link); expected != "" && !Tools.MatchesHash(expected, hash) {
+			err = fmt.Errorf("page %d hash mismatch: expected %s, got %s", i+1, expected, hash)
+			glog.Error(err)
+			return err
 		}
-		chapter.Pages[i] = page
 
 		// Copy the file to the destination directory
-		_, err = io.Copy(origFile, downloadedFile)
+		size, err := writePage(filePath, downloadedFile)
 		if err != nil {
-			err = fmt.Errorf("Failed to copy file: %w", err)
-			glog.Error(err)
 			return err
 		}
-	}
 
-	// Update the chapter
-	chapter.DownloadPath = dir
+		// Update the page, keeping its database id
+		page := &chapter.Pages[i]
+		page.ChapterID = chapter.ChapterID
+		page.Page = i
+		page.FileName = filename
+		page.Hash = hash
+		page.Size = size
+		page.Quality = quality
+		page.DownloadedAt = time.Now()
+		page.Width, page.Height = Tools.ImageSize(filePath)
+
+		if err := store.SavePage(page); err != nil {
+			return err
+		}
+	}
 
 	glog.Info("Successfully downloaded chapter ", chapter.Chapter, " at ", dir)
 	return nil
 }
 
-// ChapterFolderCreation Creates the folder for the chapter
+// pageExtension Returns the file extension of a page link, ignoring any query string
+func pageExtension(link string) string {
+	if parsed, err := url.Parse(link); err == nil {
+		return path.Ext(parsed.Path)
+	}
+
+	return filepath.Ext(link)
+}
+
+// fetchPage Gets a page and its hash, from the provider itself if it reads its own pages
+func fetchPage(API APIProvider, URL string, link string, filename string, tempDir string) (string, io.Reader, error) {
+	fetcher, ok := API.(PageFetcher)
+	if !ok {
+		return Tools.DownloadFile(URL+link, filename, tempDir)
+	}
+
+	page, err := fetcher.FetchPage(URL, link)
+	if err != nil {
+		return "", nil, err
+	}
+	defer page.Close()
+
+	var buf bytes.Buffer
+	hash, err := Tools.HashFile(io.TeeReader(page, &buf))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return hash, &buf, nil
+}
+
+// ChapterFolderCreation Creates the folder for the chapter inside the library
 // Returns the path to the folder
 func (chapter Chapter) ChapterFolderCreation() (error, string) {
 	// Create the directory
-	// dirPath := filepath.Join(".", chapter.Manga.Name, chapter.Volume, chapter.Chapter)
-	dirPath := filepath.Join(".", chapter.Volume, chapter.Chapter)
+	mangaDir := Config.LIBRARY_PATH
+	if chapter.Manga != nil {
+		mangaDir = chapter.Manga.FolderPath()
+	}
+	dirPath := filepath.Join(mangaDir, Tools.SanitizeFilename(chapter.Volume), Tools.SanitizeFilename(chapter.Chapter))
 	err := os.MkdirAll(dirPath, 0755)
 	if err != nil {
 		err = fmt.Errorf("Failed to create directory: %w", err)
@@ -144,3 +223,105 @@ func (chapter Chapter) ChapterFolderCreation() (error, string) {
 
 	return nil, dirPath
 }
+
+// writePage Writes a downloaded page to its final path, replacing any existing file
+// Returns the number of bytes written
+func writePage(filePath string, content io.Reader) (int64, error) {
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		err = fmt.Errorf("Failed to open file %s: %w", filePath, err)
+		glog.Error(err)
+		return 0, err
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			glog.Error(err)
+		}
+	}(file)
+
+	size, err := io.Copy(file, content)
+	if err != nil {
+		err = fmt.Errorf("Failed to copy file: %w", err)
+		glog.Error(err)
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// Verify Re-hashes every page of a downloaded chapter
+// Returns a report listing the missing and corrupted pages
+func (chapter *Chapter) Verify() (VerifyReport, error) {
+	report := VerifyReport{
+		ChapterID: chapter.ChapterID,
+		Missing:   []int{},
+		Corrupted: []int{},
+	}
+
+	// Pages the provider listed but were never written count as missing
+	for i := len(chapter.Pages); i < chapter.PageNumber; i++ {
+		report.Missing = append(report.Missing, i+1)
+	}
+
+	for _, page := range chapter.Pages {
+		status, err := page.Verify(chapter.DownloadPath)
+		if err != nil {
+			return report, err
+		}
+
+		switch status {
+		case PageMissing:
+			report.Missing = append(report.Missing, page.Number())
+		case PageCorrupted:
+			report.Corrupted = append(report.Corrupted, page.Number())
+		}
+	}
+
+	return report, nil
+}
+
+// Returns true if the report found no missing or corrupted pages
+func (report VerifyReport) OK() bool {
+	return len(report.Missing) == 0 && len(report.Corrupted) == 0
+}
+
+// Converts a chapter to a JSON object
+func (chapter *Chapter) ToJSON() ChapterJSON {
+	return ChapterJSON{
+		ID:                 chapter.ChapterID,
+		ProviderID:         chapter.ID,
+		Volume:             chapter.Volume,
+		Chapter:            chapter.Chapter,
+		Title:              chapter.Title,
+		TranslatedLanguage: chapter.TranslatedLanguage,
+		Pages:              chapter.PageNumber,
+		State:              string(chapter.State),
+	}
+}
+
+// Returns the volume and chapter numbers used for ordering
+// Chapters without a numeric volume (usually the latest ones) sort after every volume
+func (chapter *Chapter) ReadingOrder() (float64, float64) {
+	parse := func(value string, prefix string) float64 {
+		number, err := strconv.ParseFloat(strings.TrimPrefix(value, prefix), 64)
+		if err != nil {
+			return math.Inf(1)
+		}
+		return number
+	}
+
+	return parse(chapter.Volume, "Volume "), parse(chapter.Chapter, "Chapter ")
+}
+
+// Sorts chapters in reading order, by volume then by chapter number
+func SortChapters(chapters []Chapter) {
+	sort.SliceStable(chapters, func(i, j int) bool {
+		volumeI, chapterI := chapters[i].ReadingOrder()
+		volumeJ, chapterJ := chapters[j].ReadingOrder()
+		if volumeI != volumeJ {
+			return volumeI < volumeJ
+		}
+		return chapterI < chapterJ
+	})
+}
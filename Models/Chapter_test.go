@@ -0,0 +1,55 @@
+package Models
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CookieUzen/mangascribe/Tools"
+)
+
+func TestVerifyNumbersPagesFromOne(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name string, content string) string {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := Tools.HashFile(strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+
+	intact := write("01.png", "first page")
+	write("03.png", "third page, changed on disk")
+
+	// Page 2 was never written, page 3 is corrupted and pages 4 and 5 were listed but never downloaded
+	chapter := Chapter{
+		ChapterID:    7,
+		DownloadPath: dir,
+		PageNumber:   5,
+		Pages: []Page{
+			{Page: 0, FileName: "01.png", Hash: intact},
+			{Page: 1, FileName: "02.png", Hash: "missing"},
+			{Page: 2, FileName: "03.png", Hash: "the hash of the third page"},
+		},
+	}
+
+	report, err := chapter.Verify()
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	if report.ChapterID != 7 || report.OK() {
+		t.Fatalf("got report %+v", report)
+	}
+	if len(report.Missing) != 3 || report.Missing[0] != 4 || report.Missing[1] != 5 || report.Missing[2] != 2 {
+		t.Errorf("got missing pages %v, want 4 5 2", report.Missing)
+	}
+	if len(report.Corrupted) != 1 || report.Corrupted[0] != 3 {
+		t.Errorf("got corrupted pages %v, want 3", report.Corrupted)
+	}
+}
@@ -0,0 +1,156 @@
+package Models
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"github.com/golang/glog"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ComicInfo.xml metadata, as read by comic servers and readers
+type ComicInfo struct {
+	XMLName     xml.Name `xml:"ComicInfo"`
+	Title       string   `xml:"Title,omitempty"`
+	Series      string   `xml:"Series"`
+	Number      string   `xml:"Number,omitempty"`
+	Count       int      `xml:"Count,omitempty"`
+	Volume      int      `xml:"Volume,omitempty"`
+	Summary     string   `xml:"Summary,omitempty"`
+	Year        int      `xml:"Year,omitempty"`
+	Writer      string   `xml:"Writer,omitempty"`
+	Penciller   string   `xml:"Penciller,omitempty"`
+	Genre       string   `xml:"Genre,omitempty"`
+	Web         string   `xml:"Web,omitempty"`
+	PageCount   int      `xml:"PageCount,omitempty"`
+	LanguageISO string   `xml:"LanguageISO,omitempty"`
+	Manga       string   `xml:"Manga,omitempty"`
+	AgeRating   string   `xml:"AgeRating,omitempty"`
+}
+
+// Builds the ComicInfo of a chapter, or of a whole volume if chapter is nil
+// The manga's tags, authors and artists should be loaded
+func NewComicInfo(manga *Manga, volume string, chapter *Chapter) ComicInfo {
+	names := func(people []Person) string {
+		list := make([]string, len(people))
+		for i, person := range people {
+			list[i] = person.Name
+		}
+		return strings.Join(list, ", ")
+	}
+
+	tags := make([]string, len(manga.Tags))
+	for i, tag := range manga.Tags {
+		tags[i] = tag.Name
+	}
+
+	info := ComicInfo{
+		Series:    manga.Name,
+		Summary:   manga.Description,
+		Year:      manga.Year,
+		Writer:    names(manga.Authors),
+		Penciller: names(manga.Artists),
+		Genre:     strings.Join(tags, ", "),
+		Manga:     "YesAndRightToLeft",
+	}
+
+	if manga.ContentRating == "erotica" || manga.ContentRating == "pornographic" {
+		info.AgeRating = "Adults Only 18+"
+	}
+
+	volumeNumber, _ := (&Chapter{Volume: volume}).ReadingOrder()
+	if !math.IsInf(volumeNumber, 1) {
+		info.Volume = int(volumeNumber)
+	}
+
+	if chapter != nil {
+		info.Title = chapter.Title
+		info.Number = strings.TrimPrefix(chapter.Chapter, "Chapter ")
+		info.PageCount = chapter.PageNumber
+		info.LanguageISO = chapter.TranslatedLanguage
+	} else {
+		info.Title = volume
+	}
+
+	return info
+}
+
+// WriteCBZ Writes the downloaded pages of chapters and their ComicInfo.xml as a CBZ archive
+// The chapters' pages must be loaded, pages are stored without compression
+func WriteCBZ(w io.Writer, chapters []Chapter, info ComicInfo) error {
+	archive := zip.NewWriter(w)
+
+	infoFile, err := archive.Create("ComicInfo.xml")
+	if err != nil {
+		err = fmt.Errorf("Failed to add ComicInfo.xml: %w", err)
+		glog.Error(err)
+		return err
+	}
+	if _, err := io.WriteString(infoFile, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(infoFile)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(info); err != nil {
+		err = fmt.Errorf("Failed to encode ComicInfo.xml: %w", err)
+		glog.Error(err)
+		return err
+	}
+
+	for i := range chapters {
+		for _, page := range chapters[i].Pages {
+			if page.FileName == "" {
+				continue
+			}
+
+			// Prefix pages with their chapter so they sort in order across chapters
+			name := page.FileName
+			if len(chapters) > 1 {
+				name = fmt.Sprintf("%03d-%s", i+1, page.FileName)
+			}
+
+			if err := addToArchive(archive, name, filepath.Join(chapters[i].DownloadPath, page.FileName)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		err = fmt.Errorf("Failed to finish archive: %w", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// addToArchive Copies a file into the archive under name
+func addToArchive(archive *zip.Writer, name string, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		err = fmt.Errorf("Failed to open page %s: %w", path, err)
+		glog.Error(err)
+		return err
+	}
+	defer file.Close()
+
+	// Images are already compressed
+	entry, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+	if err != nil {
+		err = fmt.Errorf("Failed to add %s to archive: %w", name, err)
+		glog.Error(err)
+		return err
+	}
+
+	if _, err := io.Copy(entry, file); err != nil {
+		err = fmt.Errorf("Failed to copy %s into archive: %w", name, err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
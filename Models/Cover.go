@@ -0,0 +1,112 @@
+package Models
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/Tools"
+	"github.com/golang/glog"
+	"gorm.io/gorm"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+type Cover struct {
+	gorm.Model
+	MangaID uint
+
+	Volume string // Empty for the series cover
+	URL    string
+	Hash   string
+	Manga  *Manga `gorm:"foreignKey:MangaID;references:MangaID"`
+}
+
+// Returns the name of the cover file inside the covers folder
+func (cover *Cover) FileName() string {
+	name := "cover"
+	if cover.Volume != "" {
+		name = "volume-" + Tools.SanitizeFilename(cover.Volume)
+	}
+
+	return name + strings.ToLower(path.Ext(cover.URL))
+}
+
+// Returns the path to the cover, or to one of its thumbnails if size is set
+// mangaDir is the folder of the manga the cover belongs to
+func (cover *Cover) Path(mangaDir string, size string) string {
+	dir := filepath.Join(mangaDir, "covers")
+	if size == "" {
+		return filepath.Join(dir, cover.FileName())
+	}
+
+	name := strings.TrimSuffix(cover.FileName(), path.Ext(cover.FileName()))
+	return filepath.Join(dir, "thumbnails", name+"-"+size+".jpg")
+}
+
+// Downloads the cover into the covers folder of mangaDir and generates its thumbnails
+func (cover *Cover) Download(mangaDir string) error {
+	body, err := Tools.RequestGET(cover.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	hash, err := Tools.HashFile(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	coverPath := cover.Path(mangaDir, "")
+	if err := os.MkdirAll(filepath.Dir(coverPath), 0755); err != nil {
+		err = fmt.Errorf("Failed to create covers directory: %w", err)
+		glog.Error(err)
+		return err
+	}
+
+	if _, err := writePage(coverPath, bytes.NewReader(body)); err != nil {
+		return err
+	}
+	cover.Hash = hash
+
+	return cover.GenerateThumbnails(mangaDir)
+}
+
+// Generates a thumbnail of the downloaded cover for every configured size
+func (cover *Cover) GenerateThumbnails(mangaDir string) error {
+	for size, width := range Config.THUMBNAIL_SIZES {
+		if err := cover.generateThumbnail(mangaDir, size, width); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// generateThumbnail Writes a single thumbnail of the cover
+func (cover *Cover) generateThumbnail(mangaDir string, size string, width int) error {
+	src, err := os.Open(cover.Path(mangaDir, ""))
+	if err != nil {
+		err = fmt.Errorf("Failed to open cover: %w", err)
+		glog.Error(err)
+		return err
+	}
+	defer src.Close()
+
+	thumbnailPath := cover.Path(mangaDir, size)
+	if err := os.MkdirAll(filepath.Dir(thumbnailPath), 0755); err != nil {
+		err = fmt.Errorf("Failed to create thumbnails directory: %w", err)
+		glog.Error(err)
+		return err
+	}
+
+	dst, err := os.Create(thumbnailPath)
+	if err != nil {
+		err = fmt.Errorf("Failed to create thumbnail: %w", err)
+		glog.Error(err)
+		return err
+	}
+	defer dst.Close()
+
+	return Tools.Thumbnail(src, dst, width)
+}
@@ -0,0 +1,65 @@
+package Models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type JobType string
+type JobStatus string
+
+const (
+	DownloadJob JobType = "download"
+	VerifyJob   JobType = "verify"
+	CoverJob    JobType = "covers"
+	SyncJob     JobType = "sync"
+	ExportJob   JobType = "export"
+	// Pushes the read markers of a manga to the linked MangaDex account
+	MangaDexReadJob JobType = "mangadex_read"
+	// Pushes the reading progress of a manga to the trackers it is linked to
+	TrackerJob JobType = "tracker"
+	// Imports the follows, reading statuses and read markers of the MangaDex account linked to an account
+	MangaDexSyncJob JobType = "mangadex_sync"
+	// Imports an uploaded Tachiyomi/Mihon backup for an account
+	BackupImportJob JobType = "backup_import"
+)
+
+const (
+	JobPending   JobStatus = "pending"
+	JobRunning   JobStatus = "running"
+	JobCompleted JobStatus = "completed"
+	JobFailed    JobStatus = "failed"
+)
+
+// A unit of background work, persisted so pending jobs survive a restart
+type Job struct {
+	gorm.Model
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Type      JobType   `json:"type"`
+	Status    JobStatus `json:"status"`
+	ChapterID uint      `json:"chapter_id"`
+	MangaID   uint      `json:"manga_id"`
+	AccountID uint      `json:"account_id"` // Account that queued the job, or that the job works for
+	Datasaver bool      `json:"datasaver"`
+	File      string    `json:"-"` // Upload the job reads, removed once it ran
+	Report    string    `json:"report"`
+	Error     string    `json:"error"`
+	Attempts  int       `json:"attempts"`
+}
+
+// Converts a job to a JSON object
+func (job *Job) ToJSON() JobJSON {
+	return JobJSON{
+		ID:        job.ID,
+		Type:      string(job.Type),
+		Status:    string(job.Status),
+		ChapterID: job.ChapterID,
+		MangaID:   job.MangaID,
+		AccountID: job.AccountID,
+		Report:    job.Report,
+		Error:     job.Error,
+		Attempts:  job.Attempts,
+		CreatedAt: job.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: job.UpdatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,33 @@
+package Models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// Why a login attempt failed
+const (
+	LoginFailedPassword = "password" // Unknown account or wrong password
+	LoginFailedOTP      = "otp"      // Wrong two-factor code
+	LoginLocked         = "locked"   // Refused before checking, after too many failures
+	LoginDisabled       = "disabled" // Right password, but an admin disabled the account
+)
+
+// LoginAttempt is the audit record of a login, failed attempts are counted to lock out guessing
+type LoginAttempt struct {
+	gorm.Model
+	AccountID  *uint  `gorm:"index"` // Nil if no account matched the identifier
+	Identifier string `gorm:"index"` // Username or email as it was sent, lowercased
+	IP         string `gorm:"index"`
+	Success    bool
+	Reason     string // Empty on success, one of the Login constants otherwise
+}
+
+func (attempt *LoginAttempt) ToJSON() LoginAttemptJSON {
+	return LoginAttemptJSON{
+		IP:        attempt.IP,
+		Success:   attempt.Success,
+		Reason:    attempt.Reason,
+		CreatedAt: attempt.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -3,8 +3,12 @@ package Models
 import (
 	"errors"
 	"fmt"
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/Tools"
 	"github.com/golang/glog"
 	"gorm.io/gorm"
+	"path/filepath"
+	"time"
 )
 
 type Manga struct {
@@ -15,7 +19,64 @@ type Manga struct {
 	Name        string
 	Chapters    []Chapter `gorm:"foreignKey:MangaID"`
 	Volumes     []Volume  `gorm:"foreignKey:MangaID"`
+	Covers      []Cover   `gorm:"foreignKey:MangaID"`
 	APIProvider string
+	SeriesID    *uint // Series grouping the same manga from other providers
+	Folder      string // Folder inside the library, kept when the manga is renamed
+
+	Description      string
+	Status           string
+	Year             int
+	Demographic      string
+	ContentRating    string
+	OriginalLanguage string
+	LastVolume       string
+	LastChapter      string
+	LastChapterAt    time.Time
+	AltTitles        []AltTitle `gorm:"foreignKey:MangaID"`
+	Links            []Link     `gorm:"foreignKey:MangaID"`
+	Tags             []Tag      `gorm:"many2many:manga_tags"`
+	Authors          []Person   `gorm:"many2many:manga_authors"`
+	Artists          []Person   `gorm:"many2many:manga_artists"`
+}
+
+type AddMangaRequest struct {
+	Title     string `json:"title" binding:"required"`
+	Provider  string `json:"provider"`
+	Datasaver bool   `json:"datasaver"`
+}
+
+type ImportRequest struct {
+	Path string `json:"path"`
+}
+
+// Filters, sorting and pagination for listing the library
+type LibraryQuery struct {
+	Search        string   `form:"q"`
+	Tags          []string `form:"tag"`
+	Status        string   `form:"status"`
+	ContentRating string   `form:"content_rating"`
+	Language      string   `form:"language"`
+	Provider      string   `form:"provider"`
+	HasUnread     string   `form:"has_unread"`
+	AccountID     uint     `form:"-"`
+	Sort          string   `form:"sort"`
+	Order         string   `form:"order"`
+	Limit         int      `form:"limit"`
+	Cursor        string   `form:"cursor"`
+}
+
+// Returns the folder of the manga inside the library
+func (manga *Manga) FolderPath() string {
+	if manga.Folder == "" {
+		manga.Folder = manga.DefaultFolder()
+	}
+	return filepath.Join(Config.LIBRARY_PATH, manga.Folder)
+}
+
+// Returns the folder name for a new manga, the id keeps manga with the same name apart
+func (manga *Manga) DefaultFolder() string {
+	return fmt.Sprintf("%d - %s", manga.MangaID, Tools.SanitizeFilename(manga.Name))
 }
 
 // Gets a list of all the available chapters for a given Manga struct
@@ -105,10 +166,10 @@ func (manga *Manga) ChapterToVolume() error {
 }
 
 // This downloads all the volumes in a chapter
-func (manga *Manga) Download(API APIProvider, datasaver bool) error {
+func (manga *Manga) Download(API APIProvider, datasaver bool, store DownloadStore) error {
 	// loop through all the volumes
-	for _, volume := range manga.Volumes {
-		err := volume.Download(API, datasaver)
+	for i := range manga.Volumes {
+		err := manga.Volumes[i].Download(API, datasaver, store)
 		if err != nil {
 			errText := fmt.Sprintf("failed to download volume: %v", err)
 			err = errors.New(errText)
@@ -120,3 +181,60 @@ func (manga *Manga) Download(API APIProvider, datasaver bool) error {
 	glog.Info("Successfully downloaded manga: ", manga.Name)
 	return nil
 }
+
+// Converts a manga to a JSON object, including its volumes if they are loaded
+func (manga *Manga) ToJSON() MangaJSON {
+	volumes := make([]VolumeJSON, len(manga.Volumes))
+	for i := range manga.Volumes {
+		volumes[i] = manga.Volumes[i].ToJSON()
+	}
+
+	altTitles := make([]string, len(manga.AltTitles))
+	for i, title := range manga.AltTitles {
+		altTitles[i] = title.Title
+	}
+
+	tags := make([]string, len(manga.Tags))
+	for i, tag := range manga.Tags {
+		tags[i] = tag.Name
+	}
+
+	authors := make([]string, len(manga.Authors))
+	for i, author := range manga.Authors {
+		authors[i] = author.Name
+	}
+
+	artists := make([]string, len(manga.Artists))
+	for i, artist := range manga.Artists {
+		artists[i] = artist.Name
+	}
+
+	links := make(map[string]string)
+	for _, link := range manga.Links {
+		links[link.Site] = link.Value
+	}
+
+	return MangaJSON{
+		ID:               manga.MangaID,
+		ProviderID:       manga.ID,
+		Provider:         manga.APIProvider,
+		SeriesID:         manga.SeriesID,
+		Name:             manga.Name,
+		Description:      manga.Description,
+		Status:           manga.Status,
+		Year:             manga.Year,
+		Demographic:      manga.Demographic,
+		ContentRating:    manga.ContentRating,
+		OriginalLanguage: manga.OriginalLanguage,
+		LastVolume:       manga.LastVolume,
+		LastChapter:      manga.LastChapter,
+		LastUpdated:      manga.LastChapterAt.Format(time.RFC3339),
+		AddedAt:          manga.CreatedAt.Format(time.RFC3339),
+		AltTitles:        altTitles,
+		Tags:             tags,
+		Authors:          authors,
+		Artists:          artists,
+		Links:            links,
+		Volumes:          volumes,
+	}
+}
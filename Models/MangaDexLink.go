@@ -0,0 +1,46 @@
+package Models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// A MangaDex account linked to an account, through a MangaDex personal API client
+// The password is only used to log in and is never stored
+type MangaDexLink struct {
+	gorm.Model
+	AccountID    uint `gorm:"uniqueIndex"`
+	Username     string
+	ClientID     string
+	ClientSecret string
+
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time // When the access token expires
+
+	PushReadMarkers bool // Mark chapters read on MangaDex as they are read here
+	LastSyncAt      *time.Time
+}
+
+type LinkMangaDexRequest struct {
+	Username        string `json:"username" binding:"required"`
+	Password        string `json:"password" binding:"required"`
+	ClientID        string `json:"client_id" binding:"required"`
+	ClientSecret    string `json:"client_secret" binding:"required"`
+	PushReadMarkers bool   `json:"push_read_markers"`
+}
+
+// Converts a MangaDex link to a JSON object, leaving out the credentials
+func (link *MangaDexLink) ToJSON() MangaDexLinkJSON {
+	lastSync := ""
+	if link.LastSyncAt != nil {
+		lastSync = link.LastSyncAt.Format(time.RFC3339)
+	}
+
+	return MangaDexLinkJSON{
+		Username:        link.Username,
+		ClientID:        link.ClientID,
+		PushReadMarkers: link.PushReadMarkers,
+		LastSyncAt:      lastSync,
+	}
+}
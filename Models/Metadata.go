@@ -0,0 +1,38 @@
+package Models
+
+import (
+	"gorm.io/gorm"
+)
+
+// A genre, theme or format tag, shared between every manga using it
+type Tag struct {
+	gorm.Model
+	ProviderID string `gorm:"uniqueIndex"`
+	Name       string
+	Group      string
+}
+
+// An alternative title of a manga in a given language
+type AltTitle struct {
+	gorm.Model
+	MangaID uint
+
+	Language string
+	Title    string
+}
+
+// An author or artist, shared between every manga they worked on
+type Person struct {
+	gorm.Model
+	ProviderID string `gorm:"uniqueIndex"`
+	Name       string
+}
+
+// An id or URL of the manga on another site, keyed by the provider's site code
+type Link struct {
+	gorm.Model
+	MangaID uint
+
+	Site  string
+	Value string
+}
@@ -0,0 +1,32 @@
+package Models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// OIDCLogin is a single sign-on login waiting for the identity provider to redirect back
+// Found by the digest of its state, and used once
+type OIDCLogin struct {
+	gorm.Model
+	State     string `gorm:"uniqueIndex"` // Digest of the state sent to the provider
+	Nonce     string
+	Verifier  string // PKCE code verifier, the provider only saw its challenge
+	Label     string // Label of the API key created once logged in
+	ExpiresAt time.Time
+}
+
+// Identity is who the identity provider says logged in
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	Role          string // Role from the groups of the user
+	SyncRole      bool   // Whether to update the role of an existing account
+	LinkByEmail   bool   // Whether an existing account with the same verified email is linked
+}
+
+func (login *OIDCLogin) IsExpired() bool {
+	return login.ExpiresAt.Before(time.Now())
+}
@@ -1,12 +1,96 @@
 package Models
 
-import "gorm.io/gorm"
+import (
+	"errors"
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Tools"
+	"github.com/golang/glog"
+	"gorm.io/gorm"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
 
 type Page struct {
 	gorm.Model
 	ChapterID uint
 
-	Page      int
-	FileName  string
-	Hash      string
+	Page         int
+	FileName     string
+	Hash         string
+	Size         int64
+	Quality      string
+	DownloadedAt time.Time
+	Width        int
+	Height       int
+}
+
+const (
+	QualityData      = "data"
+	QualityDataSaver = "data-saver"
+)
+
+// Returns the quality name of a page downloaded with or without datasaver
+func PageQuality(datasaver bool) string {
+	if datasaver {
+		return QualityDataSaver
+	}
+
+	return QualityData
+}
+
+type PageStatus string
+
+const (
+	PageIntact    PageStatus = "intact"
+	PageMissing   PageStatus = "missing"
+	PageCorrupted PageStatus = "corrupted"
+)
+
+// Verify Re-hashes the page inside dir and compares it with the stored hash
+// A page that was never downloaded counts as missing
+func (page *Page) Verify(dir string) (PageStatus, error) {
+	if page.FileName == "" {
+		return PageMissing, nil
+	}
+
+	file, err := os.Open(filepath.Join(dir, page.FileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return PageMissing, nil
+	} else if err != nil {
+		err = fmt.Errorf("Failed to open page %s: %w", page.FileName, err)
+		glog.Error(err)
+		return "", err
+	}
+	defer file.Close()
+
+	hash, err := Tools.HashFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	if hash != page.Hash {
+		glog.Warning("Page ", page.FileName, " in ", dir, " is corrupted")
+		return PageCorrupted, nil
+	}
+
+	return PageIntact, nil
+}
+
+// Returns the page number used in URLs, which starts at 1
+func (page *Page) Number() int {
+	return page.Page + 1
+}
+
+// Converts a page to a JSON object, url is where the page can be fetched
+func (page *Page) ToJSON(url string) PageJSON {
+	return PageJSON{
+		Page:   page.Number(),
+		URL:    url,
+		Width:  page.Width,
+		Height: page.Height,
+		Size:   page.Size,
+		Hash:   page.Hash,
+	}
 }
@@ -0,0 +1,71 @@
+package Models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// How far an account got into a chapter
+type ReadProgress struct {
+	gorm.Model
+	AccountID uint `gorm:"uniqueIndex:idx_progress_account_chapter"`
+	ChapterID uint `gorm:"uniqueIndex:idx_progress_account_chapter"`
+	MangaID   uint `gorm:"index"`
+
+	LastPage    int
+	Read        bool
+	CompletedAt *time.Time
+}
+
+// A manga an account follows, used for continue reading
+type Follow struct {
+	gorm.Model
+	AccountID uint `gorm:"uniqueIndex:idx_follow_account_manga"`
+	MangaID   uint `gorm:"uniqueIndex:idx_follow_account_manga"`
+}
+
+// The next chapter to read in a followed manga
+type ContinueReading struct {
+	Manga    Manga
+	Chapter  Chapter
+	Progress ReadProgress
+}
+
+type ProgressRequest struct {
+	LastPage int  `json:"last_page"`
+	Read     bool `json:"read"`
+}
+
+type MarkReadRequest struct {
+	Read bool `json:"read"`
+}
+
+// Converts reading progress to a JSON object
+func (progress *ReadProgress) ToJSON() ProgressJSON {
+	completedAt := ""
+	if progress.CompletedAt != nil {
+		completedAt = progress.CompletedAt.Format(time.RFC3339)
+	}
+
+	updatedAt := ""
+	if !progress.UpdatedAt.IsZero() {
+		updatedAt = progress.UpdatedAt.Format(time.RFC3339)
+	}
+
+	return ProgressJSON{
+		ChapterID:   progress.ChapterID,
+		LastPage:    progress.LastPage,
+		Read:        progress.Read,
+		CompletedAt: completedAt,
+		UpdatedAt:   updatedAt,
+	}
+}
+
+// Converts a continue reading entry to a JSON object
+func (entry *ContinueReading) ToJSON() ContinueReadingJSON {
+	return ContinueReadingJSON{
+		Manga:    entry.Manga.ToJSON(),
+		Chapter:  entry.Chapter.ToJSON(),
+		Progress: entry.Progress.ToJSON(),
+	}
+}
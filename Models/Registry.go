@@ -0,0 +1,73 @@
+package Models
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+)
+
+// Registry Maps the stable provider names stored on manga to their implementations
+type Registry struct {
+	providers map[string]APIProvider
+	names     []string
+	Default   string // Provider used when a request doesn't name one
+}
+
+// Creates a registry of providers, the first one is the default
+func NewRegistry(providers ...APIProvider) *Registry {
+	registry := &Registry{providers: make(map[string]APIProvider)}
+	for _, provider := range providers {
+		registry.Register(provider)
+	}
+
+	return registry
+}
+
+// Adds a provider under its name, replacing any provider with the same name
+func (registry *Registry) Register(provider APIProvider) {
+	name := provider.GetProvider()
+	if _, exists := registry.providers[name]; !exists {
+		registry.names = append(registry.names, name)
+	}
+	registry.providers[name] = provider
+
+	if registry.Default == "" {
+		registry.Default = name
+	}
+}
+
+// Returns the provider with the given name, or the default one if name is empty
+func (registry *Registry) Get(name string) (APIProvider, error) {
+	if name == "" {
+		name = registry.Default
+	}
+
+	provider, ok := registry.providers[name]
+	if !ok {
+		err := fmt.Errorf("Unknown provider: %s", name)
+		glog.Info(err)
+		return nil, err
+	}
+
+	return provider, nil
+}
+
+// Returns the provider a manga was added from
+func (registry *Registry) ForManga(manga *Manga) (APIProvider, error) {
+	if manga == nil {
+		err := fmt.Errorf("Missing manga to pick a provider for")
+		glog.Error(err)
+		return nil, err
+	}
+
+	return registry.Get(manga.APIProvider)
+}
+
+// Returns every provider in the order they were registered
+func (registry *Registry) List() []APIProvider {
+	providers := make([]APIProvider, len(registry.names))
+	for i, name := range registry.names {
+		providers[i] = registry.providers[name]
+	}
+
+	return providers
+}
@@ -13,6 +13,317 @@ type Response_APIKey struct {
 }
 
 type APIKeyJSON struct {
-	Key        string `json:"key"`
-	Expiration string `json:"expiration"`
+	ID         uint     `json:"id"`
+	Key        string   `json:"key,omitempty"`
+	Prefix     string   `json:"prefix"`
+	Label      string   `json:"label"`
+	Scopes     []string `json:"scopes"`
+	Expiration string   `json:"expiration"`
+	CreatedAt  string   `json:"created_at"`
+	LastUsedAt string   `json:"last_used_at,omitempty"`
+}
+
+type AccountJSON struct {
+	ID            uint   `json:"id"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	TOTPEnabled   bool   `json:"totp_enabled"`
+	Role          string `json:"role"`
+	Disabled      bool   `json:"disabled"`
+	SSO           bool   `json:"sso"` // Linked to the single sign-on identity provider
+	CreatedAt     string `json:"created_at"`
+}
+
+type Response_Accounts struct {
+	Accounts []AccountJSON `json:"accounts"`
+}
+
+type SettingsJSON struct {
+	OpenRegistration bool `json:"open_registration"`
+}
+
+type Response_Settings struct {
+	Settings SettingsJSON `json:"settings"`
+}
+
+type QueueStatusJSON struct {
+	Pending   int64 `json:"pending"`
+	Running   int64 `json:"running"`
+	Completed int64 `json:"completed"`
+	Failed    int64 `json:"failed"`
+}
+
+type StorageStatusJSON struct {
+	Manga            int64 `json:"manga"`
+	Chapters         int64 `json:"chapters"`
+	ChaptersComplete int64 `json:"chapters_complete"`
+	Pages            int64 `json:"pages"`
+	LibraryBytes     int64 `json:"library_bytes"`
+	DatabaseBytes    int64 `json:"database_bytes"`
+}
+
+type Response_ServerStatus struct {
+	Accounts int64             `json:"accounts"`
+	Queue    QueueStatusJSON   `json:"queue"`
+	Storage  StorageStatusJSON `json:"storage"`
+}
+
+type Response_TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type Response_RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type Response_Account struct {
+	Account AccountJSON `json:"account"`
+	APIKey  *APIKeyJSON `json:"api_key,omitempty"` // Replaces every key of the account after a password change
+}
+
+type Response_Message struct {
+	Message string `json:"message"`
+}
+
+type LoginAttemptJSON struct {
+	IP        string `json:"ip"`
+	Success   bool   `json:"success"`
+	Reason    string `json:"reason,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+type Response_LoginAttempts struct {
+	Attempts []LoginAttemptJSON `json:"attempts"`
+}
+
+type Response_Revoked struct {
+	Revoked int64 `json:"revoked"`
+}
+
+type Response_Job struct {
+	Job JobJSON `json:"job"`
+}
+
+type JobJSON struct {
+	ID        uint   `json:"id"`
+	Type      string `json:"type"`
+	Status    string `json:"status"`
+	ChapterID uint   `json:"chapter_id,omitempty"`
+	MangaID   uint   `json:"manga_id,omitempty"`
+	AccountID uint   `json:"account_id,omitempty"`
+	Report    string `json:"report,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Attempts  int    `json:"attempts,omitempty"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type Response_Manga struct {
+	Manga MangaJSON `json:"manga"`
+}
+
+type Response_MangaList struct {
+	Manga      []MangaJSON `json:"manga"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+type MangaJSON struct {
+	ID               uint              `json:"id"`
+	ProviderID       string            `json:"provider_id"`
+	Provider         string            `json:"provider"`
+	SeriesID         *uint             `json:"series_id,omitempty"`
+	Name             string            `json:"name"`
+	Description      string            `json:"description"`
+	Status           string            `json:"status"`
+	Year             int               `json:"year,omitempty"`
+	Demographic      string            `json:"demographic,omitempty"`
+	ContentRating    string            `json:"content_rating"`
+	OriginalLanguage string            `json:"original_language"`
+	LastVolume       string            `json:"last_volume,omitempty"`
+	LastChapter      string            `json:"last_chapter,omitempty"`
+	LastUpdated      string            `json:"last_updated"`
+	AddedAt          string            `json:"added_at"`
+	AltTitles        []string          `json:"alt_titles"`
+	Tags             []string          `json:"tags"`
+	Authors          []string          `json:"authors"`
+	Artists          []string          `json:"artists"`
+	Links            map[string]string `json:"links"`
+	Volumes          []VolumeJSON      `json:"volumes,omitempty"`
+}
+
+type VolumeJSON struct {
+	ID       uint          `json:"id"`
+	Name     string        `json:"name"`
+	Chapters []ChapterJSON `json:"chapters"`
+}
+
+type ChapterJSON struct {
+	ID                 uint   `json:"id"`
+	ProviderID         string `json:"provider_id"`
+	Volume             string `json:"volume"`
+	Chapter            string `json:"chapter"`
+	Title              string `json:"title"`
+	TranslatedLanguage string `json:"translated_language"`
+	Pages              int    `json:"pages"`
+	State              string `json:"state"`
+}
+
+type ProgressJSON struct {
+	ChapterID   uint   `json:"chapter_id"`
+	LastPage    int    `json:"last_page"`
+	Read        bool   `json:"read"`
+	CompletedAt string `json:"completed_at,omitempty"`
+	UpdatedAt   string `json:"updated_at,omitempty"`
+}
+
+type Response_Progress struct {
+	Progress ProgressJSON `json:"progress"`
+}
+
+type Response_MangaProgress struct {
+	MangaID  uint           `json:"manga_id"`
+	Read     int            `json:"read"`
+	Total    int            `json:"total"`
+	Chapters []ProgressJSON `json:"chapters"`
+}
+
+type Response_MarkRead struct {
+	Updated int `json:"updated"`
+}
+
+type ContinueReadingJSON struct {
+	Manga    MangaJSON    `json:"manga"`
+	Chapter  ChapterJSON  `json:"chapter"`
+	Progress ProgressJSON `json:"progress"`
+}
+
+type Response_ContinueReading struct {
+	Continue []ContinueReadingJSON `json:"continue"`
+}
+
+type CategoryJSON struct {
+	ID       uint   `json:"id"`
+	Name     string `json:"name"`
+	MangaIDs []uint `json:"manga_ids"`
+}
+
+type Response_Categories struct {
+	Categories []CategoryJSON `json:"categories"`
+}
+
+type SkippedMangaJSON struct {
+	Title  string `json:"title"`
+	Source string `json:"source"`
+	Reason string `json:"reason"`
+}
+
+type Response_LibraryImport struct {
+	Added    []MangaJSON        `json:"added"`
+	Existing []MangaJSON        `json:"existing"`
+	Skipped  []SkippedMangaJSON `json:"skipped"`
+	Progress int                `json:"progress"` // Chapters whose reading progress was imported
+}
+
+type MangaDexLinkJSON struct {
+	Username        string `json:"username"`
+	ClientID        string `json:"client_id"`
+	PushReadMarkers bool   `json:"push_read_markers"`
+	LastSyncAt      string `json:"last_sync_at,omitempty"`
+}
+
+type Response_MangaDexLink struct {
+	Link MangaDexLinkJSON `json:"link"`
+}
+
+type TrackerAccountJSON struct {
+	Tracker   string `json:"tracker"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+}
+
+type Response_Trackers struct {
+	Available []string             `json:"available"`
+	Linked    []TrackerAccountJSON `json:"linked"`
+}
+
+type Response_TrackerAccount struct {
+	Tracker TrackerAccountJSON `json:"tracker"`
+}
+
+type TrackerEntryJSON struct {
+	Tracker  string  `json:"tracker"`
+	MangaID  uint    `json:"manga_id"`
+	RemoteID string  `json:"remote_id"`
+	Status   string  `json:"status,omitempty"`
+	Score    float64 `json:"score"`
+	Progress int     `json:"progress"`
+	SyncedAt string  `json:"synced_at,omitempty"`
+}
+
+type Response_TrackerEntry struct {
+	Entry TrackerEntryJSON `json:"entry"`
+}
+
+type Response_TrackerEntries struct {
+	Entries []TrackerEntryJSON `json:"entries"`
+}
+
+type PageJSON struct {
+	Page   int    `json:"page"`
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Size   int64  `json:"size"`
+	Hash   string `json:"hash"`
+}
+
+type Response_Manifest struct {
+	Chapter ChapterJSON `json:"chapter"`
+	Pages   []PageJSON  `json:"pages"`
+}
+
+type Response_Providers struct {
+	Providers []ProviderJSON `json:"providers"`
+}
+
+type ProviderJSON struct {
+	Name      string   `json:"name"`
+	Default   bool     `json:"default"`
+	Search    bool     `json:"search"`
+	Feed      bool     `json:"feed"`
+	Datasaver bool     `json:"datasaver"`
+	Languages []string `json:"languages"`
+}
+
+type Response_Series struct {
+	Series SeriesJSON `json:"series"`
+}
+
+type SeriesJSON struct {
+	ID       uint                `json:"id"`
+	Name     string              `json:"name"`
+	Manga    []MangaJSON         `json:"manga"`
+	Chapters []MergedChapterJSON `json:"chapters"`
+}
+
+type MergedChapterJSON struct {
+	Key      string              `json:"key"`
+	Selected ChapterSourceJSON   `json:"selected"`
+	Sources  []ChapterSourceJSON `json:"sources"`
+}
+
+type ChapterSourceJSON struct {
+	ChapterJSON
+	MangaID  uint   `json:"manga_id"`
+	Provider string `json:"provider"`
+}
+
+type Response_Duplicates struct {
+	Duplicates []DuplicateJSON `json:"duplicates"`
+}
+
+type DuplicateJSON struct {
+	Manga   []MangaJSON `json:"manga"`
+	Reasons []string    `json:"reasons"`
 }
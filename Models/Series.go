@@ -0,0 +1,261 @@
+package Models
+
+import (
+	"encoding/json"
+	"gorm.io/gorm"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A series available from several providers, grouping the manga added from each of them
+type Series struct {
+	gorm.Model
+	Name    string
+	Manga   []Manga         `gorm:"foreignKey:SeriesID"`
+	Sources []ChapterSource `gorm:"foreignKey:SeriesID"`
+}
+
+// The chapter picked to read a chapter number of a series from
+type ChapterSource struct {
+	gorm.Model
+	SeriesID  uint   `gorm:"uniqueIndex:idx_source_series_chapter"`
+	Key       string `gorm:"uniqueIndex:idx_source_series_chapter"` // ChapterKey of the chapter
+	ChapterID uint
+}
+
+// A chapter number of a series with the chapters every provider has for it
+type MergedChapter struct {
+	Key      string
+	Selected *Chapter
+	Sources  []*Chapter
+}
+
+// Duplicate manga that may be the same series, with what they have in common
+type DuplicateGroup struct {
+	Manga   []Manga
+	Reasons []string
+}
+
+type CreateSeriesRequest struct {
+	Name     string `json:"name"`
+	MangaIDs []uint `json:"manga_ids" binding:"required,min=2"`
+}
+
+// Drops repeated manga ids while decoding, so validation counts distinct manga
+func (request *CreateSeriesRequest) UnmarshalJSON(data []byte) error {
+	type plain CreateSeriesRequest
+	if err := json.Unmarshal(data, (*plain)(request)); err != nil {
+		return err
+	}
+
+	seen := make(map[uint]bool)
+	unique := []uint{}
+	for _, id := range request.MangaIDs {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	if request.MangaIDs != nil {
+		request.MangaIDs = unique
+	}
+
+	return nil
+}
+
+type LinkMangaRequest struct {
+	MangaID uint `json:"manga_id" binding:"required"`
+}
+
+type SelectSourceRequest struct {
+	ChapterID uint `json:"chapter_id" binding:"required"`
+}
+
+// Returns the key matching a chapter across providers, its number when it has one
+func ChapterKey(chapter *Chapter) string {
+	_, number := chapter.ReadingOrder()
+	if math.IsInf(number, 1) {
+		return strings.ToLower(strings.TrimSpace(chapter.Chapter))
+	}
+
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
+
+// Returns a title reduced to lowercase letters and digits for comparison
+func NormalizeTitle(title string) string {
+	// Drop a leading "the" word, not the start of a word like "Theater"
+	title = strings.ToLower(strings.TrimSpace(title))
+	if fields := strings.Fields(title); len(fields) > 1 && fields[0] == "the" {
+		title = strings.TrimSpace(strings.TrimPrefix(title, "the"))
+	}
+
+	var builder strings.Builder
+	for _, r := range title {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			builder.WriteRune(r)
+		}
+	}
+
+	return builder.String()
+}
+
+// Merges the chapter lists of the series' manga by chapter number, in reading order
+// The manga's chapters must be loaded, only chapters sorted into volumes are used
+// A chapter without a source picked for it reads from the first downloaded copy, or else the first manga linked
+func (series *Series) MergeChapters() []MergedChapter {
+	selected := make(map[string]uint)
+	for _, source := range series.Sources {
+		selected[source.Key] = source.ChapterID
+	}
+
+	sort.SliceStable(series.Manga, func(i, j int) bool {
+		return series.Manga[i].MangaID < series.Manga[j].MangaID
+	})
+
+	byKey := make(map[string]*MergedChapter)
+	merged := []*MergedChapter{}
+	for i := range series.Manga {
+		manga := &series.Manga[i]
+		for j := range manga.Chapters {
+			chapter := &manga.Chapters[j]
+			if chapter.VolumeID == 0 {
+				continue
+			}
+			chapter.Manga = manga
+
+			key := ChapterKey(chapter)
+			entry, ok := byKey[key]
+			if !ok {
+				entry = &MergedChapter{Key: key}
+				byKey[key] = entry
+				merged = append(merged, entry)
+			}
+			entry.Sources = append(entry.Sources, chapter)
+		}
+	}
+
+	for _, entry := range merged {
+		for _, chapter := range entry.Sources {
+			if chapter.ChapterID == selected[entry.Key] {
+				entry.Selected = chapter
+				break
+			}
+		}
+
+		if entry.Selected == nil {
+			for _, chapter := range entry.Sources {
+				if chapter.State == ChapterComplete {
+					entry.Selected = chapter
+					break
+				}
+			}
+		}
+
+		if entry.Selected == nil {
+			entry.Selected = entry.Sources[0]
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		volumeI, chapterI := merged[i].Selected.ReadingOrder()
+		volumeJ, chapterJ := merged[j].Selected.ReadingOrder()
+		if chapterI != chapterJ {
+			return chapterI < chapterJ
+		}
+		return volumeI < volumeJ
+	})
+
+	list := make([]MergedChapter, len(merged))
+	for i := range merged {
+		list[i] = *merged[i]
+	}
+
+	return list
+}
+
+// Returns the keys a manga can be matched to duplicates on:
+// its normalized titles and the ids it has on other sites
+func DuplicateKeys(manga *Manga) []string {
+	keys := []string{}
+
+	titles := []string{manga.Name}
+	for _, title := range manga.AltTitles {
+		titles = append(titles, title.Title)
+	}
+	for _, title := range titles {
+		if normalized := NormalizeTitle(title); normalized != "" {
+			keys = append(keys, "title:"+normalized)
+		}
+	}
+
+	for _, link := range manga.Links {
+		if link.Value != "" {
+			keys = append(keys, "link:"+link.Site+":"+strings.ToLower(link.Value))
+		}
+	}
+
+	// Other providers can link back to MangaDex under its site code
+	if manga.APIProvider == "mangadex" {
+		keys = append(keys, "link:md:"+strings.ToLower(manga.ID))
+	}
+
+	return keys
+}
+
+// Converts a series to a JSON object with its merged chapter list
+func (series *Series) ToJSON() SeriesJSON {
+	manga := make([]MangaJSON, len(series.Manga))
+	for i := range series.Manga {
+		manga[i] = series.Manga[i].ToJSON()
+	}
+
+	merged := series.MergeChapters()
+	chapters := make([]MergedChapterJSON, len(merged))
+	for i, entry := range merged {
+		sources := make([]ChapterSourceJSON, len(entry.Sources))
+		for j, chapter := range entry.Sources {
+			sources[j] = chapterSourceJSON(chapter)
+		}
+
+		chapters[i] = MergedChapterJSON{
+			Key:      entry.Key,
+			Selected: chapterSourceJSON(entry.Selected),
+			Sources:  sources,
+		}
+	}
+
+	return SeriesJSON{
+		ID:       series.ID,
+		Name:     series.Name,
+		Manga:    manga,
+		Chapters: chapters,
+	}
+}
+
+func chapterSourceJSON(chapter *Chapter) ChapterSourceJSON {
+	source := ChapterSourceJSON{
+		ChapterJSON: chapter.ToJSON(),
+		MangaID:     chapter.MangaID,
+	}
+	if chapter.Manga != nil {
+		source.Provider = chapter.Manga.APIProvider
+	}
+
+	return source
+}
+
+// Converts a group of duplicates to a JSON object
+func (group *DuplicateGroup) ToJSON() DuplicateJSON {
+	manga := make([]MangaJSON, len(group.Manga))
+	for i := range group.Manga {
+		manga[i] = group.Manga[i].ToJSON()
+	}
+
+	return DuplicateJSON{
+		Manga:   manga,
+		Reasons: group.Reasons,
+	}
+}
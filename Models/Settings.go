@@ -0,0 +1,21 @@
+package Models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Settings of the server that admins can change while it runs, stored in a single row
+type Settings struct {
+	gorm.Model
+	OpenRegistration bool // Anyone can register, otherwise only the first account can
+}
+
+type UpdateSettingsRequest struct {
+	OpenRegistration *bool `json:"open_registration"`
+}
+
+func (settings *Settings) ToJSON() SettingsJSON {
+	return SettingsJSON{
+		OpenRegistration: settings.OpenRegistration,
+	}
+}
@@ -0,0 +1,104 @@
+package Models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// Reading statuses shared by every tracker, each tracker maps them to its own
+const (
+	TrackReading    = "reading"
+	TrackCompleted  = "completed"
+	TrackOnHold     = "on_hold"
+	TrackDropped    = "dropped"
+	TrackPlanToRead = "plan_to_read"
+	TrackRereading  = "rereading"
+)
+
+// The login of an account on a tracker like AniList or MyAnimeList
+type TrackerAccount struct {
+	gorm.Model
+	AccountID uint   `gorm:"uniqueIndex:idx_tracker_account"`
+	Tracker   string `gorm:"uniqueIndex:idx_tracker_account"`
+
+	AccessToken  string
+	RefreshToken string
+	ClientID     string    // OAuth client the tokens were issued to, needed to refresh them
+	ExpiresAt    time.Time // Zero if the access token does not expire
+}
+
+// A manga of the library linked to its entry on a tracker, for an account
+type TrackerEntry struct {
+	gorm.Model
+	AccountID uint   `gorm:"uniqueIndex:idx_tracker_entry"`
+	MangaID   uint   `gorm:"uniqueIndex:idx_tracker_entry"`
+	Tracker   string `gorm:"uniqueIndex:idx_tracker_entry"`
+	RemoteID  string // Id of the manga on the tracker
+
+	Status   string  // Status picked by the account, empty to follow the reading progress
+	Score    float64 // Out of 10, 0 if not scored
+	Progress int     // Last chapter count pushed to the tracker
+	SyncedAt *time.Time
+}
+
+type LinkTrackerRequest struct {
+	AccessToken  string `json:"access_token" binding:"required"`
+	RefreshToken string `json:"refresh_token"`
+	ClientID     string `json:"client_id"`
+	ExpiresIn    int    `json:"expires_in"` // Seconds, 0 if the token does not expire
+}
+
+type TrackMangaRequest struct {
+	RemoteID string  `json:"remote_id"` // Matched from the links of the manga if empty
+	Status   string  `json:"status" binding:"omitempty,oneof=reading completed on_hold dropped plan_to_read rereading"`
+	Score    float64 `json:"score" binding:"min=0,max=10"`
+}
+
+// Picks the status to send to the tracker from the reading progress
+// A status picked by the account wins, except that reading a finished manga to the end completes it
+func (entry *TrackerEntry) ResolveStatus(progress int, allRead bool, finished bool) string {
+	completed := allRead && finished
+	if entry.Status != "" && !(completed && entry.Status == TrackReading) {
+		return entry.Status
+	}
+
+	switch {
+	case completed:
+		return TrackCompleted
+	case progress > 0:
+		return TrackReading
+	default:
+		return TrackPlanToRead
+	}
+}
+
+// Converts a tracker login to a JSON object, leaving out the tokens
+func (account *TrackerAccount) ToJSON() TrackerAccountJSON {
+	expiresAt := ""
+	if !account.ExpiresAt.IsZero() {
+		expiresAt = account.ExpiresAt.Format(time.RFC3339)
+	}
+
+	return TrackerAccountJSON{
+		Tracker:   account.Tracker,
+		ExpiresAt: expiresAt,
+	}
+}
+
+// Converts a tracker entry to a JSON object
+func (entry *TrackerEntry) ToJSON() TrackerEntryJSON {
+	syncedAt := ""
+	if entry.SyncedAt != nil {
+		syncedAt = entry.SyncedAt.Format(time.RFC3339)
+	}
+
+	return TrackerEntryJSON{
+		Tracker:  entry.Tracker,
+		MangaID:  entry.MangaID,
+		RemoteID: entry.RemoteID,
+		Status:   entry.Status,
+		Score:    entry.Score,
+		Progress: entry.Progress,
+		SyncedAt: syncedAt,
+	}
+}
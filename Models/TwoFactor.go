@@ -0,0 +1,69 @@
+package Models
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/golang/glog"
+	"gorm.io/gorm"
+	"strings"
+)
+
+// RecoveryCode logs in to an account with two-factor authentication when the authenticator is lost
+// Each code works once, only the digest is stored
+type RecoveryCode struct {
+	gorm.Model
+	AccountID uint   `gorm:"index"`
+	Digest    string `gorm:"index"`
+}
+
+type PasswordRequest struct {
+	Password string `json:"password"` // Not needed by accounts created through single sign-on
+}
+
+type OTPRequest struct {
+	OTP string `json:"otp" binding:"required"` // TOTP or recovery code
+}
+
+type DisableTOTPRequest struct {
+	Password string `json:"password"`               // Not needed by accounts created through single sign-on
+	OTP      string `json:"otp" binding:"required"` // TOTP or recovery code
+}
+
+// Letters of recovery codes, without the ones that are easy to mix up
+// 32 of them so every random byte maps to a letter evenly
+const recoveryAlphabet = "abcdefghjkmnpqrstvwxyz0123456789"
+
+// NewRecoveryCodes Generates recovery codes like "abcde-fghjk"
+// Returns the codes to store and the plaintext to show
+func NewRecoveryCodes(account *Account, count int) ([]RecoveryCode, []string, error) {
+	codes := make([]RecoveryCode, count)
+	plaintext := make([]string, count)
+	for i := range codes {
+		bytes := make([]byte, 10)
+		if _, err := rand.Read(bytes); err != nil {
+			err = fmt.Errorf("Error generating recovery codes: %v", err)
+			glog.Error(err)
+			return nil, nil, err
+		}
+
+		var code strings.Builder
+		for j, b := range bytes {
+			if j == 5 {
+				code.WriteByte('-')
+			}
+			code.WriteByte(recoveryAlphabet[int(b)%len(recoveryAlphabet)])
+		}
+
+		plaintext[i] = code.String()
+		codes[i] = RecoveryCode{AccountID: account.ID, Digest: HashRecoveryCode(plaintext[i])}
+	}
+
+	return codes, plaintext, nil
+}
+
+// HashRecoveryCode Gets the digest of a recovery code, ignoring case, spaces and dashes
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return HashAPIKey(code)
+}
@@ -4,39 +4,61 @@ import (
 	"fmt"
 	"github.com/golang/glog"
 	"gorm.io/gorm"
+	"sort"
 )
 
 type Volume struct {
 	gorm.Model
 	MangaID  uint
-	VolumeID uint `gorm:"primaryKey:true"`
 
 	Name     string
 	Chapters []Chapter `gorm:"foreignKey:VolumeID"`
 }
 
 // This downloads all the chapters in a volume
-func (volume *Volume) Download(API APIProvider, datasaver bool) error {
+func (volume *Volume) Download(API APIProvider, datasaver bool, store DownloadStore) error {
 	var volumeName string
 
 	// loops through the chapters
-	count := 0
-	for _, chapter := range volume.Chapters {
+	for i := range volume.Chapters {
+		chapter := &volume.Chapters[i]
+
 		// Get the volume name
-		if count == 0 {
+		if i == 0 {
 			volumeName = chapter.Volume
 		}
 
-		err := chapter.Download(API, datasaver)
+		err := chapter.Download(API, datasaver, store)
 		if err != nil {
 			err = fmt.Errorf("failed to download chapter %s", chapter.ID)
 			glog.Error(err)
 			return err
 		}
-
-		count++
 	}
 
 	glog.Info("Successfully downloaded volume: ", volumeName)
 	return nil
 }
+
+// Converts a volume and its chapters to a JSON object
+func (volume *Volume) ToJSON() VolumeJSON {
+	chapters := make([]ChapterJSON, len(volume.Chapters))
+	for i := range volume.Chapters {
+		chapters[i] = volume.Chapters[i].ToJSON()
+	}
+
+	return VolumeJSON{
+		ID:       volume.ID,
+		Name:     volume.Name,
+		Chapters: chapters,
+	}
+}
+
+// Sorts volumes by volume number, volumes without a number go last
+func SortVolumes(volumes []Volume) {
+	sort.SliceStable(volumes, func(i, j int) bool {
+		volumeI, _ := (&Chapter{Volume: volumes[i].Name}).ReadingOrder()
+		volumeJ, _ := (&Chapter{Volume: volumes[j].Name}).ReadingOrder()
+		return volumeI < volumeJ
+	})
+}
@@ -0,0 +1,187 @@
+package OIDC
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/CookieUzen/mangascribe/Models"
+)
+
+// Fake A local OpenID Connect identity provider signing ID tokens with an RSA and an EC key, for tests
+// Its clients authenticate with ClientID and ClientSecret, and logins are approved with Authorize
+type Fake struct {
+	Server       *httptest.Server
+	ClientID     string
+	ClientSecret string
+	Claims       map[string]any // Claims of the next ID tokens, on top of iss, aud, exp, iat and nonce
+	Alg          string         // RS256 or ES256
+	Sign         func(header []byte, payload []byte) string
+
+	mutex       sync.Mutex
+	rsaKey      *rsa.PrivateKey
+	ecKey       *ecdsa.PrivateKey
+	codes       map[string]struct{ challenge, nonce string } // Authorization codes handed out, with the challenge and nonce of their login
+	Discoveries int                                          // Requests for the OpenID configuration
+	KeyFetches  int                                          // Requests for the signing keys
+}
+
+// NewFake Starts a fake identity provider, close its Server when done
+func NewFake() *Fake {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to generate an RSA key: %v", err))
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to generate an EC key: %v", err))
+	}
+
+	fake := &Fake{
+		ClientID:     "mangascribe",
+		ClientSecret: "secret",
+		Alg:          "RS256",
+		rsaKey:       rsaKey,
+		ecKey:        ecKey,
+		codes:        map[string]struct{ challenge, nonce string }{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", fake.configuration)
+	mux.HandleFunc("/jwks", fake.jwks)
+	mux.HandleFunc("/token", fake.token)
+	fake.Server = httptest.NewServer(mux)
+
+	return fake
+}
+
+func (fake *Fake) URL() string {
+	return fake.Server.URL
+}
+
+// Provider Gets a confidential client of the fake
+func (fake *Fake) Provider() *Provider {
+	return &Provider{
+		Issuer:       fake.URL(),
+		ClientID:     fake.ClientID,
+		ClientSecret: fake.ClientSecret,
+		RedirectURL:  "http://localhost:8080/v1/oidc/callback",
+		Scopes:       []string{"openid", "email"},
+		GroupsClaim:  "groups",
+		DefaultRole:  Models.RoleUser,
+	}
+}
+
+// Authorize Does what the login page of the fake would, returning the code of a login started at the URL
+func (fake *Fake) Authorize(authURL string) (string, error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		return "", fmt.Errorf("Login without a PKCE challenge: %s", authURL)
+	}
+
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	code := "code-" + q.Get("state")
+	fake.codes[code] = struct{ challenge, nonce string }{q.Get("code_challenge"), q.Get("nonce")}
+	return code, nil
+}
+
+func (fake *Fake) configuration(w http.ResponseWriter, r *http.Request) {
+	fake.mutex.Lock()
+	fake.Discoveries++
+	fake.mutex.Unlock()
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"issuer":                 fake.URL(),
+		"authorization_endpoint": fake.URL() + "/authorize",
+		"token_endpoint":         fake.URL() + "/token",
+		"jwks_uri":               fake.URL() + "/jwks",
+	})
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (fake *Fake) jwks(w http.ResponseWriter, r *http.Request) {
+	fake.mutex.Lock()
+	fake.KeyFetches++
+	fake.mutex.Unlock()
+
+	json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+		{"kid": "rsa", "kty": "RSA", "use": "sig", "n": encode(fake.rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(fake.rsaKey.E)).Bytes())},
+		{"kid": "ec", "kty": "EC", "crv": "P-256", "x": encode(fake.ecKey.X.FillBytes(make([]byte, 32))), "y": encode(fake.ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kid": "enc", "kty": "RSA", "use": "enc", "n": encode(fake.rsaKey.N.Bytes()), "e": "AQAB"},
+	}})
+}
+
+// token Trades a code for an ID token, if the client and PKCE verifier match
+func (fake *Fake) token(w http.ResponseWriter, r *http.Request) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	r.ParseForm()
+	login, ok := fake.codes[r.PostForm.Get("code")]
+	delete(fake.codes, r.PostForm.Get("code"))
+
+	id, secret, _ := r.BasicAuth()
+	if !ok || id != fake.ClientID || secret != fake.ClientSecret || r.PostForm.Get("grant_type") != "authorization_code" ||
+		Challenge(r.PostForm.Get("code_verifier")) != login.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := map[string]any{
+		"iss":   fake.URL(),
+		"aud":   fake.ClientID,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": login.nonce,
+	}
+	for name, value := range fake.Claims {
+		claims[name] = value
+	}
+
+	kid := map[string]string{"RS256": "rsa", "ES256": "ec"}[fake.Alg]
+	header, _ := json.Marshal(map[string]string{"alg": fake.Alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	sign := fake.Sign
+	if sign == nil {
+		sign = fake.sign
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": sign(header, payload), "token_type": "Bearer"})
+}
+
+// sign Signs a JWT with the key of the algorithm in the header
+func (fake *Fake) sign(header []byte, payload []byte) string {
+	signed := encode(header) + "." + encode(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	if fake.Alg == "ES256" {
+		r, s, _ := ecdsa.Sign(rand.Reader, fake.ecKey, digest[:])
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	} else {
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, fake.rsaKey, crypto.SHA256, digest[:])
+	}
+
+	return signed + "." + encode(signature)
+}
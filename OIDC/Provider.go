@@ -0,0 +1,213 @@
+package OIDC
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/Tools"
+	"github.com/golang/glog"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider Logs accounts in through an OpenID Connect identity provider
+// with the authorization code flow and PKCE
+type Provider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // Empty for public clients, PKCE protects the code either way
+	RedirectURL  string
+	Scopes       []string
+	GroupsClaim  string            // Claim of the ID token listing the groups of the user
+	GroupRoles   map[string]string // Role given to the members of each group
+	DefaultRole  string            // Role of users in none of the groups
+	LinkByEmail  bool              // Link existing accounts with the same verified email
+
+	mutex       sync.Mutex
+	discovery   *discovery
+	keys        map[string]crypto.PublicKey // Signing keys of the issuer, by key id
+	keysFetched time.Time                   // When the signing keys were last fetched
+}
+
+// discovery is the part of the OpenID configuration of an issuer that is used
+type discovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	AuthMethods           []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+type tokenResponse struct {
+	IDToken string `json:"id_token"`
+}
+
+// Default Gets the provider set up in the config, nil if single sign-on is off
+func Default() *Provider {
+	if Config.OIDC_ISSUER == "" {
+		return nil
+	}
+
+	return &Provider{
+		Issuer:       Config.OIDC_ISSUER,
+		ClientID:     Config.OIDC_CLIENT_ID,
+		ClientSecret: os.Getenv(Config.OIDC_CLIENT_SECRET_ENV),
+		RedirectURL:  Config.PUBLIC_URL + "/v1/oidc/callback",
+		Scopes:       Config.OIDC_SCOPES,
+		GroupsClaim:  Config.OIDC_GROUPS_CLAIM,
+		GroupRoles:   Config.OIDC_GROUP_ROLES,
+		DefaultRole:  Config.OIDC_DEFAULT_ROLE,
+		LinkByEmail:  Config.OIDC_LINK_BY_EMAIL,
+	}
+}
+
+// discover Fetches the OpenID configuration of the issuer, once it succeeds it is kept
+func (provider *Provider) discover() (*discovery, error) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	if provider.discovery != nil {
+		return provider.discovery, nil
+	}
+
+	body, err := Tools.RequestGET(strings.TrimSuffix(provider.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		err = fmt.Errorf("Failed to fetch the OpenID configuration: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	var config discovery
+	if err := json.Unmarshal(body, &config); err != nil {
+		err = fmt.Errorf("Failed to parse the OpenID configuration: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	// The issuer has to be exactly the one configured, or its tokens would not match
+	if config.Issuer != provider.Issuer {
+		err = fmt.Errorf("OpenID configuration is for issuer %s instead of %s", config.Issuer, provider.Issuer)
+		glog.Error(err)
+		return nil, err
+	}
+	if config.AuthorizationEndpoint == "" || config.TokenEndpoint == "" || config.JWKSURI == "" {
+		err = fmt.Errorf("OpenID configuration is missing an endpoint")
+		glog.Error(err)
+		return nil, err
+	}
+
+	provider.discovery = &config
+	return provider.discovery, nil
+}
+
+// AuthURL Returns the URL to send the user to, to log in at the identity provider
+// state and nonce tie the answer to this login, the verifier is only sent as its challenge
+func (provider *Provider) AuthURL(state string, nonce string, verifier string) (string, error) {
+	config, err := provider.discover()
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(config.AuthorizationEndpoint)
+	if err != nil {
+		err = fmt.Errorf("Invalid authorization endpoint: %v", err)
+		glog.Error(err)
+		return "", err
+	}
+
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", provider.ClientID)
+	q.Set("redirect_uri", provider.RedirectURL)
+	q.Set("scope", strings.Join(provider.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", Challenge(verifier))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange Trades an authorization code for the ID token of the user, and verifies it
+func (provider *Provider) Exchange(code string, verifier string, nonce string) (*Claims, error) {
+	config, err := provider.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {provider.RedirectURL},
+		"client_id":     {provider.ClientID},
+		"code_verifier": {verifier},
+	}
+	headers := map[string]string{"Accept": "application/json"}
+
+	// Basic authentication is the default when the issuer does not list its methods
+	if provider.ClientSecret != "" {
+		if len(config.AuthMethods) == 0 || contains(config.AuthMethods, "client_secret_basic") {
+			headers["Authorization"] = "Basic " + basicAuth(provider.ClientID, provider.ClientSecret)
+		} else {
+			form.Set("client_secret", provider.ClientSecret)
+		}
+	}
+
+	body, err := Tools.RequestPOST(config.TokenEndpoint, "application/x-www-form-urlencoded", []byte(form.Encode()), headers)
+	if err != nil {
+		err = fmt.Errorf("Failed to exchange the authorization code: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil || token.IDToken == "" {
+		err = fmt.Errorf("Identity provider did not return an ID token")
+		glog.Error(err)
+		return nil, err
+	}
+
+	return provider.verify(token.IDToken, nonce)
+}
+
+// Role Returns the role for a user in the groups, the most powerful one if several groups match
+func (provider *Provider) Role(groups []string) string {
+	rank := map[string]int{Models.RoleReadOnly: 1, Models.RoleUser: 2, Models.RoleAdmin: 3}
+
+	role := provider.DefaultRole
+	matched := false
+	for _, group := range groups {
+		mapped, ok := provider.GroupRoles[group]
+		if !ok {
+			continue
+		}
+
+		if !matched || rank[mapped] > rank[role] {
+			role = mapped
+			matched = true
+		}
+	}
+
+	return role
+}
+
+// MapsGroups Checks if roles come from the groups of the users
+func (provider *Provider) MapsGroups() bool {
+	return len(provider.GroupRoles) > 0
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,267 @@
+package OIDC
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CookieUzen/mangascribe/Models"
+)
+
+// newIssuer Starts a fake identity provider, closed at the end of the test
+func newIssuer(t *testing.T) *Fake {
+	t.Helper()
+
+	idp := NewFake()
+	t.Cleanup(idp.Server.Close)
+	return idp
+}
+
+// authorize Approves a login started at the URL, returning its code
+func authorize(t *testing.T, idp *Fake, authURL string) string {
+	t.Helper()
+
+	code, err := idp.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// login Runs a whole login against the issuer, returning what Exchange does
+func login(t *testing.T, idp *Fake, provider *Provider) (*Claims, error) {
+	t.Helper()
+
+	verifier, _ := RandomString()
+	authURL, err := provider.AuthURL("state", "nonce", verifier)
+	if err != nil {
+		t.Fatalf("AuthURL: %v", err)
+	}
+
+	return provider.Exchange(authorize(t, idp, authURL), verifier, "nonce")
+}
+
+func TestLogin(t *testing.T) {
+	idp := newIssuer(t)
+	idp.Claims = map[string]any{"sub": "alice-id", "email": "alice@example.com", "email_verified": "true", "preferred_username": "alice", "groups": []string{"readers"}}
+	provider := idp.Provider()
+
+	verifier, _ := RandomString()
+	authURL, err := provider.AuthURL("state", "nonce", verifier)
+	if err != nil {
+		t.Fatalf("AuthURL: %v", err)
+	}
+
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	if u.Path != "/authorize" || q.Get("response_type") != "code" || q.Get("client_id") != "mangascribe" ||
+		q.Get("redirect_uri") != provider.RedirectURL || q.Get("scope") != "openid email" || q.Get("state") != "state" || q.Get("nonce") != "nonce" {
+		t.Errorf("got authorization URL %s", authURL)
+	}
+	if q.Get("code_challenge") != Challenge(verifier) || strings.Contains(authURL, verifier) {
+		t.Errorf("got challenge %q for verifier %q", q.Get("code_challenge"), verifier)
+	}
+
+	claims, err := provider.Exchange(authorize(t, idp, authURL), verifier, "nonce")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	if claims.Subject != "alice-id" || claims.Email != "alice@example.com" || !bool(claims.EmailVerified) || claims.PreferredUsername != "alice" {
+		t.Errorf("got claims %+v", claims)
+	}
+	if len(claims.Groups) != 1 || claims.Groups[0] != "readers" {
+		t.Errorf("got groups %v", claims.Groups)
+	}
+
+	// The configuration and keys are kept for the next logins
+	if _, err := login(t, idp, provider); err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	if idp.Discoveries != 1 {
+		t.Errorf("fetched the configuration %d times, want 1", idp.Discoveries)
+	}
+}
+
+func TestLoginWithECKey(t *testing.T) {
+	idp := newIssuer(t)
+	idp.Alg = "ES256"
+	idp.Claims = map[string]any{"sub": "bob-id", "groups": "admins"}
+
+	claims, err := login(t, idp, idp.Provider())
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if claims.Subject != "bob-id" || len(claims.Groups) != 1 || claims.Groups[0] != "admins" {
+		t.Errorf("got claims %+v", claims)
+	}
+}
+
+func TestPKCE(t *testing.T) {
+	idp := newIssuer(t)
+	idp.Claims = map[string]any{"sub": "alice-id"}
+	provider := idp.Provider()
+
+	verifier, _ := RandomString()
+	authURL, err := provider.AuthURL("state", "nonce", verifier)
+	if err != nil {
+		t.Fatalf("AuthURL: %v", err)
+	}
+
+	// A stolen code is useless without the verifier kept by the login
+	other, _ := RandomString()
+	if _, err := provider.Exchange(authorize(t, idp, authURL), other, "nonce"); err == nil {
+		t.Fatal("exchanged a code with the wrong verifier")
+	}
+}
+
+func TestRejectedTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims map[string]any
+		nonce  string
+		sign   func(idp *Fake) func(header []byte, payload []byte) string
+		reason string
+	}{
+		{name: "wrong issuer", claims: map[string]any{"iss": "https://evil.example.com"}, reason: "wrong issuer"},
+		{name: "wrong audience", claims: map[string]any{"aud": "someone-else"}, reason: "wrong audience"},
+		{name: "other authorized party", claims: map[string]any{"aud": []string{"mangascribe", "someone-else"}, "azp": "someone-else"}, reason: "wrong authorized party"},
+		{name: "expired", claims: map[string]any{"exp": time.Now().Add(-2 * clockLeeway).Unix()}, reason: "expired"},
+		{name: "wrong nonce", nonce: "replayed", reason: "wrong nonce"},
+		{name: "no subject", claims: map[string]any{"sub": ""}, reason: "missing subject"},
+		{
+			name: "bad signature",
+			sign: func(idp *Fake) func([]byte, []byte) string {
+				return func(header []byte, payload []byte) string {
+					signed := strings.Split(idp.sign(header, payload), ".")
+					forged, _ := json.Marshal(map[string]any{"iss": idp.URL(), "aud": "mangascribe", "exp": time.Now().Add(time.Hour).Unix(), "nonce": "nonce", "sub": "admin-id"})
+					return signed[0] + "." + encode(forged) + "." + signed[2]
+				}
+			},
+			reason: "bad signature",
+		},
+		{
+			name: "unsigned",
+			sign: func(idp *Fake) func([]byte, []byte) string {
+				return func(header []byte, payload []byte) string {
+					return encode([]byte(`{"alg":"none","kid":"rsa"}`)) + "." + encode(payload) + "."
+				}
+			},
+			reason: "unsupported algorithm none",
+		},
+		{
+			name: "unknown key",
+			sign: func(idp *Fake) func([]byte, []byte) string {
+				return func(header []byte, payload []byte) string {
+					return encode([]byte(`{"alg":"RS256","kid":"missing"}`)) + "." + encode(payload) + ".c2ln"
+				}
+			},
+			reason: "unknown signing key missing",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			idp := newIssuer(t)
+			idp.Claims = map[string]any{"sub": "alice-id"}
+			for name, value := range test.claims {
+				idp.Claims[name] = value
+			}
+			if test.sign != nil {
+				idp.Sign = test.sign(idp)
+			}
+
+			provider := idp.Provider()
+			verifier, _ := RandomString()
+			authURL, err := provider.AuthURL("state", "nonce", verifier)
+			if err != nil {
+				t.Fatalf("AuthURL: %v", err)
+			}
+
+			nonce := "nonce"
+			if test.nonce != "" {
+				nonce = test.nonce
+			}
+
+			claims, err := provider.Exchange(authorize(t, idp, authURL), verifier, nonce)
+			if err == nil {
+				t.Fatalf("accepted the token: %+v", claims)
+			}
+			if !strings.Contains(err.Error(), test.reason) {
+				t.Errorf("got error %q, want %q", err, test.reason)
+			}
+		})
+	}
+}
+
+func TestUnknownKeyRefetch(t *testing.T) {
+	idp := newIssuer(t)
+	idp.Claims = map[string]any{"sub": "alice-id"}
+	provider := idp.Provider()
+
+	if _, err := login(t, idp, provider); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	idp.Sign = func(header []byte, payload []byte) string {
+		return encode([]byte(`{"alg":"RS256","kid":"missing"}`)) + "." + encode(payload) + ".c2ln"
+	}
+
+	// The keys were just fetched by the first login, so unknown keys do not fetch them again
+	for i := 0; i < 3; i++ {
+		if _, err := login(t, idp, provider); err == nil || !strings.Contains(err.Error(), "unknown signing key missing") {
+			t.Fatalf("got error %v, want an unknown signing key", err)
+		}
+	}
+	if idp.KeyFetches != 1 {
+		t.Errorf("fetched the keys %d times within the interval, want 1", idp.KeyFetches)
+	}
+
+	provider.keysFetched = time.Now().Add(-keyRefetchInterval)
+	if _, err := login(t, idp, provider); err == nil {
+		t.Fatal("accepted a token signed with an unknown key")
+	}
+	if idp.KeyFetches != 2 {
+		t.Errorf("fetched the keys %d times after the interval, want 2", idp.KeyFetches)
+	}
+}
+
+func TestWrongIssuerConfiguration(t *testing.T) {
+	idp := newIssuer(t)
+	provider := idp.Provider()
+	provider.Issuer = idp.URL() + "/"
+
+	if _, err := provider.AuthURL("state", "nonce", "verifier"); err == nil {
+		t.Fatal("used the configuration of another issuer")
+	}
+}
+
+func TestRole(t *testing.T) {
+	provider := &Provider{
+		DefaultRole: Models.RoleUser,
+		GroupRoles:  map[string]string{"readers": Models.RoleReadOnly, "staff": Models.RoleUser, "admins": Models.RoleAdmin},
+	}
+
+	tests := []struct {
+		groups []string
+		role   string
+	}{
+		{nil, Models.RoleUser},
+		{[]string{"strangers"}, Models.RoleUser},
+		{[]string{"readers"}, Models.RoleReadOnly},
+		{[]string{"readers", "admins", "staff"}, Models.RoleAdmin},
+		{[]string{"staff", "readers"}, Models.RoleUser},
+	}
+
+	for _, test := range tests {
+		if role := provider.Role(test.groups); role != test.role {
+			t.Errorf("groups %v: got role %q, want %q", test.groups, role, test.role)
+		}
+	}
+
+	if !provider.MapsGroups() || (&Provider{}).MapsGroups() {
+		t.Error("MapsGroups does not match GroupRoles")
+	}
+}
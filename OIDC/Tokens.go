@@ -0,0 +1,346 @@
+package OIDC
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Tools"
+	"github.com/golang/glog"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Clock difference allowed with the identity provider when checking when a token expires
+const clockLeeway = time.Minute
+
+// Unknown key ids only fetch the keys again this long after the last fetch, so forged tokens can not flood the issuer
+const keyRefetchInterval = time.Minute
+
+// Claims are the claims of an ID token used to find or create the account
+type Claims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	Expiry            int64    `json:"exp"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     flexBool `json:"email_verified"`
+	PreferredUsername string   `json:"preferred_username"`
+	Name              string   `json:"name"`
+	Groups            []string `json:"-"` // From the claim named by Provider.GroupsClaim
+}
+
+// audience is a single string or a list of them
+type audience []string
+
+func (aud *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*aud = audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*aud = list
+
+	return nil
+}
+
+// flexBool is a boolean some providers send as a string
+type flexBool bool
+
+func (value *flexBool) UnmarshalJSON(data []byte) error {
+	*value = flexBool(strings.Trim(string(data), `"`) == "true")
+	return nil
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// RandomString Returns a random URL safe string, for states, nonces and PKCE verifiers
+func RandomString() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		err = fmt.Errorf("Error generating random string: %v", err)
+		glog.Error(err)
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// Challenge Returns the S256 PKCE challenge of a verifier
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// basicAuth Encodes client credentials for the Authorization header, form encoded first as OAuth 2 asks
+func basicAuth(id string, secret string) string {
+	return base64.StdEncoding.EncodeToString([]byte(url.QueryEscape(id) + ":" + url.QueryEscape(secret)))
+}
+
+// verify Checks the signature and claims of an ID token
+func (provider *Provider) verify(token string, nonce string) (*Claims, error) {
+	invalid := func(reason string) (*Claims, error) {
+		err := fmt.Errorf("Invalid ID token: %s", reason)
+		glog.Error(err)
+		return nil, err
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return invalid("not a JWT")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return invalid("bad header")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return invalid("bad signature encoding")
+	}
+
+	key, err := provider.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkSignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return invalid(err.Error())
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return invalid("bad claims")
+	}
+
+	if claims.Issuer != provider.Issuer {
+		return invalid("wrong issuer")
+	}
+	if !contains(claims.Audience, provider.ClientID) {
+		return invalid("wrong audience")
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != provider.ClientID {
+		return invalid("wrong authorized party")
+	}
+	if time.Now().Add(-clockLeeway).After(time.Unix(claims.Expiry, 0)) {
+		return invalid("expired")
+	}
+	if claims.Nonce != nonce {
+		return invalid("wrong nonce")
+	}
+	if claims.Subject == "" {
+		return invalid("missing subject")
+	}
+
+	if provider.GroupsClaim != "" {
+		var raw map[string]json.RawMessage
+		decodeSegment(parts[1], &raw)
+		claims.Groups = parseGroups(raw[provider.GroupsClaim])
+	}
+
+	return &claims, nil
+}
+
+// decodeSegment Decodes a base64url JSON part of a JWT
+func decodeSegment(segment string, output any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, output)
+}
+
+// parseGroups Reads a groups claim, a list of names or a single name
+func parseGroups(raw json.RawMessage) []string {
+	var groups []string
+	if err := json.Unmarshal(raw, &groups); err == nil {
+		return groups
+	}
+
+	var group string
+	if err := json.Unmarshal(raw, &group); err == nil && group != "" {
+		return []string{group}
+	}
+
+	return nil
+}
+
+// checkSignature Verifies a JWT signature, only asymmetric algorithms are accepted
+func checkSignature(alg string, key crypto.PublicKey, signed []byte, signature []byte) error {
+	hashes := map[string]crypto.Hash{
+		"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+		"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+	}
+	hash, ok := hashes[alg]
+	if !ok {
+		return fmt.Errorf("unsupported algorithm %s", alg)
+	}
+
+	hasher := hash.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if alg[0] != 'R' || rsa.VerifyPKCS1v15(key, hash, digest, signature) != nil {
+			return fmt.Errorf("bad signature")
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if alg[0] != 'E' || len(signature) != 2*size {
+			return fmt.Errorf("bad signature")
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return fmt.Errorf("bad signature")
+		}
+	default:
+		return fmt.Errorf("unsupported key")
+	}
+
+	return nil
+}
+
+// key Gets a signing key of the issuer by id
+// The keys are fetched again when the id is unknown, in case the issuer rotated them, at most once every keyRefetchInterval
+func (provider *Provider) key(kid string) (crypto.PublicKey, error) {
+	unknown := fmt.Errorf("Invalid ID token: unknown signing key %s", kid)
+
+	provider.mutex.Lock()
+	key, ok := provider.keys[kid]
+	recent := provider.keys != nil && time.Since(provider.keysFetched) < keyRefetchInterval
+	if !ok && !recent {
+		provider.keysFetched = time.Now()
+	}
+	provider.mutex.Unlock()
+	if ok {
+		return key, nil
+	}
+	if recent {
+		glog.Error(unknown)
+		return nil, unknown
+	}
+
+	config, err := provider.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := Tools.RequestGET(config.JWKSURI, nil)
+	if err != nil {
+		err = fmt.Errorf("Failed to fetch the signing keys: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &set); err != nil {
+		err = fmt.Errorf("Failed to parse the signing keys: %v", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		if parsed, err := k.publicKey(); err == nil {
+			keys[k.Kid] = parsed
+		} else {
+			glog.Warning("Skipping signing key ", k.Kid, ": ", err)
+		}
+	}
+
+	provider.mutex.Lock()
+	provider.keys = keys
+	provider.mutex.Unlock()
+
+	key, ok = keys[kid]
+	if !ok {
+		glog.Error(unknown)
+		return nil, unknown
+	}
+
+	return key, nil
+}
+
+// publicKey Decodes an RSA or EC JSON web key
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	decode := func(value string) (*big.Int, error) {
+		bytes, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(bytes), nil
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on the curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
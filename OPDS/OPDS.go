@@ -0,0 +1,111 @@
+package OPDS
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+const (
+	NavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	AcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	OpenSearchType  = "application/opensearchdescription+xml"
+	CBZType         = "application/vnd.comicbook+zip"
+
+	RelAcquisition = "http://opds-spec.org/acquisition"
+	RelImage       = "http://opds-spec.org/image"
+	RelThumbnail   = "http://opds-spec.org/image/thumbnail"
+	RelStream      = "http://vaemendis.net/opds-pse/stream"
+	RelSubsection  = "subsection"
+)
+
+// An OPDS 1.2 catalog feed
+type Feed struct {
+	XMLName   xml.Name `xml:"feed"`
+	Xmlns     string   `xml:"xmlns,attr"`
+	XmlnsOPDS string   `xml:"xmlns:opds,attr"`
+	XmlnsPSE  string   `xml:"xmlns:pse,attr"`
+	XmlnsOS   string   `xml:"xmlns:opensearch,attr"`
+	ID        string   `xml:"id"`
+	Title     string   `xml:"title"`
+	Updated   string   `xml:"updated"`
+	Author    Author   `xml:"author"`
+	Links     []Link   `xml:"link"`
+	Entries   []Entry  `xml:"entry"`
+}
+
+type Author struct {
+	Name string `xml:"name"`
+}
+
+type Link struct {
+	Rel      string `xml:"rel,attr,omitempty"`
+	Href     string `xml:"href,attr"`
+	Type     string `xml:"type,attr,omitempty"`
+	Title    string `xml:"title,attr,omitempty"`
+	PSECount int    `xml:"pse:count,attr,omitempty"`
+}
+
+type Entry struct {
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Authors []Author `xml:"author,omitempty"`
+	Content *Content `xml:"content,omitempty"`
+	Links   []Link   `xml:"link"`
+}
+
+type Content struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+// An OpenSearch description pointing readers at the search feed
+type OpenSearchDescription struct {
+	XMLName     xml.Name      `xml:"OpenSearchDescription"`
+	Xmlns       string        `xml:"xmlns,attr"`
+	ShortName   string        `xml:"ShortName"`
+	Description string        `xml:"Description"`
+	URL         OpenSearchURL `xml:"Url"`
+}
+
+type OpenSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Template string `xml:"template,attr"`
+}
+
+// Creates an empty feed linking to itself and the catalog root
+func NewFeed(id string, title string, self string, kind string) Feed {
+	return Feed{
+		Xmlns:     "http://www.w3.org/2005/Atom",
+		XmlnsOPDS: "http://opds-spec.org/2010/catalog",
+		XmlnsPSE:  "http://vaemendis.net/opds-pse/ns",
+		XmlnsOS:   "http://a9.com/-/spec/opensearch/1.1/",
+		ID:        id,
+		Title:     title,
+		Updated:   Timestamp(time.Now()),
+		Author:    Author{Name: "mangascribe"},
+		Links: []Link{
+			{Rel: "self", Href: self, Type: kind},
+			{Rel: "start", Href: "/opds", Type: NavigationType},
+			{Rel: "search", Href: "/opds/search.xml", Type: OpenSearchType},
+		},
+	}
+}
+
+// Creates the OpenSearch description of the catalog
+func NewOpenSearchDescription() OpenSearchDescription {
+	return OpenSearchDescription{
+		Xmlns:       "http://a9.com/-/spec/opensearch/1.1/",
+		ShortName:   "mangascribe",
+		Description: "Search the mangascribe library",
+		URL: OpenSearchURL{
+			Type:     NavigationType,
+			Template: "/opds/search?q={searchTerms}",
+		},
+	}
+}
+
+// Formats a time the way Atom expects
+func Timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,343 @@
+package Queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/MangaDex"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/Tachiyomi"
+	"github.com/golang/glog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// AddManga Stores a manga that is not in the library yet with its chapters, then queues its covers and chapter downloads
+func (q *Queue) AddManga(API Models.APIProvider, manga *Models.Manga, datasaver bool) error {
+	if err := manga.GetChapters(API, true); err != nil {
+		return err
+	}
+
+	if err := manga.ChapterToVolume(); err != nil {
+		return err
+	}
+
+	if err := q.dbm.AddManga(manga); err != nil {
+		return err
+	}
+
+	// Queue the covers first so the UI has something to show
+	coverJob := Models.Job{Type: Models.CoverJob, MangaID: manga.MangaID}
+	if err := q.Enqueue(&coverJob); err != nil {
+		return err
+	}
+
+	// Queue the chapters picked for each volume
+	for _, volume := range manga.Volumes {
+		for _, chapter := range volume.Chapters {
+			job := Models.Job{
+				Type:      Models.DownloadJob,
+				ChapterID: chapter.ChapterID,
+				Datasaver: datasaver,
+			}
+			if err := q.Enqueue(&job); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// EnqueueBackupImport Saves an uploaded Tachiyomi/Mihon backup and schedules importing it for an account
+func (q *Queue) EnqueueBackupImport(accountID uint, content []byte) (*Models.Job, error) {
+	if err := os.MkdirAll(Config.UPLOAD_PATH, 0755); err != nil {
+		err = fmt.Errorf("Failed to create upload directory: %w", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	file, err := os.CreateTemp(Config.UPLOAD_PATH, "backup-*.tachibk")
+	if err != nil {
+		err = fmt.Errorf("Failed to save backup: %w", err)
+		glog.Error(err)
+		return nil, err
+	}
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		err = fmt.Errorf("Failed to save backup: %w", err)
+		glog.Error(err)
+		return nil, err
+	}
+
+	job := Models.Job{Type: Models.BackupImportJob, AccountID: accountID, File: filepath.Base(file.Name())}
+	if err := q.Enqueue(&job); err != nil {
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// backupImport Imports an uploaded backup, the report is kept on the job and the upload is removed
+func (q *Queue) backupImport(job *Models.Job) error {
+	path := filepath.Join(Config.UPLOAD_PATH, filepath.Base(job.File))
+	defer os.Remove(path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		err = fmt.Errorf("Failed to open backup: %w", err)
+		glog.Error(err)
+		return err
+	}
+	defer file.Close()
+
+	backup, err := Tachiyomi.Read(file)
+	if err != nil {
+		return err
+	}
+
+	report, err := q.ImportBackup(job.AccountID, &backup)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		err = fmt.Errorf("Failed to encode import report: %w", err)
+		glog.Error(err)
+		return err
+	}
+	job.Report = string(encoded)
+
+	return nil
+}
+
+// ImportBackup Adds the MangaDex manga of a Tachiyomi/Mihon backup to the library,
+// then imports their categories, favorites and reading progress for an account
+// Manga from other sources, or that the provider fails to fetch, are reported as skipped
+func (q *Queue) ImportBackup(accountID uint, backup *Tachiyomi.Backup) (Models.Response_LibraryImport, error) {
+	report := Models.Response_LibraryImport{
+		Added:    []Models.MangaJSON{},
+		Existing: []Models.MangaJSON{},
+		Skipped:  []Models.SkippedMangaJSON{},
+	}
+
+	API, err := q.Providers.Get(MangaDex.API{}.GetProvider())
+	if err != nil {
+		return report, err
+	}
+
+	for i := range backup.Manga {
+		entry := &backup.Manga[i]
+		skip := func(reason string) {
+			report.Skipped = append(report.Skipped, Models.SkippedMangaJSON{
+				Title:  entry.Title,
+				Source: backup.SourceName(entry.Source),
+				Reason: reason,
+			})
+		}
+
+		id, ok := backup.MangaDexID(entry)
+		if !ok {
+			skip("Source is not supported")
+			continue
+		}
+
+		exists, err := q.dbm.IsMangaInLibrary(API.GetProvider(), id)
+		if err != nil {
+			return report, err
+		}
+
+		var manga Models.Manga
+		if exists {
+			if err := q.dbm.GetMangaByProviderID(&manga, API.GetProvider(), id); err != nil {
+				return report, err
+			}
+			report.Existing = append(report.Existing, manga.ToJSON())
+		} else {
+			if manga, err = API.FetchManga(id); err != nil {
+				skip(err.Error())
+				continue
+			}
+
+			if err := q.AddManga(API, &manga, false); err != nil {
+				skip(err.Error())
+				continue
+			}
+			report.Added = append(report.Added, manga.ToJSON())
+		}
+
+		if names := backup.CategoryNames(entry); len(names) > 0 {
+			if err := q.dbm.AddMangaToCategories(accountID, manga.MangaID, names); err != nil {
+				return report, err
+			}
+		}
+
+		if entry.Favorite {
+			if err := q.dbm.FollowManga(accountID, manga.MangaID); err != nil {
+				return report, err
+			}
+		}
+
+		chapters, err := q.dbm.GetReadingList(manga.MangaID)
+		if err != nil {
+			return report, err
+		}
+
+		updated, err := q.dbm.ImportProgress(accountID, entry.Progress(chapters))
+		if err != nil {
+			return report, err
+		}
+		report.Progress += updated
+	}
+
+	return report, nil
+}
+
+// EnqueueMangaDexSync Schedules importing the linked MangaDex account of an account
+// Returns nil without queueing anything if a sync is already waiting
+func (q *Queue) EnqueueMangaDexSync(accountID uint) (*Models.Job, error) {
+	if pending, err := q.dbm.HasPendingAccountJob(Models.MangaDexSyncJob, accountID, 0); err != nil || pending {
+		return nil, err
+	}
+
+	job := Models.Job{Type: Models.MangaDexSyncJob, AccountID: accountID}
+	if err := q.Enqueue(&job); err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// mangaDexSync Imports the linked MangaDex account, the report is kept on the job
+func (q *Queue) mangaDexSync(job *Models.Job) error {
+	var link Models.MangaDexLink
+	if err := q.dbm.GetMangaDexLink(&link, job.AccountID); err != nil {
+		return err
+	}
+
+	report, err := q.SyncMangaDex(&link)
+
+	// Keep the refreshed tokens even if the sync failed
+	if saveErr := q.dbm.SaveMangaDexLink(&link); err == nil {
+		err = saveErr
+	}
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		err = fmt.Errorf("Failed to encode import report: %w", err)
+		glog.Error(err)
+		return err
+	}
+	job.Report = string(encoded)
+
+	return nil
+}
+
+// SyncMangaDex Imports the follows, reading statuses and read markers of a linked MangaDex account
+// Followed manga missing from the library are added, reading statuses are imported as categories
+func (q *Queue) SyncMangaDex(link *Models.MangaDexLink) (Models.Response_LibraryImport, error) {
+	report := Models.Response_LibraryImport{
+		Added:    []Models.MangaJSON{},
+		Existing: []Models.MangaJSON{},
+		Skipped:  []Models.SkippedMangaJSON{},
+	}
+
+	API, err := q.Providers.Get(MangaDex.API{}.GetProvider())
+	if err != nil {
+		return report, err
+	}
+
+	client := MangaDex.NewClient(q.MangaDex, link)
+	follows, err := client.Follows()
+	if err != nil {
+		return report, err
+	}
+
+	statuses, err := client.ReadingStatuses()
+	if err != nil {
+		return report, err
+	}
+
+	// MangaDex id to library id of every followed manga
+	library := make(map[string]uint)
+	for i := range follows {
+		manga := &follows[i]
+
+		exists, err := q.dbm.IsMangaInLibrary(API.GetProvider(), manga.ID)
+		if err != nil {
+			return report, err
+		}
+
+		if exists {
+			var stored Models.Manga
+			if err := q.dbm.GetMangaByProviderID(&stored, API.GetProvider(), manga.ID); err != nil {
+				return report, err
+			}
+			*manga = stored
+			report.Existing = append(report.Existing, manga.ToJSON())
+		} else {
+			if err := q.AddManga(API, manga, false); err != nil {
+				report.Skipped = append(report.Skipped, Models.SkippedMangaJSON{
+					Title:  manga.Name,
+					Source: API.GetProvider(),
+					Reason: err.Error(),
+				})
+				continue
+			}
+			report.Added = append(report.Added, manga.ToJSON())
+		}
+		library[manga.ID] = manga.MangaID
+
+		if err := q.dbm.FollowManga(link.AccountID, manga.MangaID); err != nil {
+			return report, err
+		}
+
+		if category, exists := MangaDex.StatusCategory(statuses[manga.ID]); exists {
+			if err := q.dbm.AddMangaToCategories(link.AccountID, manga.MangaID, []string{category}); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(library))
+	for id := range library {
+		ids = append(ids, id)
+	}
+
+	markers, err := client.ReadMarkers(ids)
+	if err != nil {
+		return report, err
+	}
+
+	for id, chapterIDs := range markers {
+		mangaID, exists := library[id]
+		if !exists {
+			continue
+		}
+
+		var manga Models.Manga
+		if err := q.dbm.GetManga(&manga, mangaID); err != nil {
+			return report, err
+		}
+
+		updated, err := q.dbm.ImportProgress(link.AccountID, MangaDex.ReadProgress(&manga, chapterIDs))
+		if err != nil {
+			return report, err
+		}
+		report.Progress += updated
+	}
+
+	now := time.Now()
+	link.LastSyncAt = &now
+	return report, nil
+}
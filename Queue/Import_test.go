@@ -0,0 +1,188 @@
+package Queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/MangaDex"
+	"github.com/CookieUzen/mangascribe/Models"
+)
+
+// provider Serves the followed manga of a MangaDex fake with one chapter per read marker and one unread chapter
+type provider struct {
+	fake *MangaDex.Fake
+}
+
+func (p provider) manga(id string) (MangaDex.FakeManga, error) {
+	for _, manga := range p.fake.Follows {
+		if manga.ID == id {
+			return manga, nil
+		}
+	}
+	return MangaDex.FakeManga{}, fmt.Errorf("Manga %s not found", id)
+}
+
+func (p provider) SearchManga(title string) (Models.Manga, error) {
+	return Models.Manga{}, fmt.Errorf("Search is not supported")
+}
+
+func (p provider) FetchManga(id string) (Models.Manga, error) {
+	manga, err := p.manga(id)
+	return Models.Manga{ID: manga.ID, Name: manga.Title, APIProvider: p.GetProvider()}, err
+}
+
+func (p provider) FetchChapters(id string) ([]Models.Chapter, error) {
+	manga, err := p.manga(id)
+	if err != nil {
+		return nil, err
+	}
+
+	chapters := []Models.Chapter{}
+	for i, chapterID := range append(append([]string{}, manga.Read...), id+"-unread") {
+		chapters = append(chapters, Models.Chapter{ID: chapterID, Volume: "Volume 1", Chapter: fmt.Sprintf("Chapter %d", i+1), PageNumber: 10})
+	}
+	return chapters, nil
+}
+
+func (p provider) FetchChapterDownload(id string, datasaver bool) (string, []string, error) {
+	return "", nil, fmt.Errorf("Downloads are not supported")
+}
+
+func (p provider) FetchCovers(id string) ([]Models.Cover, error) { return nil, nil }
+func (p provider) PageHash(filename string) string               { return "" }
+func (p provider) GetProvider() string                           { return MangaDex.API{}.GetProvider() }
+func (p provider) Capabilities() Models.Capabilities             { return Models.Capabilities{} }
+
+// linkedQueue Opens a database in a temporary folder and links account 1 to a MangaDex fake
+// The worker is not started, so queued jobs stay pending
+func linkedQueue(t *testing.T) (*Queue, *DB.DBManager, *MangaDex.Fake) {
+	t.Helper()
+
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(dir) })
+
+	fake := MangaDex.NewFake()
+	t.Cleanup(fake.Server.Close)
+
+	dbm := DB.Open()
+	q := New(&dbm, Models.NewRegistry(provider{fake}))
+	q.MangaDex = fake.Endpoints()
+
+	link := Models.MangaDexLink{AccountID: 1, Username: fake.Username, ClientID: fake.ClientID, ClientSecret: fake.ClientSecret, PushReadMarkers: true}
+	if err := MangaDex.NewClient(q.MangaDex, &link).Login(fake.Password); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if err := dbm.SaveMangaDexLink(&link); err != nil {
+		t.Fatalf("SaveMangaDexLink: %v", err)
+	}
+
+	return q, &dbm, fake
+}
+
+func TestMangaDexSync(t *testing.T) {
+	q, dbm, fake := linkedQueue(t)
+	fake.Follows = []MangaDex.FakeManga{
+		{ID: "a", Title: "Alpha", Status: "reading", Read: []string{"a1", "a2"}},
+		{ID: "b", Title: "Beta", Status: "plan_to_read"},
+		{ID: "c", Title: "Gamma"},
+	}
+
+	job, err := q.EnqueueMangaDexSync(1)
+	if err != nil || job == nil {
+		t.Fatalf("EnqueueMangaDexSync: %v %v", job, err)
+	}
+	if again, err := q.EnqueueMangaDexSync(1); err != nil || again != nil {
+		t.Fatalf("queued a second sync while one is waiting: %v %v", again, err)
+	}
+
+	// Make the sync refresh the tokens it saves
+	var link Models.MangaDexLink
+	if err := dbm.GetMangaDexLink(&link, 1); err != nil {
+		t.Fatal(err)
+	}
+	link.ExpiresAt = time.Now().Add(-time.Minute)
+	if err := dbm.SaveMangaDexLink(&link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.mangaDexSync(job); err != nil {
+		t.Fatalf("mangaDexSync: %v", err)
+	}
+
+	var report Models.Response_LibraryImport
+	if err := json.Unmarshal([]byte(job.Report), &report); err != nil {
+		t.Fatalf("report %q: %v", job.Report, err)
+	}
+	if len(report.Added) != 3 || len(report.Existing) != 0 || len(report.Skipped) != 0 || report.Progress != 2 {
+		t.Errorf("got report %+v", report)
+	}
+
+	followed, err := dbm.GetFollowedManga(1)
+	if err != nil || len(followed) != 3 {
+		t.Errorf("got %d followed manga, want 3: %v", len(followed), err)
+	}
+
+	categories, err := dbm.GetCategories(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, category := range categories {
+		names = append(names, category.Name)
+	}
+	if len(names) != 2 || names[0] != "Plan to Read" || names[1] != "Reading" {
+		t.Errorf("got categories %v", names)
+	}
+
+	alpha := report.Added[0]
+	progress, err := dbm.GetMangaProgress(1, alpha.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(progress) != 2 {
+		t.Errorf("got %d chapters of %s read, want 2", len(progress), alpha.Name)
+	}
+
+	if err := dbm.GetMangaDexLink(&link, 1); err != nil {
+		t.Fatal(err)
+	}
+	if fake.Refreshes != 1 || link.AccessToken != "access-2" || link.LastSyncAt == nil {
+		t.Errorf("got %d refreshes, saved token %q, last sync %v", fake.Refreshes, link.AccessToken, link.LastSyncAt)
+	}
+}
+
+func TestReadMarkersQueuedOnce(t *testing.T) {
+	q, dbm, fake := linkedQueue(t)
+	fake.Follows = []MangaDex.FakeManga{{ID: "a", Title: "Alpha"}}
+
+	API, err := q.Providers.Get(MangaDex.API{}.GetProvider())
+	if err != nil {
+		t.Fatal(err)
+	}
+	alpha, _ := API.FetchManga("a")
+	if err := q.AddManga(API, &alpha, false); err != nil {
+		t.Fatalf("AddManga: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := q.EnqueueReadMarkers(1, alpha.MangaID); err != nil {
+			t.Fatalf("EnqueueReadMarkers: %v", err)
+		}
+	}
+
+	var count int64
+	dbm.DB.Model(&Models.Job{}).Where("type = ? AND account_id = ?", Models.MangaDexReadJob, 1).Count(&count)
+	if count != 1 {
+		t.Errorf("got %d read marker pushes queued, want 1", count)
+	}
+}
@@ -0,0 +1,509 @@
+package Queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/Export"
+	"github.com/CookieUzen/mangascribe/MangaDex"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/Trackers"
+	"github.com/golang/glog"
+	"os"
+	"strings"
+	"time"
+)
+
+// Jobs talking to outside services, retried when they fail
+var retryable = map[Models.JobType]bool{
+	Models.MangaDexReadJob: true,
+	Models.MangaDexSyncJob: true,
+	Models.TrackerJob:      true,
+}
+
+// Queue Runs jobs one at a time in the background
+type Queue struct {
+	dbm        *DB.DBManager
+	Providers  *Models.Registry
+	Export     *Export.Mirror // nil when the library is not exported
+	MangaDex   MangaDex.Endpoints
+	Trackers   Trackers.Set
+	RetryDelay time.Duration // Wait before retrying a failed job, doubled after every attempt
+	jobs       chan uint
+}
+
+func New(dbm *DB.DBManager, providers *Models.Registry) *Queue {
+	return &Queue{
+		dbm:        dbm,
+		Providers:  providers,
+		MangaDex:   MangaDex.DefaultEndpoints,
+		Trackers:   Trackers.Default(),
+		RetryDelay: Config.JOB_RETRY_DELAY,
+		jobs:       make(chan uint, 256),
+	}
+}
+
+// Start Requeues the jobs left over from the last run and starts the worker
+func (q *Queue) Start() error {
+	jobs, err := q.dbm.GetUnfinishedJobs()
+	if err != nil {
+		return err
+	}
+
+	go q.worker()
+
+	for _, job := range jobs {
+		glog.Info("Resuming ", job.Type, " job ", job.ID)
+		q.push(job.ID)
+	}
+
+	return nil
+}
+
+// Enqueue Saves a new job and schedules it for the worker
+func (q *Queue) Enqueue(job *Models.Job) error {
+	if err := q.dbm.CreateJob(job); err != nil {
+		return err
+	}
+
+	q.push(job.ID)
+	return nil
+}
+
+// push Hands a job id to the worker without blocking the caller
+func (q *Queue) push(id uint) {
+	go func() {
+		q.jobs <- id
+	}()
+}
+
+// worker Pulls jobs off the channel and runs them until the channel is closed
+func (q *Queue) worker() {
+	for id := range q.jobs {
+		var job Models.Job
+		if err := q.dbm.GetJob(&job, id); err != nil {
+			continue
+		}
+
+		job.Status = Models.JobRunning
+		if err := q.dbm.UpdateJob(&job); err != nil {
+			continue
+		}
+
+		err := q.run(&job)
+		if err != nil {
+			job.Error = err.Error()
+			job.Attempts++
+			if retryable[job.Type] && job.Attempts < Config.JOB_MAX_ATTEMPTS {
+				job.Status = Models.JobPending
+				q.retry(job.ID, job.Attempts)
+			} else {
+				job.Status = Models.JobFailed
+			}
+		} else {
+			job.Status = Models.JobCompleted
+			job.Error = ""
+		}
+
+		q.dbm.UpdateJob(&job)
+	}
+}
+
+// retry Schedules a failed job again, waiting twice as long after every attempt
+func (q *Queue) retry(id uint, attempts int) {
+	delay := q.RetryDelay << (attempts - 1)
+	glog.Info("Retrying job ", id, " in ", delay)
+
+	time.AfterFunc(delay, func() {
+		q.push(id)
+	})
+}
+
+// run Dispatches a job to the function handling its type
+func (q *Queue) run(job *Models.Job) error {
+	switch job.Type {
+	case Models.DownloadJob:
+		return q.download(job)
+	case Models.VerifyJob:
+		return q.verify(job)
+	case Models.CoverJob:
+		return q.covers(job)
+	case Models.SyncJob:
+		return q.sync(job)
+	case Models.ExportJob:
+		return q.export(job)
+	case Models.MangaDexReadJob:
+		return q.mangaDexRead(job)
+	case Models.TrackerJob:
+		return q.trackers(job)
+	case Models.BackupImportJob:
+		return q.backupImport(job)
+	case Models.MangaDexSyncJob:
+		return q.mangaDexSync(job)
+	}
+
+	err := fmt.Errorf("Unknown job type: %s", job.Type)
+	glog.Error(err)
+	return err
+}
+
+// download (Re)downloads a single chapter
+func (q *Queue) download(job *Models.Job) error {
+	var chapter Models.Chapter
+	if err := q.dbm.GetChapter(&chapter, job.ChapterID); err != nil {
+		return err
+	}
+
+	API, err := q.Providers.ForManga(chapter.Manga)
+	if err != nil {
+		return err
+	}
+
+	// Providers without a data saver mode only have the original pages
+	datasaver := job.Datasaver && API.Capabilities().Datasaver
+	if err := chapter.Download(API, datasaver, q.dbm); err != nil {
+		return err
+	}
+
+	return q.EnqueueExport(chapter.MangaID)
+}
+
+// verify Re-hashes every downloaded chapter in the library
+// Chapters with missing or corrupted pages get a download job queued
+func (q *Queue) verify(job *Models.Job) error {
+	chapters, err := q.dbm.GetDownloadedChapters()
+	if err != nil {
+		return err
+	}
+
+	reports := []Models.VerifyReport{}
+	for _, chapter := range chapters {
+		report, err := chapter.Verify()
+		if err != nil {
+			return err
+		}
+
+		if report.OK() {
+			continue
+		}
+
+		glog.Warning("Chapter ", chapter.ChapterID, " failed verification, queueing a re-download")
+		reports = append(reports, report)
+
+		redownload := Models.Job{
+			Type:      Models.DownloadJob,
+			ChapterID: chapter.ChapterID,
+		}
+		if err := q.Enqueue(&redownload); err != nil {
+			return err
+		}
+	}
+
+	report, err := json.Marshal(reports)
+	if err != nil {
+		err = fmt.Errorf("Failed to encode verify report: %w", err)
+		glog.Error(err)
+		return err
+	}
+	job.Report = string(report)
+
+	glog.Info("Verified ", len(chapters), " chapters, ", len(reports), " need a re-download")
+	return nil
+}
+
+// covers Fetches the volume covers of a manga and downloads any cover not on disk yet
+func (q *Queue) covers(job *Models.Job) error {
+	var manga Models.Manga
+	if err := q.dbm.GetManga(&manga, job.MangaID); err != nil {
+		return err
+	}
+
+	API, err := q.Providers.ForManga(&manga)
+	if err != nil {
+		return err
+	}
+
+	fetched, err := API.FetchCovers(manga.ID)
+	if err != nil {
+		return err
+	}
+
+	// Add the volume covers the manga does not know about yet
+	known := make(map[string]bool)
+	for _, cover := range manga.Covers {
+		known[cover.URL] = true
+	}
+	for _, cover := range fetched {
+		if !known[cover.URL] {
+			cover.MangaID = manga.MangaID
+			manga.Covers = append(manga.Covers, cover)
+		}
+	}
+
+	for i := range manga.Covers {
+		cover := &manga.Covers[i]
+
+		// Skip covers already downloaded
+		if _, err := os.Stat(cover.Path(manga.FolderPath(), "")); cover.Hash != "" && err == nil {
+			continue
+		}
+
+		if err := cover.Download(manga.FolderPath()); err != nil {
+			return err
+		}
+
+		if err := q.dbm.SaveCover(cover); err != nil {
+			return err
+		}
+	}
+
+	glog.Info("Downloaded covers for ", manga.Name)
+	return nil
+}
+
+// sync Refreshes the metadata of a manga, adds its new chapters and queues them for download
+func (q *Queue) sync(job *Models.Job) error {
+	var manga Models.Manga
+	if err := q.dbm.GetManga(&manga, job.MangaID); err != nil {
+		return err
+	}
+
+	API, err := q.Providers.ForManga(&manga)
+	if err != nil {
+		return err
+	}
+
+	fresh, err := API.FetchManga(manga.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := q.dbm.UpdateMangaMetadata(&manga, &fresh); err != nil {
+		return err
+	}
+
+	if err := q.syncChapters(API, &manga, job.Datasaver); err != nil {
+		return err
+	}
+
+	// The covers may have changed along with the metadata
+	covers := Models.Job{Type: Models.CoverJob, MangaID: manga.MangaID}
+	if err := q.Enqueue(&covers); err != nil {
+		return err
+	}
+
+	return q.EnqueueExport(manga.MangaID)
+}
+
+// syncChapters Adds the new chapters of a manga and queues them for download
+// Providers without a chapter feed are skipped
+func (q *Queue) syncChapters(API Models.APIProvider, manga *Models.Manga, datasaver bool) error {
+	if !API.Capabilities().Feed {
+		return nil
+	}
+
+	chapters, err := API.FetchChapters(manga.ID)
+	if err != nil {
+		return err
+	}
+
+	added, err := q.dbm.SyncChapters(manga, chapters)
+	if err != nil {
+		return err
+	}
+
+	for _, chapter := range added {
+		download := Models.Job{
+			Type:      Models.DownloadJob,
+			ChapterID: chapter.ChapterID,
+			Datasaver: datasaver,
+		}
+		if err := q.Enqueue(&download); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EnqueueExport Schedules an update of the exported mirror of a manga
+// Does nothing if the export is disabled or an export of the manga is already waiting
+func (q *Queue) EnqueueExport(mangaID uint) error {
+	if q.Export == nil {
+		return nil
+	}
+
+	if pending, err := q.dbm.HasPendingJob(Models.ExportJob, mangaID); err != nil || pending {
+		return err
+	}
+
+	job := Models.Job{Type: Models.ExportJob, MangaID: mangaID}
+	return q.Enqueue(&job)
+}
+
+// export Brings the exported mirror of a manga up to date
+func (q *Queue) export(job *Models.Job) error {
+	if q.Export == nil {
+		err := fmt.Errorf("Library export is disabled")
+		glog.Error(err)
+		return err
+	}
+
+	var manga Models.Manga
+	if err := q.dbm.GetManga(&manga, job.MangaID); err != nil {
+		return err
+	}
+
+	// Load the pages of every volume
+	for i := range manga.Volumes {
+		if err := q.dbm.GetVolume(&manga.Volumes[i], manga.Volumes[i].ID); err != nil {
+			return err
+		}
+	}
+
+	return q.Export.Export(&manga)
+}
+
+// EnqueueReadMarkers Schedules pushing the read markers of a manga to the MangaDex account linked to an account
+// Does nothing unless the account opted in and the manga comes from MangaDex, or if a push is already waiting
+func (q *Queue) EnqueueReadMarkers(accountID uint, mangaID uint) error {
+	var link Models.MangaDexLink
+	if err := q.dbm.GetMangaDexLink(&link, accountID); err != nil || !link.PushReadMarkers {
+		return nil
+	}
+
+	var manga Models.Manga
+	if err := q.dbm.GetMangaMetadata(&manga, mangaID); err != nil {
+		return err
+	}
+	if manga.APIProvider != (MangaDex.API{}).GetProvider() {
+		return nil
+	}
+
+	// A waiting push reads the markers when it runs, so it covers this change too
+	if pending, err := q.dbm.HasPendingAccountJob(Models.MangaDexReadJob, accountID, mangaID); err != nil || pending {
+		return err
+	}
+
+	job := Models.Job{Type: Models.MangaDexReadJob, MangaID: mangaID, AccountID: accountID}
+	return q.Enqueue(&job)
+}
+
+// mangaDexRead Pushes the read markers of a manga to the linked MangaDex account
+func (q *Queue) mangaDexRead(job *Models.Job) error {
+	var link Models.MangaDexLink
+	if err := q.dbm.GetMangaDexLink(&link, job.AccountID); err != nil {
+		return err
+	}
+
+	// The account may have opted out since the job was queued
+	if !link.PushReadMarkers {
+		return nil
+	}
+
+	var manga Models.Manga
+	if err := q.dbm.GetMangaMetadata(&manga, job.MangaID); err != nil {
+		return err
+	}
+
+	read, unread, err := q.dbm.GetReadMarkers(job.AccountID, job.MangaID)
+	if err != nil {
+		return err
+	}
+
+	err = MangaDex.NewClient(q.MangaDex, &link).MarkRead(manga.ID, read, unread)
+
+	// Keep the refreshed tokens even if the push failed
+	if saveErr := q.dbm.SaveMangaDexLink(&link); err == nil {
+		err = saveErr
+	}
+
+	return err
+}
+
+// EnqueueTrackers Schedules pushing the reading progress of a manga to the trackers an account linked it to
+// Does nothing if the manga is not tracked or a push is already waiting
+func (q *Queue) EnqueueTrackers(accountID uint, mangaID uint) error {
+	entries, err := q.dbm.GetTrackerEntries(accountID, mangaID)
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+
+	if pending, err := q.dbm.HasPendingAccountJob(Models.TrackerJob, accountID, mangaID); err != nil || pending {
+		return err
+	}
+
+	job := Models.Job{Type: Models.TrackerJob, MangaID: mangaID, AccountID: accountID}
+	return q.Enqueue(&job)
+}
+
+// trackers Pushes the chapters read, status and score of a manga to every tracker it is linked to
+// Every tracker is tried even if one fails, the job fails if any of them did
+func (q *Queue) trackers(job *Models.Job) error {
+	entries, err := q.dbm.GetTrackerEntries(job.AccountID, job.MangaID)
+	if err != nil {
+		return err
+	}
+
+	var manga Models.Manga
+	if err := q.dbm.GetMangaMetadata(&manga, job.MangaID); err != nil {
+		return err
+	}
+
+	progress, allRead, err := q.dbm.GetReadingSummary(job.AccountID, job.MangaID)
+	if err != nil {
+		return err
+	}
+
+	// Only a manga that finished publishing can be completed by reading it to the end
+	finished := manga.Status == "completed"
+
+	failed := []string{}
+	for i := range entries {
+		entry := &entries[i]
+		if err := q.pushTracker(entry, progress, allRead, finished); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+
+	if len(failed) > 0 {
+		err := fmt.Errorf("Failed to update trackers: %s", strings.Join(failed, "; "))
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// pushTracker Sends the progress of a manga to one tracker and records it on the entry
+func (q *Queue) pushTracker(entry *Models.TrackerEntry, progress int, allRead bool, finished bool) error {
+	tracker, exists := q.Trackers[entry.Tracker]
+	if !exists {
+		return fmt.Errorf("Unknown tracker: %s", entry.Tracker)
+	}
+
+	var account Models.TrackerAccount
+	if err := q.dbm.GetTrackerAccount(&account, entry.AccountID, entry.Tracker); err != nil {
+		return err
+	}
+
+	err := tracker.Update(&account, entry.RemoteID, Trackers.Update{
+		Progress: progress,
+		Status:   entry.ResolveStatus(progress, allRead, finished),
+		Score:    entry.Score,
+	})
+
+	// Keep the refreshed tokens even if the update failed
+	if saveErr := q.dbm.SaveTrackerAccount(&account); err == nil {
+		err = saveErr
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	entry.Progress = progress
+	entry.SyncedAt = &now
+	return q.dbm.SaveTrackerEntry(entry)
+}
@@ -0,0 +1,81 @@
+package Queue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/Trackers"
+)
+
+// flakyTracker Fails the first updates it gets, then records them
+type flakyTracker struct {
+	failures int
+	updates  chan Trackers.Update
+}
+
+func (flakyTracker) Name() string     { return "flaky" }
+func (flakyTracker) LinkSite() string { return "flaky" }
+
+func (tracker *flakyTracker) Update(account *Models.TrackerAccount, remoteID string, update Trackers.Update) error {
+	if tracker.failures > 0 {
+		tracker.failures--
+		return fmt.Errorf("Tracker is down")
+	}
+
+	account.AccessToken = "refreshed"
+	tracker.updates <- update
+	return nil
+}
+
+func TestTrackerJobRetries(t *testing.T) {
+	q, dbm, _ := linkedQueue(t)
+	tracker := &flakyTracker{failures: 2, updates: make(chan Trackers.Update, 1)}
+	q.Trackers = Trackers.New(tracker)
+	q.RetryDelay = 10 * time.Millisecond
+
+	manga := Models.Manga{ID: "a", Name: "Alpha", APIProvider: "mangadex"}
+	if err := dbm.AddManga(&manga); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbm.SaveTrackerAccount(&Models.TrackerAccount{AccountID: 1, Tracker: tracker.Name(), AccessToken: "token"}); err != nil {
+		t.Fatal(err)
+	}
+	entry := Models.TrackerEntry{AccountID: 1, MangaID: manga.MangaID, Tracker: tracker.Name(), RemoteID: "1", Status: Models.TrackOnHold, Score: 6}
+	if err := dbm.SaveTrackerEntry(&entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.EnqueueTrackers(1, manga.MangaID); err != nil {
+		t.Fatalf("EnqueueTrackers: %v", err)
+	}
+
+	select {
+	case update := <-tracker.updates:
+		if update.Status != Models.TrackOnHold || update.Score != 6 {
+			t.Errorf("got update %+v", update)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the tracker job was not retried")
+	}
+
+	// The worker saves the job after the update returns
+	var job Models.Job
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if err := dbm.DB.Where("type = ?", Models.TrackerJob).First(&job).Error; err == nil && job.Status == Models.JobCompleted {
+			break
+		}
+	}
+	if job.Status != Models.JobCompleted || job.Attempts != 2 || job.Error != "" {
+		t.Errorf("got job %s after %d attempts: %q", job.Status, job.Attempts, job.Error)
+	}
+
+	var account Models.TrackerAccount
+	if err := dbm.GetTrackerAccount(&account, 1, tracker.Name()); err != nil || account.AccessToken != "refreshed" {
+		t.Errorf("got saved token %q: %v", account.AccessToken, err)
+	}
+}
@@ -0,0 +1,377 @@
+package Tachiyomi
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/golang/glog"
+	"google.golang.org/protobuf/encoding/protowire"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Largest decompressed backup accepted, protects against gzip bombs
+const maxBackupSize = 256 << 20
+
+// Backup is the part of a Tachiyomi/Mihon backup (.tachibk) that gets imported
+// Field numbers follow the Backup.proto of Tachiyomi, unknown fields are skipped
+type Backup struct {
+	Manga      []Manga
+	Categories []Category
+	Sources    []Source
+}
+
+type Manga struct {
+	Source     int64
+	URL        string
+	Title      string
+	Chapters   []Chapter
+	Categories []int64 // Order of the categories the manga is in
+	History    []History
+	Favorite   bool
+}
+
+type Chapter struct {
+	URL           string
+	Name          string
+	Read          bool
+	LastPageRead  int64   // 0-based index of the last page read
+	ChapterNumber float32 // -1 if the source did not know it
+}
+
+type Category struct {
+	Name  string
+	Order int64
+}
+
+type Source struct {
+	Name string
+	ID   int64
+}
+
+type History struct {
+	URL      string // URL of the chapter
+	LastRead int64  // Unix time in milliseconds
+}
+
+// field A decoded protobuf field, varint and fixed values are stored in number
+type field struct {
+	num    protowire.Number
+	typ    protowire.Type
+	bytes  []byte
+	number uint64
+}
+
+func (f field) String() string { return string(f.bytes) }
+func (f field) Int64() int64   { return int64(f.number) }
+func (f field) Bool() bool     { return f.number != 0 }
+func (f field) Float32() float32 {
+	return math.Float32frombits(uint32(f.number))
+}
+
+// Int64s Reads a repeated int64 field, which may be packed or not
+func (f field) Int64s() ([]int64, error) {
+	if f.typ != protowire.BytesType {
+		return []int64{f.Int64()}, nil
+	}
+
+	var values []int64
+	b := f.bytes
+	for len(b) > 0 {
+		v, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		values = append(values, int64(v))
+		b = b[n:]
+	}
+
+	return values, nil
+}
+
+// parseFields Calls fn with every field of an encoded message
+func parseFields(b []byte, fn func(f field) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		f := field{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.number, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(b)
+			f.number = uint64(v)
+		case protowire.Fixed64Type:
+			f.number, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Read Parses a backup, gzipped like .tachibk files or not
+func Read(r io.Reader) (Backup, error) {
+	buffered := bufio.NewReader(r)
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			err = fmt.Errorf("Failed to decompress backup: %v", err)
+			glog.Error(err)
+			return Backup{}, err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = buffered
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, maxBackupSize+1))
+	if err != nil {
+		err = fmt.Errorf("Failed to read backup: %v", err)
+		glog.Error(err)
+		return Backup{}, err
+	}
+	if len(data) > maxBackupSize {
+		err := fmt.Errorf("Backup is larger than %d MB", maxBackupSize>>20)
+		glog.Error(err)
+		return Backup{}, err
+	}
+
+	backup, err := parseBackup(data)
+	if err != nil {
+		err = fmt.Errorf("Failed to parse backup: %v", err)
+		glog.Error(err)
+		return Backup{}, err
+	}
+
+	return backup, nil
+}
+
+func parseBackup(b []byte) (Backup, error) {
+	var backup Backup
+	err := parseFields(b, func(f field) error {
+		switch f.num {
+		case 1:
+			manga, err := parseManga(f.bytes)
+			backup.Manga = append(backup.Manga, manga)
+			return err
+		case 2:
+			var category Category
+			err := parseFields(f.bytes, func(f field) error {
+				switch f.num {
+				case 1:
+					category.Name = f.String()
+				case 2:
+					category.Order = f.Int64()
+				}
+				return nil
+			})
+			backup.Categories = append(backup.Categories, category)
+			return err
+		case 101:
+			var source Source
+			err := parseFields(f.bytes, func(f field) error {
+				switch f.num {
+				case 1:
+					source.Name = f.String()
+				case 2:
+					source.ID = f.Int64()
+				}
+				return nil
+			})
+			backup.Sources = append(backup.Sources, source)
+			return err
+		}
+		return nil
+	})
+
+	return backup, err
+}
+
+func parseManga(b []byte) (Manga, error) {
+	var manga Manga
+	err := parseFields(b, func(f field) error {
+		switch f.num {
+		case 1:
+			manga.Source = f.Int64()
+		case 2:
+			manga.URL = f.String()
+		case 3:
+			manga.Title = f.String()
+		case 16:
+			chapter, err := parseChapter(f.bytes)
+			manga.Chapters = append(manga.Chapters, chapter)
+			return err
+		case 17:
+			orders, err := f.Int64s()
+			manga.Categories = append(manga.Categories, orders...)
+			return err
+		case 100:
+			manga.Favorite = f.Bool()
+		case 104:
+			var history History
+			err := parseFields(f.bytes, func(f field) error {
+				switch f.num {
+				case 1:
+					history.URL = f.String()
+				case 2:
+					history.LastRead = f.Int64()
+				}
+				return nil
+			})
+			manga.History = append(manga.History, history)
+			return err
+		}
+		return nil
+	})
+
+	return manga, err
+}
+
+func parseChapter(b []byte) (Chapter, error) {
+	chapter := Chapter{ChapterNumber: -1}
+	err := parseFields(b, func(f field) error {
+		switch f.num {
+		case 1:
+			chapter.URL = f.String()
+		case 2:
+			chapter.Name = f.String()
+		case 4:
+			chapter.Read = f.Bool()
+		case 6:
+			chapter.LastPageRead = f.Int64()
+		case 9:
+			chapter.ChapterNumber = f.Float32()
+		}
+		return nil
+	})
+
+	return chapter, err
+}
+
+// Name of the source every MangaDex extension language registers
+const mangaDexSource = "MangaDex"
+
+var uuidRegex = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+
+// SourceName Gets the name of a source from the source list of the backup
+func (backup *Backup) SourceName(id int64) string {
+	for _, source := range backup.Sources {
+		if source.ID == id {
+			return source.Name
+		}
+	}
+
+	return fmt.Sprint(id)
+}
+
+// MangaDexID Gets the MangaDex id of a manga from a MangaDex source
+// Returns false for manga from any other source
+func (backup *Backup) MangaDexID(manga *Manga) (string, bool) {
+	if !strings.EqualFold(backup.SourceName(manga.Source), mangaDexSource) {
+		return "", false
+	}
+
+	return ProviderID(manga.URL)
+}
+
+// ProviderID Gets the MangaDex id out of a manga or chapter URL, like /manga/{id} or /chapter/{id}
+func ProviderID(URL string) (string, bool) {
+	id := uuidRegex.FindString(strings.ToLower(URL))
+	return id, id != ""
+}
+
+// CategoryNames Gets the names of the categories a manga is in
+func (backup *Backup) CategoryNames(manga *Manga) []string {
+	names := []string{}
+	for _, order := range manga.Categories {
+		for _, category := range backup.Categories {
+			if category.Order == order {
+				names = append(names, category.Name)
+				break
+			}
+		}
+	}
+
+	return names
+}
+
+// LastRead Gets when a chapter was last read in milliseconds, 0 if there is no history
+func (manga *Manga) LastRead(URL string) int64 {
+	for _, history := range manga.History {
+		if history.URL == URL {
+			return history.LastRead
+		}
+	}
+
+	return 0
+}
+
+// Progress Maps the read chapters of a backup manga onto chapters of the library
+// Chapters are matched by MangaDex id, then by chapter number
+func (manga *Manga) Progress(chapters []Models.Chapter) []Models.ReadProgress {
+	byID := make(map[string]*Models.Chapter)
+	byNumber := make(map[float32][]*Models.Chapter)
+	for i := range chapters {
+		byID[chapters[i].ID] = &chapters[i]
+		if _, number := chapters[i].ReadingOrder(); !math.IsInf(number, 1) {
+			byNumber[float32(number)] = append(byNumber[float32(number)], &chapters[i])
+		}
+	}
+
+	progress := []Models.ReadProgress{}
+	for _, read := range manga.Chapters {
+		if !read.Read && read.LastPageRead <= 0 {
+			continue
+		}
+
+		var matches []*Models.Chapter
+		if id, ok := ProviderID(read.URL); ok && byID[id] != nil {
+			matches = []*Models.Chapter{byID[id]}
+		} else if read.ChapterNumber >= 0 {
+			matches = byNumber[read.ChapterNumber]
+		}
+
+		for _, chapter := range matches {
+			entry := Models.ReadProgress{
+				ChapterID: chapter.ChapterID,
+				MangaID:   chapter.MangaID,
+				Read:      read.Read,
+				LastPage:  int(read.LastPageRead) + 1,
+			}
+
+			if read.Read {
+				entry.LastPage = chapter.PageNumber
+				if lastRead := manga.LastRead(read.URL); lastRead > 0 {
+					completedAt := time.UnixMilli(lastRead)
+					entry.CompletedAt = &completedAt
+				}
+			}
+
+			progress = append(progress, entry)
+		}
+	}
+
+	return progress
+}
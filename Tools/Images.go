@@ -0,0 +1,100 @@
+package Tools
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+)
+
+// Scales an image down to the given width, keeping its aspect ratio
+// Each output pixel is the average of the source pixels it covers
+// Images already narrower than width are returned unchanged
+func ResizeImage(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	if width <= 0 || width >= bounds.Dx() {
+		return src
+	}
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	// Work on a plain RGBA copy so pixel access is cheap
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * bounds.Dy() / height
+		y1 := (y + 1) * bounds.Dy() / height
+		for x := 0; x < width; x++ {
+			x0 := x * bounds.Dx() / width
+			x1 := (x + 1) * bounds.Dx() / width
+
+			var r, g, b, a, count uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					i := rgba.PixOffset(sx, sy)
+					r += uint32(rgba.Pix[i])
+					g += uint32(rgba.Pix[i+1])
+					b += uint32(rgba.Pix[i+2])
+					a += uint32(rgba.Pix[i+3])
+					count++
+				}
+			}
+
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / count),
+				G: uint8(g / count),
+				B: uint8(b / count),
+				A: uint8(a / count),
+			})
+		}
+	}
+
+	return dst
+}
+
+// Decodes an image, scales it down to width and writes it out as a JPEG
+func Thumbnail(src io.Reader, dst io.Writer, width int) error {
+	img, _, err := image.Decode(src)
+	if err != nil {
+		err = fmt.Errorf("Failed to decode image: %w", err)
+		glog.Error(err)
+		return err
+	}
+
+	if err := jpeg.Encode(dst, ResizeImage(img, width), &jpeg.Options{Quality: 85}); err != nil {
+		err = fmt.Errorf("Failed to encode thumbnail: %w", err)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Reads the dimensions of an image file without decoding all of it
+// Returns zeros if the file is not a readable image
+func ImageSize(path string) (int, int) {
+	file, err := os.Open(path)
+	if err != nil {
+		glog.Warning("Failed to open image: ", err)
+		return 0, 0
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		glog.Warning("Failed to read image size: ", err)
+		return 0, 0
+	}
+
+	return config.Width, config.Height
+}
@@ -2,16 +2,18 @@ package Tools
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/golang/glog"
-	"hash/crc32"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,6 +21,11 @@ import (
 // Returns the response body as a byte array
 // Tries 4 times before giving up, each attempt is n second apart
 func RequestGET(fullURL string, args map[string]string) ([]byte, error) {
+	return RequestGETHeaders(fullURL, args, nil)
+}
+
+// Sends a GET request like RequestGET, with extra request headers
+func RequestGETHeaders(fullURL string, args map[string]string, headers map[string]string) ([]byte, error) {
 	glog.Info("Sending GET request to ", fullURL, "\nParams: ", args, "\n")
 	for i := 1; i < 5; i++ {
 		client := http.Client{}
@@ -47,6 +54,10 @@ func RequestGET(fullURL string, args map[string]string) ([]byte, error) {
 			return []byte(""), err
 		}
 
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+
 		// Response
 		resp, err := client.Do(req)
 		if err != nil || resp.StatusCode != 200 {
@@ -73,6 +84,63 @@ func RequestGET(fullURL string, args map[string]string) ([]byte, error) {
 	return []byte(""), err
 }
 
+// Sends a POST request with the given body and headers
+// Returns the response body as a byte array, responses other than 2xx are returned as an error
+// Tries 4 times before giving up on connection errors, server errors and rate limits
+func RequestPOST(fullURL string, contentType string, body []byte, headers map[string]string) ([]byte, error) {
+	return RequestWithBody("POST", fullURL, contentType, body, headers)
+}
+
+// Sends a request with a body, like RequestPOST, using any method
+func RequestWithBody(method string, fullURL string, contentType string, body []byte, headers map[string]string) ([]byte, error) {
+	glog.Info("Sending ", method, " request to ", fullURL)
+	for i := 1; i < 5; i++ {
+		client := http.Client{}
+
+		req, err := http.NewRequest(method, fullURL, bytes.NewReader(body))
+		if err != nil {
+			glog.Error("Failed to create request:", err)
+			return []byte(""), err
+		}
+
+		req.Header.Set("Content-Type", contentType)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil || resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			if err == nil {
+				resp.Body.Close()
+			}
+			glog.Warning("Failed request: ", err, "\nRetrying after "+strconv.Itoa(i)+" seconds")
+			time.Sleep(time.Duration(i) * time.Second)
+			continue
+		}
+
+		defer resp.Body.Close()
+
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			glog.Error("Failed to read response body from request:", err)
+			return []byte(""), err
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			err := fmt.Errorf("Request failed with status %d: %s", resp.StatusCode, respBody)
+			glog.Error(err)
+			return respBody, err
+		}
+
+		glog.Info("Successfully sent request, data received")
+		return respBody, nil
+	}
+
+	err := errors.New("Failed to send request after 4 attempts")
+	glog.Error(err)
+	return []byte(""), err
+}
+
 // Downloads a file from a url and returns an io.ReadCloser for later copying
 func DownloadFile(url string, filename string, directory string) (string, io.Reader, error) {
 	// Create the file
@@ -108,10 +176,11 @@ func DownloadFile(url string, filename string, directory string) (string, io.Rea
 }
 
 // Hashes a file, accepts a io.Reader interface
+// Returns the hex encoded SHA-256 digest of the contents
 func HashFile(response io.Reader) (string, error) {
-	crcHash := crc32.NewIEEE()
+	shaHash := sha256.New()
 
-	_, err := io.Copy(crcHash, response)
+	_, err := io.Copy(shaHash, response)
 
 	if err != nil {
 		err = fmt.Errorf("Failed to hash response body: %w", err)
@@ -119,6 +188,30 @@ func HashFile(response io.Reader) (string, error) {
 		return "", err
 	}
 
-	checksum := strconv.FormatUint(uint64(crcHash.Sum32()), 16)
+	checksum := hex.EncodeToString(shaHash.Sum(nil))
 	return checksum, nil
 }
+
+// Checks a SHA-256 digest against an expected hash
+// The expected hash may be a prefix of the digest (as embedded in some filenames)
+// Returns false if the expected hash is empty
+func MatchesHash(expected string, digest string) bool {
+	if expected == "" {
+		return false
+	}
+
+	return strings.HasPrefix(strings.ToLower(digest), strings.ToLower(expected))
+}
+
+// Replaces characters that are not allowed in file or folder names
+func SanitizeFilename(name string) string {
+	replacer := strings.NewReplacer("/", "_", "\\", "_", ":", "_", "*", "_", "?", "_", "\"", "_", "<", "_", ">", "_", "|", "_")
+	name = strings.TrimSpace(replacer.Replace(name))
+
+	// Avoid names that would walk out of the parent folder
+	if name == "." || name == ".." {
+		name = "_"
+	}
+
+	return name
+}
@@ -0,0 +1,98 @@
+package Trackers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/Tools"
+	"github.com/golang/glog"
+	"math"
+	"strconv"
+	"time"
+)
+
+// AniList Updates list entries through the GraphQL API of AniList
+// Its access tokens last a year and cannot be refreshed
+type AniList struct {
+	URL string
+}
+
+var aniListStatuses = map[string]string{
+	Models.TrackReading:    "CURRENT",
+	Models.TrackCompleted:  "COMPLETED",
+	Models.TrackOnHold:     "PAUSED",
+	Models.TrackDropped:    "DROPPED",
+	Models.TrackPlanToRead: "PLANNING",
+	Models.TrackRereading:  "REPEATING",
+}
+
+const aniListMutation = `mutation ($mediaId: Int, $progress: Int, $status: MediaListStatus, $scoreRaw: Int) {
+	SaveMediaListEntry(mediaId: $mediaId, progress: $progress, status: $status, scoreRaw: $scoreRaw) { id }
+}`
+
+type aniListResponse struct {
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (AniList) Name() string {
+	return "anilist"
+}
+
+func (AniList) LinkSite() string {
+	return "al"
+}
+
+func (tracker AniList) Update(account *Models.TrackerAccount, remoteID string, update Update) error {
+	if !account.ExpiresAt.IsZero() && time.Now().After(account.ExpiresAt) {
+		err := fmt.Errorf("AniList token expired, link the tracker again")
+		glog.Error(err)
+		return err
+	}
+
+	mediaID, err := strconv.Atoi(remoteID)
+	if err != nil {
+		err = fmt.Errorf("Invalid AniList id: %s", remoteID)
+		glog.Error(err)
+		return err
+	}
+
+	variables := map[string]any{
+		"mediaId":  mediaID,
+		"progress": update.Progress,
+		"status":   aniListStatuses[update.Status],
+	}
+	// Leave the score on AniList alone unless one was given
+	if update.Score > 0 {
+		variables["scoreRaw"] = int(math.Round(update.Score * 10)) // Out of 100
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"query":     aniListMutation,
+		"variables": variables,
+	})
+	if err != nil {
+		return err
+	}
+
+	respBody, err := Tools.RequestPOST(tracker.URL, "application/json", body, map[string]string{
+		"Authorization": "Bearer " + account.AccessToken,
+		"Accept":        "application/json",
+	})
+
+	// GraphQL errors come with a 4xx status and a JSON body explaining them
+	var response aniListResponse
+	if jsonErr := json.Unmarshal(respBody, &response); jsonErr == nil && len(response.Errors) > 0 {
+		err = errors.New(response.Errors[0].Message)
+	}
+	if err != nil {
+		err = fmt.Errorf("Failed to update AniList entry %s: %v", remoteID, err)
+		glog.Error(err)
+		return err
+	}
+
+	glog.Info("Updated AniList entry ", remoteID, " to ", update.Progress, " chapters")
+	return nil
+}
@@ -0,0 +1,148 @@
+package Trackers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CookieUzen/mangascribe/Models"
+)
+
+// aniListRequest A GraphQL request received by a fake AniList
+type aniListRequest struct {
+	Authorization string
+	Query         string         `json:"query"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// fakeAniList Records the requests it gets and answers with the responses given, then with an empty success
+func fakeAniList(t *testing.T, responses ...func(w http.ResponseWriter)) (AniList, *[]aniListRequest) {
+	t.Helper()
+
+	requests := &[]aniListRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		request := aniListRequest{Authorization: r.Header.Get("Authorization")}
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Errorf("bad request body %q: %v", body, err)
+		}
+		*requests = append(*requests, request)
+
+		if len(*requests) <= len(responses) {
+			responses[len(*requests)-1](w)
+			return
+		}
+		io.WriteString(w, `{"data":{"SaveMediaListEntry":{"id":1}}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	return AniList{URL: server.URL}, requests
+}
+
+func TestAniListUpdate(t *testing.T) {
+	tracker, requests := fakeAniList(t)
+	account := &Models.TrackerAccount{AccessToken: "token"}
+
+	err := tracker.Update(account, "30013", Update{Progress: 12, Status: Models.TrackOnHold, Score: 7.5})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if len(*requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(*requests))
+	}
+	request := (*requests)[0]
+	if request.Authorization != "Bearer token" {
+		t.Errorf("got Authorization %q", request.Authorization)
+	}
+	if request.Query != aniListMutation {
+		t.Errorf("got query %q", request.Query)
+	}
+
+	// JSON numbers decode as float64
+	want := map[string]any{"mediaId": 30013.0, "progress": 12.0, "status": "PAUSED", "scoreRaw": 75.0}
+	if len(request.Variables) != len(want) {
+		t.Errorf("got variables %v, want %v", request.Variables, want)
+	}
+	for key, value := range want {
+		if request.Variables[key] != value {
+			t.Errorf("got %s %v, want %v", key, request.Variables[key], value)
+		}
+	}
+}
+
+func TestAniListStatuses(t *testing.T) {
+	want := map[string]string{
+		Models.TrackReading:    "CURRENT",
+		Models.TrackCompleted:  "COMPLETED",
+		Models.TrackOnHold:     "PAUSED",
+		Models.TrackDropped:    "DROPPED",
+		Models.TrackPlanToRead: "PLANNING",
+		Models.TrackRereading:  "REPEATING",
+	}
+
+	for status, aniList := range want {
+		tracker, requests := fakeAniList(t)
+		if err := tracker.Update(&Models.TrackerAccount{AccessToken: "token"}, "1", Update{Status: status}); err != nil {
+			t.Fatalf("Update %s: %v", status, err)
+		}
+		if got := (*requests)[0].Variables["status"]; got != aniList {
+			t.Errorf("status %s: got %v, want %s", status, got, aniList)
+		}
+	}
+}
+
+func TestAniListKeepsScoreWhenUnscored(t *testing.T) {
+	tracker, requests := fakeAniList(t)
+
+	if err := tracker.Update(&Models.TrackerAccount{AccessToken: "token"}, "1", Update{Progress: 3, Status: Models.TrackReading}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if score, sent := (*requests)[0].Variables["scoreRaw"]; sent {
+		t.Errorf("sent scoreRaw %v without a score", score)
+	}
+}
+
+func TestAniListErrors(t *testing.T) {
+	tracker, requests := fakeAniList(t, func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"errors":[{"message":"Invalid media id","status":400}],"data":null}`)
+	})
+
+	err := tracker.Update(&Models.TrackerAccount{AccessToken: "token"}, "1", Update{Progress: 1})
+	if err == nil {
+		t.Fatal("Update succeeded on a GraphQL error")
+	}
+	if len(*requests) != 1 {
+		t.Errorf("got %d requests, want client errors not to be retried", len(*requests))
+	}
+}
+
+func TestAniListExpiredToken(t *testing.T) {
+	tracker, requests := fakeAniList(t)
+	account := &Models.TrackerAccount{AccessToken: "token", ExpiresAt: time.Now().Add(-time.Hour)}
+
+	if err := tracker.Update(account, "1", Update{Progress: 1}); err == nil {
+		t.Fatal("Update succeeded with an expired token")
+	}
+	if len(*requests) != 0 {
+		t.Errorf("got %d requests with an expired token", len(*requests))
+	}
+}
+
+func TestAniListRetriesRateLimits(t *testing.T) {
+	tracker, requests := fakeAniList(t, func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	if err := tracker.Update(&Models.TrackerAccount{AccessToken: "token"}, "1", Update{Progress: 1}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if len(*requests) != 2 {
+		t.Errorf("got %d requests, want the rate limited one retried", len(*requests))
+	}
+}
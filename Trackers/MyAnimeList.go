@@ -0,0 +1,122 @@
+package Trackers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/Tools"
+	"github.com/golang/glog"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// MyAnimeList Updates list entries through the v2 API of MyAnimeList
+// Access tokens expire after an hour and are refreshed with the client id they were issued to
+type MyAnimeList struct {
+	API  string
+	Auth string // OAuth2 token endpoint
+}
+
+// MyAnimeList has no rereading status, rereading is a flag on a reading entry
+var myAnimeListStatuses = map[string]string{
+	Models.TrackReading:    "reading",
+	Models.TrackCompleted:  "completed",
+	Models.TrackOnHold:     "on_hold",
+	Models.TrackDropped:    "dropped",
+	Models.TrackPlanToRead: "plan_to_read",
+	Models.TrackRereading:  "reading",
+}
+
+// Leeway before the expiry of an access token at which it gets refreshed
+const tokenLeeway = 30 * time.Second
+
+type myAnimeListToken struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+func (MyAnimeList) Name() string {
+	return "myanimelist"
+}
+
+func (MyAnimeList) LinkSite() string {
+	return "mal"
+}
+
+// refresh Gets a new access token when the current one is about to expire
+func (tracker MyAnimeList) refresh(account *Models.TrackerAccount) error {
+	if account.ExpiresAt.IsZero() || time.Now().Add(tokenLeeway).Before(account.ExpiresAt) {
+		return nil
+	}
+
+	if account.RefreshToken == "" || account.ClientID == "" {
+		err := fmt.Errorf("MyAnimeList token expired, link the tracker again")
+		glog.Error(err)
+		return err
+	}
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {account.RefreshToken},
+		"client_id":     {account.ClientID},
+	}
+	body, err := Tools.RequestPOST(tracker.Auth, "application/x-www-form-urlencoded", []byte(form.Encode()), nil)
+	if err != nil {
+		err = fmt.Errorf("Failed to refresh MyAnimeList token: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	var token myAnimeListToken
+	if err := json.Unmarshal(body, &token); err != nil || token.AccessToken == "" {
+		err = fmt.Errorf("Failed to parse MyAnimeList token: %v", err)
+		glog.Error(err)
+		return err
+	}
+
+	account.AccessToken = token.AccessToken
+	if token.RefreshToken != "" {
+		account.RefreshToken = token.RefreshToken
+	}
+	account.ExpiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+
+	return nil
+}
+
+func (tracker MyAnimeList) Update(account *Models.TrackerAccount, remoteID string, update Update) error {
+	if _, err := strconv.Atoi(remoteID); err != nil {
+		err = fmt.Errorf("Invalid MyAnimeList id: %s", remoteID)
+		glog.Error(err)
+		return err
+	}
+
+	if err := tracker.refresh(account); err != nil {
+		return err
+	}
+
+	form := url.Values{
+		"status":            {myAnimeListStatuses[update.Status]},
+		"num_chapters_read": {strconv.Itoa(update.Progress)},
+		"is_rereading":      {strconv.FormatBool(update.Status == Models.TrackRereading)},
+	}
+	// Leave the score on MyAnimeList alone unless one was given
+	if update.Score > 0 {
+		form.Set("score", strconv.Itoa(int(math.Round(update.Score))))
+	}
+
+	fullURL := fmt.Sprintf("%s/manga/%s/my_list_status", tracker.API, remoteID)
+	_, err := Tools.RequestWithBody("PATCH", fullURL, "application/x-www-form-urlencoded", []byte(form.Encode()), map[string]string{
+		"Authorization": "Bearer " + account.AccessToken,
+	})
+	if err != nil {
+		err = fmt.Errorf("Failed to update MyAnimeList entry %s: %v", remoteID, err)
+		glog.Error(err)
+		return err
+	}
+
+	glog.Info("Updated MyAnimeList entry ", remoteID, " to ", update.Progress, " chapters")
+	return nil
+}
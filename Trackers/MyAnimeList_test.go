@@ -0,0 +1,161 @@
+package Trackers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/CookieUzen/mangascribe/Models"
+)
+
+// fakeMyAnimeList Records the list updates and token refreshes it gets
+// Updates answer with the statuses given, then with a success
+type fakeMyAnimeList struct {
+	Updates   []*http.Request
+	Forms     []url.Values
+	Refreshes []url.Values
+}
+
+func newFakeMyAnimeList(t *testing.T, statuses ...int) (MyAnimeList, *fakeMyAnimeList) {
+	t.Helper()
+
+	fake := &fakeMyAnimeList{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		fake.Refreshes = append(fake.Refreshes, r.PostForm)
+		io.WriteString(w, `{"access_token":"new access","refresh_token":"new refresh","expires_in":3600}`)
+	})
+	mux.HandleFunc("/manga/", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		fake.Updates = append(fake.Updates, r)
+		fake.Forms = append(fake.Forms, r.PostForm)
+
+		if len(fake.Updates) <= len(statuses) {
+			w.WriteHeader(statuses[len(fake.Updates)-1])
+			return
+		}
+		io.WriteString(w, `{"status":"reading"}`)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return MyAnimeList{API: server.URL, Auth: server.URL + "/token"}, fake
+}
+
+func TestMyAnimeListUpdate(t *testing.T) {
+	tracker, fake := newFakeMyAnimeList(t)
+	account := &Models.TrackerAccount{AccessToken: "token", ExpiresAt: time.Now().Add(time.Hour)}
+
+	err := tracker.Update(account, "2", Update{Progress: 12, Status: Models.TrackOnHold, Score: 7.5})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if len(fake.Updates) != 1 {
+		t.Fatalf("got %d updates, want 1", len(fake.Updates))
+	}
+	request := fake.Updates[0]
+	if request.Method != "PATCH" || request.URL.Path != "/manga/2/my_list_status" {
+		t.Errorf("got %s %s", request.Method, request.URL.Path)
+	}
+	if request.Header.Get("Authorization") != "Bearer token" {
+		t.Errorf("got Authorization %q", request.Header.Get("Authorization"))
+	}
+
+	want := url.Values{"status": {"on_hold"}, "num_chapters_read": {"12"}, "score": {"8"}, "is_rereading": {"false"}}
+	if fake.Forms[0].Encode() != want.Encode() {
+		t.Errorf("got form %s, want %s", fake.Forms[0].Encode(), want.Encode())
+	}
+	if len(fake.Refreshes) != 0 {
+		t.Errorf("refreshed a token that had not expired")
+	}
+}
+
+func TestMyAnimeListStatuses(t *testing.T) {
+	want := map[string]string{
+		Models.TrackReading:    "reading",
+		Models.TrackCompleted:  "completed",
+		Models.TrackOnHold:     "on_hold",
+		Models.TrackDropped:    "dropped",
+		Models.TrackPlanToRead: "plan_to_read",
+		Models.TrackRereading:  "reading",
+	}
+
+	for status, myAnimeList := range want {
+		tracker, fake := newFakeMyAnimeList(t)
+		if err := tracker.Update(&Models.TrackerAccount{AccessToken: "token"}, "1", Update{Status: status}); err != nil {
+			t.Fatalf("Update %s: %v", status, err)
+		}
+
+		form := fake.Forms[0]
+		if form.Get("status") != myAnimeList {
+			t.Errorf("status %s: got %q, want %q", status, form.Get("status"), myAnimeList)
+		}
+		if rereading := form.Get("is_rereading") == "true"; rereading != (status == Models.TrackRereading) {
+			t.Errorf("status %s: got is_rereading %q", status, form.Get("is_rereading"))
+		}
+	}
+}
+
+func TestMyAnimeListKeepsScoreWhenUnscored(t *testing.T) {
+	tracker, fake := newFakeMyAnimeList(t)
+
+	if err := tracker.Update(&Models.TrackerAccount{AccessToken: "token"}, "1", Update{Progress: 3, Status: Models.TrackReading}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if _, sent := fake.Forms[0]["score"]; sent {
+		t.Errorf("sent score %q without a score", fake.Forms[0].Get("score"))
+	}
+}
+
+func TestMyAnimeListRefreshesExpiredTokens(t *testing.T) {
+	tracker, fake := newFakeMyAnimeList(t)
+	account := &Models.TrackerAccount{AccessToken: "old access", RefreshToken: "old refresh", ClientID: "client", ExpiresAt: time.Now().Add(-time.Minute)}
+
+	if err := tracker.Update(account, "1", Update{Progress: 1}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if len(fake.Refreshes) != 1 {
+		t.Fatalf("got %d refreshes, want 1", len(fake.Refreshes))
+	}
+	refresh := fake.Refreshes[0]
+	if refresh.Get("grant_type") != "refresh_token" || refresh.Get("refresh_token") != "old refresh" || refresh.Get("client_id") != "client" {
+		t.Errorf("got refresh form %v", refresh)
+	}
+
+	if account.AccessToken != "new access" || account.RefreshToken != "new refresh" || time.Until(account.ExpiresAt) < 50*time.Minute {
+		t.Errorf("got account tokens %q %q expiring %v", account.AccessToken, account.RefreshToken, account.ExpiresAt)
+	}
+	if got := fake.Updates[0].Header.Get("Authorization"); got != "Bearer new access" {
+		t.Errorf("updated with Authorization %q, want the refreshed token", got)
+	}
+}
+
+func TestMyAnimeListRetriesServerErrors(t *testing.T) {
+	tracker, fake := newFakeMyAnimeList(t, http.StatusBadGateway)
+
+	if err := tracker.Update(&Models.TrackerAccount{AccessToken: "token"}, "1", Update{Progress: 1}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if len(fake.Updates) != 2 {
+		t.Errorf("got %d updates, want the failed one retried", len(fake.Updates))
+	}
+}
+
+func TestMyAnimeListClientErrors(t *testing.T) {
+	tracker, fake := newFakeMyAnimeList(t, http.StatusNotFound)
+
+	if err := tracker.Update(&Models.TrackerAccount{AccessToken: "token"}, "1", Update{Progress: 1}); err == nil {
+		t.Fatal("Update succeeded on a 404")
+	}
+	if len(fake.Updates) != 1 {
+		t.Errorf("got %d updates, want client errors not to be retried", len(fake.Updates))
+	}
+}
@@ -0,0 +1,65 @@
+package Trackers
+
+import (
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/Models"
+	"sort"
+)
+
+// Tracker is a site that logs what an account reads, like AniList or MyAnimeList
+type Tracker interface {
+	Name() string
+	// Key of the manga links holding the id of a manga on the tracker
+	LinkSite() string
+	// Sets the list entry of a manga, tokens are refreshed in place on the account
+	Update(account *Models.TrackerAccount, remoteID string, update Update) error
+}
+
+// Update is what gets pushed to a tracker list entry
+type Update struct {
+	Progress int     // Chapters read
+	Status   string  // One of the Models.Track statuses
+	Score    float64 // Out of 10, 0 if not scored
+}
+
+// Set Holds the trackers accounts can link, by name
+type Set map[string]Tracker
+
+// Default Gets every supported tracker talking to its real servers
+func Default() Set {
+	return New(
+		AniList{URL: Config.ANILIST_URL},
+		MyAnimeList{API: Config.MYANIMELIST_API, Auth: Config.MYANIMELIST_AUTH_URL},
+	)
+}
+
+func New(trackers ...Tracker) Set {
+	output := make(Set)
+	for _, tracker := range trackers {
+		output[tracker.Name()] = tracker
+	}
+
+	return output
+}
+
+// Names Lists the names of the trackers, sorted
+func (trackers Set) Names() []string {
+	names := make([]string, 0, len(trackers))
+	for name := range trackers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Match Finds the id of a manga on a tracker from the links of the manga
+func Match(tracker Tracker, manga *Models.Manga) (string, bool) {
+	for _, link := range manga.Links {
+		if link.Site == tracker.LinkSite() && link.Value != "" {
+			return link.Value, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/Mail"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// sendVerification Emails a verification token to the address of an account
+// The email is sent in the background, failures are only logged
+func sendVerification(dbm *DB.DBManager, mailer Mail.Mailer, account *Models.Account) error {
+	token, err := dbm.CreateAccountToken(account, Models.TokenVerifyEmail, Config.EMAIL_VERIFICATION_EXPIRATION)
+	if err != nil {
+		return err
+	}
+
+	go mailer.Send(Mail.Verification(account.Username, account.Email, token, Config.EMAIL_VERIFICATION_EXPIRATION))
+	return nil
+}
+
+// checkPassword Checks the password of the current account, responding with 403 if it is wrong
+// Wrong passwords count as failed logins, so guessing it through an API key is locked out like logging in
+// Accounts created through single sign-on have no password. They need their second factor instead, which the
+// callers check after the password, or without one an API key from a recent single sign-on login
+func checkPassword(c *gin.Context, dbm *DB.DBManager, account *Models.Account, password string) bool {
+	if account.Password == "" {
+		if account.TOTPEnabled || currentAPIKey(c).FreshSSOLogin(Config.OIDC_REAUTH_WINDOW) {
+			return true
+		}
+
+		c.JSON(http.StatusForbidden, Models.Fail{Error: "Log in again through single sign-on to confirm this change"})
+		return false
+	}
+
+	if password == "" {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: "Current password is required"})
+		return false
+	}
+
+	if loginLocked(c, dbm, account.Username) {
+		return false
+	}
+
+	if ok, _ := DB.VerifyPassword(account.Password, password); !ok {
+		dbm.RecordLoginAttempt(account.Username, c.ClientIP(), false, Models.LoginFailedPassword)
+		c.JSON(http.StatusForbidden, Models.Fail{Error: "Current password is incorrect"})
+		return false
+	}
+
+	return true
+}
+
+// getAccountHandler Get the account of the API key
+// @Summary Get the current account
+// @Tags user
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} Models.Response_Account
+// @Failure 401,403 {object} Models.Fail
+// @Router /v1/accounts/me [get]
+func getAccountHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, Models.Response_Account{Account: currentAccount(c).ToJSON()})
+}
+
+// updateAccountHandler Change the username, email or password of the account
+// @Summary Update the current account
+// @Description change the username, email or password, the current password (and two-factor code if it is on) is needed to change the email or password
+// @Description changing the password revokes every API key of the account and returns a new one
+// @Description accounts created through single sign-on have no password, instead they need the two-factor code or an API key from a login in the last few minutes
+// @Description a new email has to be verified again, a verification email is sent to it
+// @Description wrong current passwords and two-factor codes count as failed logins and lock the account out like logging in
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param account body Models.UpdateAccountRequest true "Fields to change"
+// @Success 200 {object} Models.Response_Account
+// @Failure 400,401,403,409,429,502 {object} Models.Fail
+// @Router /v1/accounts/me [patch]
+func updateAccountHandler(c *gin.Context, dbm *DB.DBManager, mailer Mail.Mailer) {
+	var form Models.UpdateAccountRequest
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	account := currentAccount(c)
+	changeUsername := form.Username != "" && form.Username != account.Username
+	changeEmail := form.Email != "" && form.Email != account.Email
+	changePassword := form.NewPassword != ""
+
+	if changeEmail || changePassword {
+		if !checkPassword(c, dbm, account, form.CurrentPassword) || !secondFactor(c, dbm, account, form.OTP) {
+			return
+		}
+	}
+
+	// Check every change before making any, so a request is applied whole or not at all
+	if changePassword {
+		if err := DB.ValidatePassword(form.NewPassword); err != nil {
+			c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+			return
+		}
+	}
+
+	if changeUsername {
+		if taken, err := dbm.IsUsernameTaken(form.Username); err != nil {
+			c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+			return
+		} else if taken {
+			c.JSON(http.StatusConflict, Models.Fail{Error: "Username is taken"})
+			return
+		}
+	}
+
+	if changeEmail {
+		if taken, err := dbm.IsEmailTaken(form.Email); err != nil {
+			c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+			return
+		} else if taken {
+			c.JSON(http.StatusConflict, Models.Fail{Error: "Email is taken"})
+			return
+		}
+	}
+
+	username, email := "", ""
+	if changeUsername {
+		username = form.Username
+	}
+	if changeEmail {
+		email = form.Email
+	}
+
+	// The key replacing the revoked ones, saved with the new password
+	var key *Models.APIKey
+	if changePassword {
+		current := currentAPIKey(c)
+		generated, err := account.GenerateAPIKey(current.Label, current.ScopeList(), Config.DEFAULT_API_KEY_EXPIRATION)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+			return
+		}
+		key = generated
+	}
+
+	if err := dbm.UpdateAccount(account, username, email, form.NewPassword, key); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	if changeEmail {
+		// The email is already changed, it can be verified later by asking for another email
+		sendVerification(dbm, mailer, account)
+	}
+
+	response := Models.Response_Account{}
+	if key != nil {
+		keyJSON := key.ToJSON()
+		response.APIKey = &keyJSON
+	}
+
+	response.Account = account.ToJSON()
+	c.JSON(http.StatusOK, response)
+}
+
+// deleteAccountHandler Delete the account
+// @Summary Delete the current account
+// @Description delete the account with its API keys, reading progress, categories, follows and linked accounts. The manga stay in the library
+// @Description accounts with two-factor authentication also need a TOTP or recovery code
+// @Tags user
+// @Accept  json
+// @Security ApiKeyAuth
+// @Param account body Models.DeleteAccountRequest true "Current password and two-factor code"
+// @Success 204
+// @Failure 400,401,403,429,502 {object} Models.Fail
+// @Router /v1/accounts/me [delete]
+func deleteAccountHandler(c *gin.Context, dbm *DB.DBManager) {
+	var form Models.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	account := currentAccount(c)
+	if !checkPassword(c, dbm, account, form.Password) || !secondFactor(c, dbm, account, form.OTP) {
+		return
+	}
+
+	if err := dbm.DeleteAccount(account); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// resendVerificationHandler Send another verification email
+// @Summary Resend the verification email
+// @Description email a new verification link to the address of the account, earlier links stop working
+// @Tags user
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 202 {object} Models.Response_Message
+// @Failure 401,403,409,502 {object} Models.Fail
+// @Router /v1/accounts/me/verify [post]
+func resendVerificationHandler(c *gin.Context, dbm *DB.DBManager, mailer Mail.Mailer) {
+	account := currentAccount(c)
+	if account.EmailVerified {
+		c.JSON(http.StatusConflict, Models.Fail{Error: "Email is already verified"})
+		return
+	}
+
+	if err := sendVerification(dbm, mailer, account); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, Models.Response_Message{Message: "Verification email sent to " + account.Email})
+}
+
+// verifyEmailHandler Verify the email of an account
+// @Summary Verify an email
+// @Description confirm an email address with the token from the verification email, a token only works once
+// @Tags user
+// @Produce  json
+// @Param token query string true "Token from the verification email"
+// @Success 200 {object} Models.Response_Account
+// @Failure 400,502 {object} Models.Fail
+// @Router /v1/accounts/verify [get]
+func verifyEmailHandler(c *gin.Context, dbm *DB.DBManager) {
+	var token Models.AccountToken
+	if err := dbm.UseAccountToken(&token, c.Query("token"), Models.TokenVerifyEmail); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	if err := dbm.VerifyEmail(&token); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	var account Models.Account
+	if err := dbm.GetAccountByID(&account, token.AccountID); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Models.Response_Account{Account: account.ToJSON()})
+}
+
+// forgotPasswordHandler Email a password reset token
+// @Summary Forgot password
+// @Description email a token to reset the password to the account with this email, the response is the same whether there is one or not
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param email body Models.ForgotPasswordRequest true "Email of the account"
+// @Success 202 {object} Models.Response_Message
+// @Failure 400 {object} Models.Fail
+// @Router /v1/password/forgot [post]
+func forgotPasswordHandler(c *gin.Context, dbm *DB.DBManager, mailer Mail.Mailer) {
+	var form Models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	// Answer before looking the account up, so the time taken does not tell if it exists
+	c.JSON(http.StatusAccepted, Models.Response_Message{Message: "If an account uses this email, a reset token was sent to it"})
+
+	go func() {
+		var account Models.Account
+		if err := dbm.GetAccountByEmail(&account, form.Email); err != nil {
+			return
+		}
+
+		token, err := dbm.CreateAccountToken(&account, Models.TokenResetPassword, Config.PASSWORD_RESET_EXPIRATION)
+		if err != nil {
+			return
+		}
+
+		mailer.Send(Mail.PasswordReset(account.Username, account.Email, token, Config.PASSWORD_RESET_EXPIRATION))
+	}()
+}
+
+// resetPasswordHandler Set a new password with a reset token
+// @Summary Reset password
+// @Description set a new password with the token from the reset email, every API key of the account is revoked
+// @Description the token stops working if the email of the account changed since it was sent
+// @Tags user
+// @Accept  json
+// @Param reset body Models.ResetPasswordRequest true "Reset token and new password"
+// @Success 204
+// @Failure 400,502 {object} Models.Fail
+// @Router /v1/password/reset [post]
+func resetPasswordHandler(c *gin.Context, dbm *DB.DBManager) {
+	var form Models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	// Check the password first so a bad one does not use up the token
+	if err := DB.ValidatePassword(form.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	var token Models.AccountToken
+	if err := dbm.UseAccountToken(&token, form.Token, Models.TokenResetPassword); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	if err := dbm.ResetPassword(&token, form.NewPassword); err == DB.ErrTokenEmailChanged {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// listLoginsHandler List the latest logins of the account
+// @Summary List login attempts
+// @Description list the latest successful and failed logins to the account, newest first
+// @Tags user
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} Models.Response_LoginAttempts
+// @Failure 401,403,502 {object} Models.Fail
+// @Router /v1/accounts/me/logins [get]
+func listLoginsHandler(c *gin.Context, dbm *DB.DBManager) {
+	attempts, err := dbm.GetLoginAttempts(currentAccount(c).ID, Config.MAX_PAGE_SIZE)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	jsonAttempts := make([]Models.LoginAttemptJSON, len(attempts))
+	for i := range attempts {
+		jsonAttempts[i] = attempts[i].ToJSON()
+	}
+
+	c.JSON(http.StatusOK, Models.Response_LoginAttempts{Attempts: jsonAttempts})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestResetPasswordAfterEmailChange(t *testing.T) {
+	r, dbm, account, _ := keysServer(t)
+	r.POST("/v1/password/reset", func(c *gin.Context) { resetPasswordHandler(c, dbm) })
+
+	stale, err := dbm.CreateAccountToken(account, Models.TokenResetPassword, Config.PASSWORD_RESET_EXPIRATION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dbm.UpdateAccount(account, "", "alice@elsewhere.example.com", "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := request(r, "POST", "/v1/password/reset", "", `{"token":"`+stale+`","new_password":"password2"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("got %d resetting with a token sent to the old email: %s", w.Code, w.Body.String())
+	}
+
+	token, err := dbm.CreateAccountToken(account, Models.TokenResetPassword, Config.PASSWORD_RESET_EXPIRATION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := request(r, "POST", "/v1/password/reset", "", `{"token":"`+token+`","new_password":"password2"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("got %d resetting with a token sent to the new email: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestFirstAccountsRegisteringAtOnce(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(dir)
+
+	dbm := DB.Open()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := dbm.CreateAccount(Models.NewAccountRequest{Username: fmt.Sprintf("user%d", i), Password: "password1", Email: fmt.Sprintf("user%d@example.com", i)})
+			if err != nil {
+				t.Errorf("registering user%d: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if admins, err := dbm.CountAdmins(); err != nil || admins != 1 {
+		t.Fatalf("got %d admins (%v), want 1", admins, err)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/gin-gonic/gin"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// adminTarget Returns the account with the id in the path, responding with 404 if there is none
+func adminTarget(c *gin.Context, dbm *DB.DBManager) (*Models.Account, bool) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return nil, false
+	}
+
+	var account Models.Account
+	if err := dbm.GetAccountByID(&account, id); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: "Account not found"})
+		return nil, false
+	}
+
+	return &account, true
+}
+
+// dirSize Returns the size of the files under a folder, 0 if it does not exist
+func dirSize(root string) int64 {
+	var size int64
+	filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+
+		if info, err := entry.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size
+}
+
+// listUsersHandler List every account of the server
+// @Summary List accounts
+// @Description list every account with its role and whether it is disabled
+// @Tags admin
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} Models.Response_Accounts
+// @Failure 401,403,502 {object} Models.Fail
+// @Router /v1/admin/users [get]
+func listUsersHandler(c *gin.Context, dbm *DB.DBManager) {
+	accounts, err := dbm.ListAccounts()
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	jsonAccounts := make([]Models.AccountJSON, len(accounts))
+	for i := range accounts {
+		jsonAccounts[i] = accounts[i].ToJSON()
+	}
+
+	c.JSON(http.StatusOK, Models.Response_Accounts{Accounts: jsonAccounts})
+}
+
+// updateUserHandler Change the role of an account or disable it
+// @Summary Update an account
+// @Description change the role of an account, or disable it so it can not log in or use its API keys
+// @Description the last admin can not be demoted or disabled
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param id path int true "Account ID"
+// @Param account body Models.AdminUpdateAccountRequest true "Role and disabled state"
+// @Success 200 {object} Models.Response_Account
+// @Failure 400,401,403,404,409,502 {object} Models.Fail
+// @Router /v1/admin/users/{id} [patch]
+func updateUserHandler(c *gin.Context, dbm *DB.DBManager) {
+	var form Models.AdminUpdateAccountRequest
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	account, ok := adminTarget(c, dbm)
+	if !ok {
+		return
+	}
+
+	role := account.Role
+	if form.Role != "" {
+		role = form.Role
+	}
+	disabled := account.Disabled
+	if form.Disabled != nil {
+		disabled = *form.Disabled
+	}
+
+	// Someone has to be left to administer the server
+	if account.IsAdmin() && (role != Models.RoleAdmin || disabled) {
+		if admins, err := dbm.CountAdmins(); err != nil {
+			c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+			return
+		} else if admins <= 1 {
+			c.JSON(http.StatusConflict, Models.Fail{Error: "The last admin can not be demoted or disabled"})
+			return
+		}
+	}
+
+	if err := dbm.SetAccountRole(account, role, disabled); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Models.Response_Account{Account: account.ToJSON()})
+}
+
+// resetUserPasswordHandler Set a new password for an account
+// @Summary Reset the password of an account
+// @Description set a new password for an account, every API key of the account is revoked
+// @Tags admin
+// @Accept  json
+// @Security ApiKeyAuth
+// @Param id path int true "Account ID"
+// @Param password body Models.AdminResetPasswordRequest true "New password"
+// @Success 204
+// @Failure 400,401,403,404,502 {object} Models.Fail
+// @Router /v1/admin/users/{id}/password [post]
+func resetUserPasswordHandler(c *gin.Context, dbm *DB.DBManager) {
+	var form Models.AdminResetPasswordRequest
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	if err := DB.ValidatePassword(form.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	account, ok := adminTarget(c, dbm)
+	if !ok {
+		return
+	}
+
+	if _, err := dbm.ChangePassword(account, form.NewPassword); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	if _, err := dbm.RevokeAPIKeys(account, 0); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// revokeUserKeysHandler Revoke every API key of an account
+// @Summary Revoke the API keys of an account
+// @Tags admin
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param id path int true "Account ID"
+// @Success 200 {object} Models.Response_Revoked
+// @Failure 400,401,403,404,502 {object} Models.Fail
+// @Router /v1/admin/users/{id}/keys [delete]
+func revokeUserKeysHandler(c *gin.Context, dbm *DB.DBManager) {
+	account, ok := adminTarget(c, dbm)
+	if !ok {
+		return
+	}
+
+	revoked, err := dbm.RevokeAPIKeys(account, 0)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Models.Response_Revoked{Revoked: revoked})
+}
+
+// serverStatusHandler Get the status of the job queue and storage
+// @Summary Get the server status
+// @Description count the accounts, the jobs by status, the library and the space it and the database take on disk
+// @Tags admin
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} Models.Response_ServerStatus
+// @Failure 401,403,502 {object} Models.Fail
+// @Router /v1/admin/status [get]
+func serverStatusHandler(c *gin.Context, dbm *DB.DBManager) {
+	accounts, err := dbm.CountAccounts()
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	jobs, err := dbm.CountJobs()
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	var storage Models.StorageStatusJSON
+	if err := dbm.CountLibrary(&storage); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	storage.LibraryBytes = dirSize(Config.LIBRARY_PATH)
+	if info, err := os.Stat(Config.DB_PATH); err == nil {
+		storage.DatabaseBytes = info.Size()
+	}
+
+	c.JSON(http.StatusOK, Models.Response_ServerStatus{
+		Accounts: accounts,
+		Queue: Models.QueueStatusJSON{
+			Pending:   jobs[Models.JobPending],
+			Running:   jobs[Models.JobRunning],
+			Completed: jobs[Models.JobCompleted],
+			Failed:    jobs[Models.JobFailed],
+		},
+		Storage: storage,
+	})
+}
+
+// getSettingsHandler Get the settings of the server
+// @Summary Get the server settings
+// @Tags admin
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} Models.Response_Settings
+// @Failure 401,403,502 {object} Models.Fail
+// @Router /v1/admin/settings [get]
+func getSettingsHandler(c *gin.Context, dbm *DB.DBManager) {
+	var settings Models.Settings
+	if err := dbm.GetSettings(&settings); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Models.Response_Settings{Settings: settings.ToJSON()})
+}
+
+// updateSettingsHandler Change the settings of the server
+// @Summary Update the server settings
+// @Description open or close registration, fields that are not given are left as they are
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param settings body Models.UpdateSettingsRequest true "Settings to change"
+// @Success 200 {object} Models.Response_Settings
+// @Failure 400,401,403,502 {object} Models.Fail
+// @Router /v1/admin/settings [patch]
+func updateSettingsHandler(c *gin.Context, dbm *DB.DBManager) {
+	var form Models.UpdateSettingsRequest
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	var settings Models.Settings
+	if err := dbm.GetSettings(&settings); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	if form.OpenRegistration != nil {
+		settings.OpenRegistration = *form.OpenRegistration
+	}
+
+	if err := dbm.SaveSettings(&settings); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Models.Response_Settings{Settings: settings.ToJSON()})
+}
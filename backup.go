@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/Queue"
+	"github.com/CookieUzen/mangascribe/Tachiyomi"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"os"
+)
+
+// importBackupHandler Import a Tachiyomi/Mihon backup
+// @Summary Import a Tachiyomi backup
+// @Description queue a job adding the MangaDex manga of a Tachiyomi/Mihon backup (.tachibk) to the library and importing their categories and read chapters for the account, manga from other sources are skipped
+// @Description the report of the job is a Models.Response_LibraryImport
+// @Description backups larger than the configured upload size are refused with 413
+// @Tags library
+// @Accept  multipart/form-data
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param backup formData file true "Backup file"
+// @Success 202 {object} Models.Response_Job
+// @Failure 400,401,403,413,502 {object} Models.Fail
+// @Router /v1/library/import/backup [post]
+func importBackupHandler(c *gin.Context, queue *Queue.Queue) {
+	// The whole body is held in memory to queue it, so stop reading past the limit
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, Config.MAX_BACKUP_UPLOAD_SIZE)
+
+	header, err := c.FormFile("backup")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, Models.Fail{Error: fmt.Sprintf("Backup is larger than %d MB", Config.MAX_BACKUP_UPLOAD_SIZE>>20)})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	// Reject files that are not backups before queueing them
+	if _, err := Tachiyomi.Read(bytes.NewReader(content)); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	job, err := queue.EnqueueBackupImport(currentAccount(c).ID, content)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, Models.Response_Job{Job: job.ToJSON()})
+}
+
+// importBackupCommand Imports a backup from the command line
+// Usage: mangascribe import-backup <username or email> <backup file>
+// The downloads it queues are run the next time the server starts
+func importBackupCommand(dbm *DB.DBManager, queue *Queue.Queue, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("Usage: import-backup <username or email> <backup file>")
+	}
+
+	var account Models.Account
+	if err := dbm.GetAccount(&account, args[0]); err != nil {
+		return err
+	}
+
+	file, err := os.Open(args[1])
+	if err != nil {
+		return fmt.Errorf("Failed to open backup: %v", err)
+	}
+	defer file.Close()
+
+	backup, err := Tachiyomi.Read(file)
+	if err != nil {
+		return err
+	}
+
+	report, err := queue.ImportBackup(account.ID, &backup)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Added %d manga, %d already in the library, %d skipped, progress imported for %d chapters\n",
+		len(report.Added), len(report.Existing), len(report.Skipped), report.Progress)
+	for _, skipped := range report.Skipped {
+		fmt.Printf("Skipped %s (%s): %s\n", skipped.Title, skipped.Source, skipped.Reason)
+	}
+
+	return nil
+}
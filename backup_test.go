@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/Queue"
+	"github.com/gin-gonic/gin"
+)
+
+func TestImportBackupSize(t *testing.T) {
+	r, dbm, _, key := keysServer(t)
+	queue := Queue.New(dbm, Models.NewRegistry())
+	r.POST("/v1/library/import/backup", authMiddleware(dbm), requireScope(Models.ScopeLibraryWrite), func(c *gin.Context) { importBackupHandler(c, queue) })
+
+	upload := func(size int) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		file, err := form.CreateFormFile("backup", "backup.tachibk")
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Write(bytes.Repeat([]byte{'a'}, size))
+		form.Close()
+
+		req := httptest.NewRequest("POST", "/v1/library/import/backup", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+key.Key)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := upload(Config.MAX_BACKUP_UPLOAD_SIZE + 1); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("got %d uploading a backup over the limit: %s", w.Code, w.Body.String())
+	}
+
+	// Small enough to be read, but not a backup
+	if w := upload(1024); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d uploading a file that is not a backup: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// listCategoriesHandler List the categories of the account
+// @Summary List categories
+// @Description list the categories of the account with the manga in each of them
+// @Tags library
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} Models.Response_Categories
+// @Failure 401,403,502 {object} Models.Fail
+// @Router /v1/categories [get]
+func listCategoriesHandler(c *gin.Context, dbm *DB.DBManager) {
+	categories, err := dbm.GetCategories(currentAccount(c).ID)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	json_categories := make([]Models.CategoryJSON, len(categories))
+	for i := range categories {
+		json_categories[i] = categories[i].ToJSON()
+	}
+
+	c.JSON(http.StatusOK, Models.Response_Categories{Categories: json_categories})
+}
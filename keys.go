@@ -0,0 +1,190 @@
+package main
+
+import (
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"time"
+)
+
+// listKeysHandler List the API keys of the account
+// @Summary List API keys
+// @Description list the API keys of the account with their prefix, label, expiration and when they were last used
+// @Tags keys
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} Models.Response_APIKeyList
+// @Failure 401,403,502 {object} Models.Fail
+// @Router /v1/keys [get]
+func listKeysHandler(c *gin.Context, dbm *DB.DBManager) {
+	keys, err := dbm.GetAPIKeys(currentAccount(c))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	jsonKeys := make([]Models.APIKeyJSON, len(keys))
+	for i := range keys {
+		jsonKeys[i] = keys[i].ToJSON()
+	}
+
+	c.JSON(http.StatusOK, Models.Response_APIKeyList{APIKeys: jsonKeys})
+}
+
+// createKeyHandler Create a new API key
+// @Summary Create an API key
+// @Description create an API key with a label and scopes, expiring after the given number of days (30 if not given). The key is only shown in this response
+// @Description a key can only be given scopes the key making the request has, which it gets all of by default
+// @Description accounts with two-factor authentication also need a TOTP or recovery code
+// @Tags keys
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param key body Models.CreateAPIKeyRequest true "Label and expiration of the key"
+// @Success 201 {object} Models.Response_APIKey
+// @Failure 400,401,403,429,502 {object} Models.Fail
+// @Router /v1/keys [post]
+func createKeyHandler(c *gin.Context, dbm *DB.DBManager) {
+	var form Models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	current := currentAPIKey(c)
+	scopes := form.Scopes
+	if len(scopes) == 0 {
+		scopes = current.ScopeList()
+	}
+	for _, scope := range scopes {
+		if !current.HasScope(scope) {
+			c.JSON(http.StatusForbidden, Models.Fail{Error: "API key can not grant the " + scope + " scope it does not have"})
+			return
+		}
+	}
+
+	// Checked last so a code is not used up by a request that fails anyway
+	if !secondFactor(c, dbm, currentAccount(c), form.OTP) {
+		return
+	}
+
+	duration := Config.DEFAULT_API_KEY_EXPIRATION
+	if form.ExpiresInDays > 0 {
+		duration = time.Duration(form.ExpiresInDays) * time.Hour * 24
+	}
+
+	key, err := dbm.GenerateAPIKey(currentAccount(c), form.Label, scopes, duration)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, Models.Response_APIKey{APIKey: key.ToJSON()})
+}
+
+// revokeKeyHandler Revoke an API key
+// @Summary Revoke an API key
+// @Tags keys
+// @Security ApiKeyAuth
+// @Param id path int true "API key ID"
+// @Success 204
+// @Failure 400,401,403,404 {object} Models.Fail
+// @Router /v1/keys/{id} [delete]
+func revokeKeyHandler(c *gin.Context, dbm *DB.DBManager) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := dbm.RevokeAPIKey(currentAccount(c), id); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// rotateKeyHandler Replace an API key with a new one
+// @Summary Rotate an API key
+// @Description revoke an API key and create a new one with the same label, scopes and lifetime. The new key is only shown in this response
+// @Description only keys whose scopes the key making the request all has can be rotated
+// @Description accounts with two-factor authentication also need a TOTP or recovery code
+// @Tags keys
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param id path int true "API key ID"
+// @Param otp body Models.RotateAPIKeyRequest false "TOTP or recovery code"
+// @Success 200 {object} Models.Response_APIKey
+// @Failure 400,401,403,404,429,502 {object} Models.Fail
+// @Router /v1/keys/{id}/rotate [post]
+func rotateKeyHandler(c *gin.Context, dbm *DB.DBManager) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	// The body is optional for accounts without two-factor authentication
+	var form Models.RotateAPIKeyRequest
+	if err := c.ShouldBindJSON(&form); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	account := currentAccount(c)
+	var old Models.APIKey
+	if err := dbm.GetAPIKey(account, &old, id); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	// Like creating a key, rotating one can not hand out scopes the key making the request lacks
+	current := currentAPIKey(c)
+	for _, scope := range old.ScopeList() {
+		if !current.HasScope(scope) {
+			c.JSON(http.StatusForbidden, Models.Fail{Error: "API key can not grant the " + scope + " scope it does not have"})
+			return
+		}
+	}
+
+	// Checked last so a code is not used up by a request that fails anyway
+	if !secondFactor(c, dbm, account, form.OTP) {
+		return
+	}
+
+	key, err := dbm.RotateAPIKey(account, id)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Models.Response_APIKey{APIKey: key.ToJSON()})
+}
+
+// revokeKeysHandler Revoke every API key of the account
+// @Summary Revoke all API keys
+// @Description revoke every API key of the account, optionally keeping the key making the request
+// @Tags keys
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param keep_current query bool false "Keep the key used for this request"
+// @Success 200 {object} Models.Response_Revoked
+// @Failure 401,403,502 {object} Models.Fail
+// @Router /v1/keys [delete]
+func revokeKeysHandler(c *gin.Context, dbm *DB.DBManager) {
+	var keep uint
+	if c.Query("keep_current") == "true" {
+		keep = currentAPIKey(c).ID
+	}
+
+	revoked, err := dbm.RevokeAPIKeys(currentAccount(c), keep)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Models.Response_Revoked{Revoked: revoked})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/gin-gonic/gin"
+)
+
+// keysServer Opens a database in a temporary folder with one account, and serves the key routes
+// Returns the account and a full scope key of it
+func keysServer(t *testing.T) (*gin.Engine, *DB.DBManager, *Models.Account, *Models.APIKey) {
+	t.Helper()
+
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(dir) })
+
+	dbm := DB.Open()
+	account, err := dbm.CreateAccount(Models.NewAccountRequest{Username: "alice", Password: "password1", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := dbm.GenerateAPIKey(account, "full", Models.AllScopes, Config.DEFAULT_API_KEY_EXPIRATION)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	auth := r.Group("/v1", authMiddleware(&dbm))
+	auth.POST("/keys", requireScope(Models.ScopeAdmin), func(c *gin.Context) { createKeyHandler(c, &dbm) })
+	auth.POST("/keys/:id/rotate", requireScope(Models.ScopeAdmin), func(c *gin.Context) { rotateKeyHandler(c, &dbm) })
+
+	return r, &dbm, account, key
+}
+
+func request(r *gin.Engine, method string, path string, key string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+key)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRotateKeyScopes(t *testing.T) {
+	r, dbm, account, full := keysServer(t)
+
+	limited, err := dbm.GenerateAPIKey(account, "admin only", []string{Models.ScopeAdmin}, Config.DEFAULT_API_KEY_EXPIRATION)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := request(r, "POST", fmt.Sprintf("/v1/keys/%d/rotate", full.ID), limited.Key, "")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("got %d rotating a key with more scopes: %s", w.Code, w.Body.String())
+	}
+
+	w = request(r, "POST", fmt.Sprintf("/v1/keys/%d/rotate", limited.ID), full.Key, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d rotating a key with fewer scopes: %s", w.Code, w.Body.String())
+	}
+
+	var response Models.Response_APIKey
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.APIKey.Scopes) != 1 || response.APIKey.Scopes[0] != Models.ScopeAdmin {
+		t.Errorf("got scopes %v, want the rotated key's", response.APIKey.Scopes)
+	}
+}
+
+func TestRotateKeyTwoFactor(t *testing.T) {
+	r, dbm, account, full := keysServer(t)
+
+	if err := dbm.SetTOTPSecret(account, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"); err != nil {
+		t.Fatal(err)
+	}
+	codes, err := dbm.EnableTOTP(account, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := fmt.Sprintf("/v1/keys/%d/rotate", full.ID)
+
+	if w := request(r, "POST", path, full.Key, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("got %d rotating without a two-factor code: %s", w.Code, w.Body.String())
+	}
+	if w := request(r, "POST", path, full.Key, `{"otp":"000000"}`); w.Code != http.StatusUnauthorized {
+		t.Fatalf("got %d rotating with a wrong two-factor code: %s", w.Code, w.Body.String())
+	}
+
+	w := request(r, "POST", path, full.Key, `{"otp":"`+codes[0]+`"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d rotating with a recovery code: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/Local"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/Queue"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// parseID Parses a numeric id from the path, responding with 400 if it is invalid
+func parseID(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: "Invalid " + name})
+		return 0, false
+	}
+
+	return uint(id), true
+}
+
+// addMangaHandler Add a manga to the library and queue its chapters for download
+// @Summary Add a manga to the library
+// @Description search a provider (the default one if none is given) for a title, store the manga with its chapters and queue every volume chapter for download
+// @Tags library
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param manga body Models.AddMangaRequest true "Title to search for"
+// @Success 200 {object} Models.Response_Manga
+// @Failure 400,401,403,409,502 {object} Models.Fail
+// @Router /v1/library [post]
+func addMangaHandler(c *gin.Context, dbm *DB.DBManager, queue *Queue.Queue) {
+	var form Models.AddMangaRequest
+
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	API, err := queue.Providers.Get(form.Provider)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	if !API.Capabilities().Search {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: fmt.Sprintf("Provider %s does not support search", API.GetProvider())})
+		return
+	}
+
+	manga, err := API.SearchManga(form.Title)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	if status, err := addToLibrary(dbm, queue, API, &manga, form.Datasaver); err != nil {
+		c.JSON(status, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Models.Response_Manga{Manga: manga.ToJSON()})
+}
+
+// listLibraryHandler List the library with filters, sorting and full text search
+// @Summary List the library
+// @Description list the manga in the library, filtered, sorted and paginated with a cursor
+// @Tags library
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param q query string false "Search titles, alternative titles and descriptions. Words match as prefixes with full text search, or as substrings if the server was built without FTS5 (-tags sqlite_fts5)"
+// @Param tag query []string false "Only manga with this tag (name or provider id), can be repeated" collectionFormat(multi)
+// @Param status query string false "Publication status"
+// @Param content_rating query string false "Content rating"
+// @Param language query string false "Only manga with chapters in this language"
+// @Param provider query string false "Only manga from this provider"
+// @Param has_unread query bool false "Only manga with (true) or without (false) chapters the account has not read"
+// @Param sort query string false "Sort by title, updated or added" Enums(title, updated, added)
+// @Param order query string false "Sort order" Enums(asc, desc)
+// @Param limit query int false "Page size"
+// @Param cursor query string false "Cursor of the page to get, from next_cursor"
+// @Success 200 {object} Models.Response_MangaList
+// @Failure 400,401,403 {object} Models.Fail
+// @Router /v1/library [get]
+func listLibraryHandler(c *gin.Context, dbm *DB.DBManager) {
+	var query Models.LibraryQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+	query.AccountID = currentAccount(c).ID
+
+	mangas, cursor, err := dbm.ListLibrary(query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	json_manga := make([]Models.MangaJSON, len(mangas))
+	for i := range mangas {
+		json_manga[i] = mangas[i].ToJSON()
+	}
+
+	c.JSON(http.StatusOK, Models.Response_MangaList{Manga: json_manga, NextCursor: cursor})
+}
+
+// getMangaHandler Get a manga in the library with the download state of its chapters
+// @Summary Get a manga
+// @Description get a manga in the library with its volumes and the download state of each chapter
+// @Tags library
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param id path int true "Manga ID"
+// @Success 200 {object} Models.Response_Manga
+// @Failure 400,401,403,404 {object} Models.Fail
+// @Router /v1/library/{id} [get]
+func getMangaHandler(c *gin.Context, dbm *DB.DBManager) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	var manga Models.Manga
+	if err := dbm.GetManga(&manga, id); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Models.Response_Manga{Manga: manga.ToJSON()})
+}
+
+// getCoverHandler Serve the cover of a manga or one of its thumbnails
+// @Summary Get a manga cover
+// @Description serve the series cover, or a volume cover, at its original size or as a thumbnail
+// @Tags library
+// @Produce  image/jpeg,image/png
+// @Security ApiKeyAuth
+// @Param id path int true "Manga ID"
+// @Param size query string false "Thumbnail size (small, medium, large), original if empty"
+// @Param volume query string false "Volume number, the series cover if empty"
+// @Success 200 {file} file
+// @Success 304
+// @Failure 400,401,403,404 {object} Models.Fail
+// @Router /v1/library/{id}/cover [get]
+func getCoverHandler(c *gin.Context, dbm *DB.DBManager) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	size := c.Query("size")
+	if _, exists := Config.THUMBNAIL_SIZES[size]; size != "" && !exists {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: "Invalid size"})
+		return
+	}
+
+	var cover Models.Cover
+	if err := dbm.GetCover(&cover, id, c.Query("volume")); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	if cover.Hash == "" || cover.Manga == nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: "Cover has not been downloaded yet"})
+		return
+	}
+
+	// Regenerate thumbnails that went missing
+	mangaDir := cover.Manga.FolderPath()
+	coverPath := cover.Path(mangaDir, size)
+	if _, err := os.Stat(coverPath); err != nil {
+		if size == "" || cover.GenerateThumbnails(mangaDir) != nil {
+			c.JSON(http.StatusNotFound, Models.Fail{Error: "Cover file is missing"})
+			return
+		}
+	}
+
+	// The content only changes when the hash does, ServeFile answers If-None-Match with 304
+	c.Header("ETag", fmt.Sprintf(`"%s-%s"`, cover.Hash, size))
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(Config.COVER_CACHE_MAX_AGE.Seconds())))
+	c.File(coverPath)
+}
+
+// syncMangaHandler Queue a job refreshing the metadata and chapters of a manga
+// @Summary Sync a manga
+// @Description refresh the metadata of a manga from its provider, add new chapters and queue them for download
+// @Tags library
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param id path int true "Manga ID"
+// @Param datasaver query bool false "Download new chapters in data saver quality"
+// @Success 202 {object} Models.Response_Job
+// @Failure 400,401,403,404,502 {object} Models.Fail
+// @Router /v1/library/{id}/sync [post]
+func syncMangaHandler(c *gin.Context, dbm *DB.DBManager, queue *Queue.Queue) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	if exists, err := dbm.IsMangaIDInLibrary(id); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	} else if !exists {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: "Manga not found"})
+		return
+	}
+
+	job := Models.Job{
+		Type:      Models.SyncJob,
+		MangaID:   id,
+		AccountID: currentAccount(c).ID,
+		Datasaver: c.Query("datasaver") == "true",
+	}
+	if err := queue.Enqueue(&job); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, Models.Response_Job{Job: job.ToJSON()})
+}
+
+// exportMangaHandler Queue a job updating the exported mirror of a manga
+// @Summary Export a manga
+// @Description bring the Komga/Kavita mirror of a manga up to date, archives that are already current are kept
+// @Tags library
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param id path int true "Manga ID"
+// @Success 202 {object} Models.Response_Job
+// @Failure 400,401,403,404,502 {object} Models.Fail
+// @Router /v1/library/{id}/export [post]
+func exportMangaHandler(c *gin.Context, dbm *DB.DBManager, queue *Queue.Queue) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	if queue.Export == nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: "Library export is disabled"})
+		return
+	}
+
+	if exists, err := dbm.IsMangaIDInLibrary(id); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	} else if !exists {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: "Manga not found"})
+		return
+	}
+
+	job := Models.Job{
+		Type:      Models.ExportJob,
+		MangaID:   id,
+		AccountID: currentAccount(c).ID,
+	}
+	if err := queue.Enqueue(&job); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, Models.Response_Job{Job: job.ToJSON()})
+}
+
+// addToLibrary Stores a manga with its chapters and queues its covers and chapter downloads
+// Returns the HTTP status to answer with if it fails
+func addToLibrary(dbm *DB.DBManager, queue *Queue.Queue, API Models.APIProvider, manga *Models.Manga, datasaver bool) (int, error) {
+	if exists, err := dbm.IsMangaInLibrary(manga.APIProvider, manga.ID); err != nil {
+		return http.StatusBadGateway, err
+	} else if exists {
+		return http.StatusConflict, fmt.Errorf("Manga is already in the library")
+	}
+
+	if err := queue.AddManga(API, manga, datasaver); err != nil {
+		return http.StatusBadGateway, err
+	}
+
+	return http.StatusOK, nil
+}
+
+// importLocalHandler Import series from the local import folder
+// @Summary Import local manga
+// @Description import a series folder (or every series folder not in the library yet) of CBZ/ZIP archives or image folders, pages are copied into the library
+// @Description when importing every folder, folders that fail to import are reported as skipped and the others are still imported
+// @Tags library
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param import body Models.ImportRequest false "Series folder to import, empty imports every new folder"
+// @Success 200 {object} Models.Response_LibraryImport
+// @Failure 400,401,403,404,409,502 {object} Models.Fail
+// @Router /v1/library/import [post]
+func importLocalHandler(c *gin.Context, dbm *DB.DBManager, queue *Queue.Queue, local Local.API) {
+	var form Models.ImportRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&form); err != nil {
+			c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+			return
+		}
+	}
+
+	report := Models.Response_LibraryImport{
+		Added:    []Models.MangaJSON{},
+		Existing: []Models.MangaJSON{},
+		Skipped:  []Models.SkippedMangaJSON{},
+	}
+
+	// Import a single folder
+	if form.Path != "" {
+		manga, err := local.FetchManga(form.Path)
+		if err != nil {
+			c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+			return
+		}
+
+		if status, err := addToLibrary(dbm, queue, local, &manga, false); err != nil {
+			c.JSON(status, Models.Fail{Error: err.Error()})
+			return
+		}
+
+		report.Added = append(report.Added, manga.ToJSON())
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	series, err := local.ListSeries()
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	// One broken folder should not keep the others out of the library
+	for _, id := range series {
+		skip := func(reason string) {
+			report.Skipped = append(report.Skipped, Models.SkippedMangaJSON{
+				Title:  id,
+				Source: local.GetProvider(),
+				Reason: reason,
+			})
+		}
+
+		exists, err := dbm.IsMangaInLibrary(local.GetProvider(), id)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+			return
+		}
+
+		if exists {
+			var manga Models.Manga
+			if err := dbm.GetMangaByProviderID(&manga, local.GetProvider(), id); err != nil {
+				c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+				return
+			}
+			report.Existing = append(report.Existing, manga.ToJSON())
+			continue
+		}
+
+		manga, err := local.FetchManga(id)
+		if err != nil {
+			skip(err.Error())
+			continue
+		}
+
+		if _, err := addToLibrary(dbm, queue, local, &manga, false); err != nil {
+			skip(err.Error())
+			continue
+		}
+		report.Added = append(report.Added, manga.ToJSON())
+	}
+
+	c.JSON(http.StatusOK, report)
+}
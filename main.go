@@ -3,14 +3,22 @@ package main
 import (
 	"flag"
 	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/Export"
+	"github.com/CookieUzen/mangascribe/Generic"
+	"github.com/CookieUzen/mangascribe/Local"
+	"github.com/CookieUzen/mangascribe/Mail"
 	"github.com/CookieUzen/mangascribe/Config"
 	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/MangaDex"
+	"github.com/CookieUzen/mangascribe/OIDC"
+	"github.com/CookieUzen/mangascribe/Queue"
 	"github.com/golang/glog"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	_ "github.com/CookieUzen/mangascribe/docs"
 	"net/http"
+	"strconv"
 )
 
 // TODO finetune -v levels
@@ -20,6 +28,10 @@ import (
 //	@description	This is a mangascribe API server.
 //	@version		1.0
 //	@host			localhost:8080
+//	@securityDefinitions.apikey	ApiKeyAuth
+//	@in							header
+//	@name						Authorization
+//	@description				"Bearer " followed by an API key
 func main() {
 	// For logging flags
 	flag.Parse()
@@ -27,8 +39,43 @@ func main() {
 	// Connect to the database
 	dbm := DB.Open()
 
+	// Start the background job queue
+	local := Local.API{Root: Config.IMPORT_PATH}
+	providers := Models.NewRegistry(MangaDex.API{}, local)
+	sites, err := Generic.LoadSites(Config.SITES_PATH)
+	if err != nil {
+		glog.Fatalf("Failed to load site definitions: %v", err)
+	}
+	for _, site := range sites {
+		providers.Register(site)
+	}
+	queue := Queue.New(&dbm, providers)
+	if Config.EXPORT_PATH != "" {
+		queue.Export = Export.New(Config.EXPORT_PATH, Config.EXPORT_PER_VOLUME)
+	}
+
+	// Command line tools run instead of the server
+	if flag.Arg(0) == "import-backup" {
+		if err := importBackupCommand(&dbm, queue, flag.Args()[1:]); err != nil {
+			glog.Fatalf("Failed to import backup: %v", err)
+		}
+		glog.Flush()
+		dbm.Close()
+		return
+	}
+
+	if err := queue.Start(); err != nil {
+		glog.Fatalf("Failed to start the job queue: %v", err)
+	}
+
+	mailer := Mail.Default()
+	sso := OIDC.Default()
+
 	// Set up gin server
 	r := gin.Default()
+	if err := r.SetTrustedProxies(Config.TRUSTED_PROXIES); err != nil {
+		glog.Fatalf("Invalid trusted proxies: %v", err)
+	}
 
 	v1 := r.Group("/v1") 
 	v1.GET("/meow", func(c *gin.Context) {
@@ -36,11 +83,90 @@ func main() {
 			"message": "Teapot",
 		})
 	})
-	v1.POST("/accounts", func(c *gin.Context) {registerHandler(c, &dbm)})
+	v1.POST("/accounts", func(c *gin.Context) {registerHandler(c, &dbm, mailer)})
+	v1.GET("/accounts/verify", func(c *gin.Context) {verifyEmailHandler(c, &dbm)})
+	v1.POST("/password/forgot", func(c *gin.Context) {forgotPasswordHandler(c, &dbm, mailer)})
+	v1.POST("/password/reset", func(c *gin.Context) {resetPasswordHandler(c, &dbm)})
 
 	v1.POST("/login", func(c *gin.Context) {loginHandler(c, &dbm)})
-	// TODO: figure out how to update account info
-	// TODO: revoke API keys and an API key endpoint
+	v1.GET("/oidc/login", func(c *gin.Context) {oidcLoginHandler(c, &dbm, sso)})
+	v1.GET("/oidc/callback", func(c *gin.Context) {oidcCallbackHandler(c, &dbm, sso)})
+
+	// Everything below requires an API key with the scope of the route
+	auth := v1.Group("/", authMiddleware(&dbm))
+	auth.GET("/accounts/me", requireScope(Models.ScopeAdmin), getAccountHandler)
+	auth.PATCH("/accounts/me", requireScope(Models.ScopeAdmin), func(c *gin.Context) {updateAccountHandler(c, &dbm, mailer)})
+	auth.DELETE("/accounts/me", requireScope(Models.ScopeAdmin), func(c *gin.Context) {deleteAccountHandler(c, &dbm)})
+	auth.GET("/accounts/me/logins", requireScope(Models.ScopeAdmin), func(c *gin.Context) {listLoginsHandler(c, &dbm)})
+	auth.POST("/accounts/me/verify", requireScope(Models.ScopeAdmin), func(c *gin.Context) {resendVerificationHandler(c, &dbm, mailer)})
+	auth.POST("/accounts/me/2fa", requireScope(Models.ScopeAdmin), func(c *gin.Context) {enrollTOTPHandler(c, &dbm)})
+	auth.POST("/accounts/me/2fa/verify", requireScope(Models.ScopeAdmin), func(c *gin.Context) {confirmTOTPHandler(c, &dbm)})
+	auth.DELETE("/accounts/me/2fa", requireScope(Models.ScopeAdmin), func(c *gin.Context) {disableTOTPHandler(c, &dbm)})
+	auth.POST("/accounts/me/2fa/recovery-codes", requireScope(Models.ScopeAdmin), func(c *gin.Context) {recoveryCodesHandler(c, &dbm)})
+	auth.GET("/keys", requireScope(Models.ScopeAdmin), func(c *gin.Context) {listKeysHandler(c, &dbm)})
+	auth.POST("/keys", requireScope(Models.ScopeAdmin), func(c *gin.Context) {createKeyHandler(c, &dbm)})
+	auth.DELETE("/keys", requireScope(Models.ScopeAdmin), func(c *gin.Context) {revokeKeysHandler(c, &dbm)})
+	auth.DELETE("/keys/:id", requireScope(Models.ScopeAdmin), func(c *gin.Context) {revokeKeyHandler(c, &dbm)})
+	auth.POST("/keys/:id/rotate", requireScope(Models.ScopeAdmin), func(c *gin.Context) {rotateKeyHandler(c, &dbm)})
+	auth.GET("/providers", requireScope(Models.ScopeLibraryRead), func(c *gin.Context) {listProvidersHandler(c, providers)})
+	auth.GET("/library", requireScope(Models.ScopeLibraryRead), func(c *gin.Context) {listLibraryHandler(c, &dbm)})
+	auth.POST("/library", requireScope(Models.ScopeDownloadsWrite), func(c *gin.Context) {addMangaHandler(c, &dbm, queue)})
+	auth.GET("/library/:id", requireScope(Models.ScopeLibraryRead), func(c *gin.Context) {getMangaHandler(c, &dbm)})
+	auth.POST("/library/:id/sync", requireScope(Models.ScopeDownloadsWrite), func(c *gin.Context) {syncMangaHandler(c, &dbm, queue)})
+	auth.POST("/library/import", requireScope(Models.ScopeLibraryWrite), func(c *gin.Context) {importLocalHandler(c, &dbm, queue, local)})
+	auth.POST("/library/import/backup", requireScope(Models.ScopeLibraryWrite), func(c *gin.Context) {importBackupHandler(c, queue)})
+	auth.POST("/library/:id/export", requireScope(Models.ScopeDownloadsWrite), func(c *gin.Context) {exportMangaHandler(c, &dbm, queue)})
+	auth.GET("/library/:id/cover", requireScope(Models.ScopeLibraryRead), func(c *gin.Context) {getCoverHandler(c, &dbm)})
+	auth.POST("/library/verify", requireScope(Models.ScopeDownloadsWrite), func(c *gin.Context) {verifyLibraryHandler(c, queue)})
+	auth.GET("/library/:id/progress", requireScope(Models.ScopeReader), func(c *gin.Context) {getMangaProgressHandler(c, &dbm)})
+	auth.PUT("/library/:id/follow", requireScope(Models.ScopeLibraryWrite), func(c *gin.Context) {followMangaHandler(c, &dbm)})
+	auth.DELETE("/library/:id/follow", requireScope(Models.ScopeLibraryWrite), func(c *gin.Context) {unfollowMangaHandler(c, &dbm)})
+	auth.GET("/chapters/:id/manifest", requireScope(Models.ScopeReader), func(c *gin.Context) {getManifestHandler(c, &dbm)})
+	auth.GET("/chapters/:id/pages/:n", requireScope(Models.ScopeReader), func(c *gin.Context) {getPageHandler(c, &dbm)})
+	auth.GET("/chapters/:id/cbz", requireScope(Models.ScopeReader), func(c *gin.Context) {getChapterCBZHandler(c, &dbm)})
+	auth.PUT("/chapters/:id/progress", requireScope(Models.ScopeReader), func(c *gin.Context) {setProgressHandler(c, &dbm, queue)})
+	auth.PUT("/volumes/:id/read", requireScope(Models.ScopeReader), func(c *gin.Context) {markVolumeReadHandler(c, &dbm, queue)})
+	auth.GET("/categories", requireScope(Models.ScopeLibraryRead), func(c *gin.Context) {listCategoriesHandler(c, &dbm)})
+	auth.GET("/continue", requireScope(Models.ScopeReader), func(c *gin.Context) {continueReadingHandler(c, &dbm)})
+	auth.POST("/series", requireScope(Models.ScopeLibraryWrite), func(c *gin.Context) {createSeriesHandler(c, &dbm)})
+	auth.GET("/series/duplicates", requireScope(Models.ScopeLibraryRead), func(c *gin.Context) {findDuplicatesHandler(c, &dbm)})
+	auth.GET("/series/:id", requireScope(Models.ScopeLibraryRead), func(c *gin.Context) {getSeriesHandler(c, &dbm)})
+	auth.DELETE("/series/:id", requireScope(Models.ScopeLibraryWrite), func(c *gin.Context) {deleteSeriesHandler(c, &dbm)})
+	auth.POST("/series/:id/manga", requireScope(Models.ScopeLibraryWrite), func(c *gin.Context) {addSeriesMangaHandler(c, &dbm)})
+	auth.DELETE("/series/:id/manga/:manga_id", requireScope(Models.ScopeLibraryWrite), func(c *gin.Context) {removeSeriesMangaHandler(c, &dbm)})
+	auth.PUT("/series/:id/sources", requireScope(Models.ScopeLibraryWrite), func(c *gin.Context) {selectSourceHandler(c, &dbm)})
+	auth.PUT("/mangadex", requireScope(Models.ScopeLibraryWrite), func(c *gin.Context) {linkMangaDexHandler(c, &dbm, queue)})
+	auth.GET("/mangadex", requireScope(Models.ScopeLibraryRead), func(c *gin.Context) {getMangaDexHandler(c, &dbm)})
+	auth.DELETE("/mangadex", requireScope(Models.ScopeLibraryWrite), func(c *gin.Context) {unlinkMangaDexHandler(c, &dbm)})
+	auth.POST("/mangadex/sync", requireScope(Models.ScopeLibraryWrite), func(c *gin.Context) {syncMangaDexHandler(c, &dbm, queue)})
+	auth.GET("/trackers", requireScope(Models.ScopeLibraryRead), func(c *gin.Context) {listTrackersHandler(c, &dbm, queue)})
+	auth.PUT("/trackers/:tracker", requireScope(Models.ScopeLibraryWrite), func(c *gin.Context) {linkTrackerHandler(c, &dbm, queue)})
+	auth.DELETE("/trackers/:tracker", requireScope(Models.ScopeLibraryWrite), func(c *gin.Context) {unlinkTrackerHandler(c, &dbm, queue)})
+	auth.GET("/library/:id/trackers", requireScope(Models.ScopeLibraryRead), func(c *gin.Context) {getMangaTrackersHandler(c, &dbm)})
+	auth.PUT("/library/:id/trackers/:tracker", requireScope(Models.ScopeLibraryWrite), func(c *gin.Context) {trackMangaHandler(c, &dbm, queue)})
+	auth.DELETE("/library/:id/trackers/:tracker", requireScope(Models.ScopeLibraryWrite), func(c *gin.Context) {untrackMangaHandler(c, &dbm, queue)})
+	auth.GET("/jobs/:id", requireScope(Models.ScopeLibraryRead), func(c *gin.Context) {getJobHandler(c, &dbm)})
+
+	// Administering the server needs an admin account, and a key with the admin scope
+	admin := auth.Group("/admin", requireScope(Models.ScopeAdmin), requireAdmin)
+	admin.GET("/users", func(c *gin.Context) {listUsersHandler(c, &dbm)})
+	admin.PATCH("/users/:id", func(c *gin.Context) {updateUserHandler(c, &dbm)})
+	admin.POST("/users/:id/password", func(c *gin.Context) {resetUserPasswordHandler(c, &dbm)})
+	admin.DELETE("/users/:id/keys", func(c *gin.Context) {revokeUserKeysHandler(c, &dbm)})
+	admin.GET("/status", func(c *gin.Context) {serverStatusHandler(c, &dbm)})
+	admin.GET("/settings", func(c *gin.Context) {getSettingsHandler(c, &dbm)})
+	admin.PATCH("/settings", func(c *gin.Context) {updateSettingsHandler(c, &dbm)})
+
+	// OPDS catalog, readers log in with HTTP Basic using an API key as the password
+	opds := r.Group("/opds", basicChallengeMiddleware, authMiddleware(&dbm), requireScope(Models.ScopeReader))
+	opds.GET("", opdsRootHandler)
+	opds.GET("/series", func(c *gin.Context) {opdsSeriesHandler(c, &dbm)})
+	opds.GET("/series/:id", func(c *gin.Context) {opdsMangaHandler(c, &dbm)})
+	opds.GET("/series/:id/cover", func(c *gin.Context) {opdsCoverHandler(c, &dbm)})
+	opds.GET("/volumes/:id", func(c *gin.Context) {opdsVolumeHandler(c, &dbm)})
+	opds.GET("/chapters/:id/pages/:n", func(c *gin.Context) {opdsPageHandler(c, &dbm)})
+	opds.GET("/search", func(c *gin.Context) {opdsSeriesHandler(c, &dbm)})
+	opds.GET("/search.xml", opdsSearchDescriptionHandler)
 
 	// This endpoint serves the Swagger UI and the OpenAPI spec
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
@@ -57,15 +183,16 @@ func main() {
 
 // registerHandler Register a new account
 // @Summary Register a new account
-// @Description register a new account by json user
+// @Description register a new account by json user, a verification email is sent to its address
+// @Description the first account becomes the admin of the server, after that admins can close registration
 // @Tags user
 // @Accept  json
 // @Produce  json
 // @Param accountInfo body Models.NewAccountRequest true "Account information for registration"
 // @Success 200 {object} Models.Response_APIKey
-// @Failure 400,502 {object} Models.Fail
+// @Failure 400,403,502 {object} Models.Fail
 // @Router /v1/accounts [post]
-func registerHandler(c *gin.Context, dbm *DB.DBManager) {
+func registerHandler(c *gin.Context, dbm *DB.DBManager, mailer Mail.Mailer) {
 	var form Models.NewAccountRequest
 
 	if err := c.ShouldBindJSON(&form); err != nil {
@@ -73,30 +200,61 @@ func registerHandler(c *gin.Context, dbm *DB.DBManager) {
 		return
 	}
 
+	if open, err := dbm.RegistrationOpen(); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	} else if !open {
+		c.JSON(http.StatusForbidden, Models.Fail{Error: "Registration is closed"})
+		return
+	}
+
 	account, err := dbm.CreateAccount(form)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
 		return
 	}
 
-	api_key, err := dbm.GenerateAPIKey(account, Config.DEFAULT_API_KEY_EXPIRATION)
+	api_key, err := dbm.GenerateAPIKey(account, "", Models.AllScopes, Config.DEFAULT_API_KEY_EXPIRATION)
 	if err != nil {
 		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
 		return
 	}
 
+	// The account works without a verified email, so a failed email does not fail the registration
+	sendVerification(dbm, mailer, account)
+
 	c.JSON(http.StatusOK, Models.Response_APIKey{APIKey: api_key.ToJSON()})
 }
 
-// loginHandler Login to a user account and return all API keys associated with the account
+// loginLocked Refuses with 429 and a Retry-After header while too many failed logins lock out an identifier or the client IP
+func loginLocked(c *gin.Context, dbm *DB.DBManager, identifier string) bool {
+	ip := c.ClientIP()
+	wait, err := dbm.LoginLockout(identifier, ip)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return true
+	}
+	if wait > 0 {
+		dbm.RecordLoginAttempt(identifier, ip, false, Models.LoginLocked)
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, Models.Fail{Error: "Too many failed logins, try again later"})
+		return true
+	}
+
+	return false
+}
+
+// loginHandler Login to a user account and return a new API key
 // @Summary Login a user
-// @Description login user by json user
+// @Description login user by json user, a new API key is created since stored keys can not be shown again
+// @Description accounts with two-factor authentication also need a TOTP or recovery code
+// @Description repeated failures lock out the account and IP for a while, with a Retry-After header
 // @Tags user
 // @Accept  json
 // @Produce  json
 // @Param user body Models.LoginRequest true "Login user credentials"
-// @Success 200 {object} Models.Response_APIKeyList
-// @Failure 502,400,401 {object} Models.Fail
+// @Success 200 {object} Models.Response_APIKey
+// @Failure 502,400,401,403,429 {object} Models.Fail
 // @Router /v1/login [post]
 func loginHandler(c *gin.Context, dbm *DB.DBManager) {
 	var form Models.LoginRequest
@@ -106,6 +264,11 @@ func loginHandler(c *gin.Context, dbm *DB.DBManager) {
 		return
 	}
 
+	ip := c.ClientIP()
+	if loginLocked(c, dbm, form.Identifier) {
+		return
+	}
+
 	var account Models.Account
 	success, err := dbm.AuthAccount(&account, form)
 	if err != nil {
@@ -113,60 +276,33 @@ func loginHandler(c *gin.Context, dbm *DB.DBManager) {
 		return
 	}
 
+	// The same answer for unknown accounts and wrong passwords
 	if !success {
+		dbm.RecordLoginAttempt(form.Identifier, ip, false, Models.LoginFailedPassword)
 		c.JSON(http.StatusUnauthorized, Models.Fail{Error: "Invalid username or password"})
 		return
 	}
 
-	api_keys, err := dbm.GetAPIKeys(&account)
-	if err != nil {
-		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+	// Only told to someone with the password, so it does not reveal the account
+	if account.Disabled {
+		dbm.RecordLoginAttempt(form.Identifier, ip, false, Models.LoginDisabled)
+		c.JSON(http.StatusForbidden, Models.Fail{Error: "Account is disabled"})
 		return
 	}
 
-	json_keys := make([]Models.APIKeyJSON, len(api_keys))
-
-	// Loop through the API keys converting them to JSON
-	for i, key := range api_keys {
-		json_keys[i] = key.ToJSON()
-	}
-
-
-	c.JSON(http.StatusOK, Models.Response_APIKeyList{APIKeys: json_keys})
-}
-
-
-// generateAPIKey Generate a new API key for an account
-// @Summary Generate a new API key for an account
-// @Description generate a new API key for an account
-// @Tags user
-// @Accept  json
-// @Produce  json
-// @Param accountInfo body Models.LoginRequest true "Login user credentials"
-// @Success 200 {object} Models.Response_APIKey
-// @Failure 502,400,401 {object} Models.Fail
-// @Router /v1/accounts [get]
-func generateAPIKey(c *gin.Context, dbm *DB.DBManager) {
-	var form Models.LoginRequest
-
-	if err := c.ShouldBindJSON(&form); err != nil {
-		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+	// Asking for the code is the first step of a two-factor login, only wrong codes count
+	if !secondFactor(c, dbm, &account, form.OTP) {
 		return
 	}
 
-	var account Models.Account
-	success, err := dbm.AuthAccount(&account, form)
-	if err != nil {
-		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
-		return
-	}
+	dbm.RecordLoginAttempt(form.Identifier, ip, true, "")
 
-	if !success {
-		c.JSON(http.StatusUnauthorized, Models.Fail{Error: "Invalid username or password"})
-		return
+	label := form.Label
+	if label == "" {
+		label = "login"
 	}
 
-	api_key, err := dbm.GenerateAPIKey(&account, Config.DEFAULT_API_KEY_EXPIRATION)
+	api_key, err := dbm.GenerateAPIKey(&account, label, Models.AllScopes, Config.DEFAULT_API_KEY_EXPIRATION)
 	if err != nil {
 		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
 		return
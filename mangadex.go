@@ -0,0 +1,115 @@
+package main
+
+import (
+	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/MangaDex"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/Queue"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// linkMangaDexHandler Link a MangaDex account
+// @Summary Link a MangaDex account
+// @Description log in to MangaDex with a personal API client and link the account, replacing any linked account, the password is not stored
+// @Tags mangadex
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param account body Models.LinkMangaDexRequest true "MangaDex credentials and personal client"
+// @Success 200 {object} Models.Response_MangaDexLink
+// @Failure 400,401,403,502 {object} Models.Fail
+// @Router /v1/mangadex [put]
+func linkMangaDexHandler(c *gin.Context, dbm *DB.DBManager, queue *Queue.Queue) {
+	var form Models.LinkMangaDexRequest
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	link := Models.MangaDexLink{
+		AccountID:       currentAccount(c).ID,
+		Username:        form.Username,
+		ClientID:        form.ClientID,
+		ClientSecret:    form.ClientSecret,
+		PushReadMarkers: form.PushReadMarkers,
+	}
+
+	if err := MangaDex.NewClient(queue.MangaDex, &link).Login(form.Password); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	if err := dbm.SaveMangaDexLink(&link); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Models.Response_MangaDexLink{Link: link.ToJSON()})
+}
+
+// getMangaDexHandler Get the linked MangaDex account
+// @Summary Get the linked MangaDex account
+// @Tags mangadex
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} Models.Response_MangaDexLink
+// @Failure 401,403,404 {object} Models.Fail
+// @Router /v1/mangadex [get]
+func getMangaDexHandler(c *gin.Context, dbm *DB.DBManager) {
+	var link Models.MangaDexLink
+	if err := dbm.GetMangaDexLink(&link, currentAccount(c).ID); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Models.Response_MangaDexLink{Link: link.ToJSON()})
+}
+
+// unlinkMangaDexHandler Unlink the MangaDex account
+// @Summary Unlink the MangaDex account
+// @Description forget the linked MangaDex account and its tokens, the imported manga and progress are kept
+// @Tags mangadex
+// @Security ApiKeyAuth
+// @Success 204
+// @Failure 401,403,404 {object} Models.Fail
+// @Router /v1/mangadex [delete]
+func unlinkMangaDexHandler(c *gin.Context, dbm *DB.DBManager) {
+	if err := dbm.DeleteMangaDexLink(currentAccount(c).ID); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// syncMangaDexHandler Queue an import of the linked MangaDex account
+// @Summary Sync the linked MangaDex account
+// @Description queue a job adding the followed manga to the library, importing reading statuses as categories and read markers as reading progress
+// @Description the report of the job is a Models.Response_LibraryImport
+// @Tags mangadex
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 202 {object} Models.Response_Job
+// @Failure 401,403,404,409,502 {object} Models.Fail
+// @Router /v1/mangadex/sync [post]
+func syncMangaDexHandler(c *gin.Context, dbm *DB.DBManager, queue *Queue.Queue) {
+	account := currentAccount(c)
+
+	var link Models.MangaDexLink
+	if err := dbm.GetMangaDexLink(&link, account.ID); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	job, err := queue.EnqueueMangaDexSync(account.ID)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	} else if job == nil {
+		c.JSON(http.StatusConflict, Models.Fail{Error: "A sync is already queued"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, Models.Response_Job{Job: job.ToJSON()})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// apiKeyFromRequest Extracts the API key from the Authorization header
+// Accepts "Bearer <key>", or HTTP Basic with the key as the password for clients
+// that only speak Basic (any username is accepted)
+func apiKeyFromRequest(c *gin.Context) string {
+	if _, password, ok := c.Request.BasicAuth(); ok {
+		return password
+	}
+
+	return strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+}
+
+// authMiddleware Authenticates a request by the API key in the Authorization header
+// The account is stored in the context under "account" and the key used under "api_key"
+func authMiddleware(dbm *DB.DBManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := apiKeyFromRequest(c)
+		if key == "" {
+			unauthorized(c, "Missing API key")
+			return
+		}
+
+		var account Models.Account
+		var apiKey Models.APIKey
+		if err := dbm.UserFromKey(&account, &apiKey, key); err != nil {
+			unauthorized(c, err.Error())
+			return
+		}
+
+		c.Set("account", &account)
+		c.Set("api_key", &apiKey)
+		c.Next()
+	}
+}
+
+// currentAccount Returns the account authenticated by authMiddleware
+func currentAccount(c *gin.Context) *Models.Account {
+	return c.MustGet("account").(*Models.Account)
+}
+
+// currentAPIKey Returns the API key the request was authenticated with
+func currentAPIKey(c *gin.Context) *Models.APIKey {
+	return c.MustGet("api_key").(*Models.APIKey)
+}
+
+// requireScope Rejects requests made with an API key that lacks the scope, or by an account whose role does not allow it
+// Must come after authMiddleware
+func requireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !currentAPIKey(c).HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, Models.Fail{Error: "API key is missing the " + scope + " scope"})
+			return
+		}
+
+		if !currentAccount(c).CanUse(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, Models.Fail{Error: "Accounts with the " + currentAccount(c).Role + " role can not use the " + scope + " scope"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// requireAdmin Rejects requests from accounts that are not admins
+// Must come after authMiddleware
+func requireAdmin(c *gin.Context) {
+	if !currentAccount(c).IsAdmin() {
+		c.AbortWithStatusJSON(http.StatusForbidden, Models.Fail{Error: "Only admins can do this"})
+		return
+	}
+
+	c.Next()
+}
+
+// unauthorized Rejects a request that failed authentication
+// Routes behind basicChallengeMiddleware also get a Basic challenge
+func unauthorized(c *gin.Context, message string) {
+	if c.GetBool("basic_challenge") {
+		c.Header("WWW-Authenticate", `Basic realm="mangascribe", charset="UTF-8"`)
+	}
+
+	c.AbortWithStatusJSON(http.StatusUnauthorized, Models.Fail{Error: message})
+}
+
+// basicChallengeMiddleware Asks clients to log in with HTTP Basic when authentication fails
+// OPDS readers only prompt for credentials when they get a challenge
+func basicChallengeMiddleware(c *gin.Context) {
+	c.Set("basic_challenge", true)
+	c.Next()
+}
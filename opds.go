@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/OPDS"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// writeFeed Writes an OPDS feed with the content type of its kind
+func writeFeed(c *gin.Context, kind string, feed any) {
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.Data(http.StatusOK, kind+";charset=utf-8", append([]byte(xml.Header), body...))
+}
+
+// mangaEntry Builds the navigation entry of a manga, linking to its volumes
+func mangaEntry(manga *Models.Manga) OPDS.Entry {
+	entry := OPDS.Entry{
+		ID:      fmt.Sprintf("urn:mangascribe:manga:%d", manga.MangaID),
+		Title:   manga.Name,
+		Updated: OPDS.Timestamp(manga.UpdatedAt),
+		Links: []OPDS.Link{
+			{Rel: OPDS.RelSubsection, Href: fmt.Sprintf("/opds/series/%d", manga.MangaID), Type: OPDS.NavigationType},
+			{Rel: OPDS.RelImage, Href: fmt.Sprintf("/opds/series/%d/cover", manga.MangaID), Type: "image/jpeg"},
+			{Rel: OPDS.RelThumbnail, Href: fmt.Sprintf("/opds/series/%d/cover?size=medium", manga.MangaID), Type: "image/jpeg"},
+		},
+	}
+
+	for _, author := range manga.Authors {
+		entry.Authors = append(entry.Authors, OPDS.Author{Name: author.Name})
+	}
+
+	if manga.Description != "" {
+		entry.Content = &OPDS.Content{Type: "text", Text: manga.Description}
+	}
+
+	return entry
+}
+
+// opdsRootHandler Serve the root of the OPDS catalog
+// @Summary OPDS catalog root
+// @Description navigation feed linking to the series and the search
+// @Tags opds
+// @Produce  xml
+// @Security ApiKeyAuth
+// @Success 200 {string} string
+// @Failure 401,403 {object} Models.Fail
+// @Router /opds [get]
+func opdsRootHandler(c *gin.Context) {
+	feed := OPDS.NewFeed("urn:mangascribe:root", "mangascribe", "/opds", OPDS.NavigationType)
+	feed.Entries = []OPDS.Entry{
+		{
+			ID:      "urn:mangascribe:series",
+			Title:   "All series",
+			Updated: feed.Updated,
+			Content: &OPDS.Content{Type: "text", Text: "Every series in the library"},
+			Links:   []OPDS.Link{{Rel: OPDS.RelSubsection, Href: "/opds/series", Type: OPDS.NavigationType}},
+		},
+	}
+
+	writeFeed(c, OPDS.NavigationType, feed)
+}
+
+// opdsSeriesHandler Serve a page of the series in the library
+// @Summary OPDS series
+// @Description navigation feed of the library, paginated with a cursor, q searches the library
+// @Tags opds
+// @Produce  xml
+// @Security ApiKeyAuth
+// @Param q query string false "Full text search"
+// @Param cursor query string false "Cursor of the next page"
+// @Success 200 {string} string
+// @Failure 400,401,403 {object} Models.Fail
+// @Router /opds/series [get]
+// @Router /opds/search [get]
+func opdsSeriesHandler(c *gin.Context, dbm *DB.DBManager) {
+	query := Models.LibraryQuery{
+		Search: c.Query("q"),
+		Cursor: c.Query("cursor"),
+	}
+
+	mangas, next, err := dbm.ListLibrary(query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	self := c.Request.URL.Path
+	params := url.Values{}
+	if query.Search != "" {
+		params.Set("q", query.Search)
+	}
+
+	title := "All series"
+	if query.Search != "" {
+		title = fmt.Sprintf("Search: %s", query.Search)
+	}
+
+	feed := OPDS.NewFeed("urn:mangascribe:series", title, self, OPDS.NavigationType)
+	if next != "" {
+		params.Set("cursor", next)
+		feed.Links = append(feed.Links, OPDS.Link{Rel: "next", Href: self + "?" + params.Encode(), Type: OPDS.NavigationType})
+	}
+
+	feed.Entries = []OPDS.Entry{}
+	for i := range mangas {
+		feed.Entries = append(feed.Entries, mangaEntry(&mangas[i]))
+	}
+
+	writeFeed(c, OPDS.NavigationType, feed)
+}
+
+// opdsMangaHandler Serve the volumes of a manga
+// @Summary OPDS series volumes
+// @Description navigation feed of the volumes of a manga
+// @Tags opds
+// @Produce  xml
+// @Security ApiKeyAuth
+// @Param id path int true "Manga ID"
+// @Success 200 {string} string
+// @Failure 400,401,403,404 {object} Models.Fail
+// @Router /opds/series/{id} [get]
+func opdsMangaHandler(c *gin.Context, dbm *DB.DBManager) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	var manga Models.Manga
+	if err := dbm.GetManga(&manga, id); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	self := fmt.Sprintf("/opds/series/%d", manga.MangaID)
+	feed := OPDS.NewFeed(fmt.Sprintf("urn:mangascribe:manga:%d", manga.MangaID), manga.Name, self, OPDS.NavigationType)
+	feed.Links = append(feed.Links, OPDS.Link{Rel: "up", Href: "/opds/series", Type: OPDS.NavigationType})
+
+	Models.SortVolumes(manga.Volumes)
+	feed.Entries = []OPDS.Entry{}
+	for _, volume := range manga.Volumes {
+		feed.Entries = append(feed.Entries, OPDS.Entry{
+			ID:      fmt.Sprintf("urn:mangascribe:volume:%d", volume.ID),
+			Title:   volume.Name,
+			Updated: OPDS.Timestamp(volume.UpdatedAt),
+			Content: &OPDS.Content{Type: "text", Text: fmt.Sprintf("%d chapters", len(volume.Chapters))},
+			Links: []OPDS.Link{
+				{Rel: OPDS.RelSubsection, Href: fmt.Sprintf("/opds/volumes/%d", volume.ID), Type: OPDS.AcquisitionType},
+				{Rel: OPDS.RelThumbnail, Href: fmt.Sprintf("/opds/series/%d/cover?size=medium&volume=%s", manga.MangaID, url.QueryEscape(volume.Name)), Type: "image/jpeg"},
+			},
+		})
+	}
+
+	writeFeed(c, OPDS.NavigationType, feed)
+}
+
+// opdsCoverHandler Serve a cover to an OPDS reader
+// @Summary OPDS cover
+// @Description serve the series cover, or a volume cover, at its original size or as a thumbnail, with the reader scope
+// @Tags opds
+// @Produce  image/jpeg,image/png
+// @Security ApiKeyAuth
+// @Param id path int true "Manga ID"
+// @Param size query string false "Thumbnail size (small, medium, large), original if empty"
+// @Param volume query string false "Volume number, the series cover if empty"
+// @Success 200 {file} file
+// @Success 304
+// @Failure 400,401,403,404 {object} Models.Fail
+// @Router /opds/series/{id}/cover [get]
+func opdsCoverHandler(c *gin.Context, dbm *DB.DBManager) {
+	getCoverHandler(c, dbm)
+}
+
+// downloadedPages Counts the pages of a chapter that can be streamed
+func downloadedPages(chapter *Models.Chapter) int {
+	count := 0
+	for i := range chapter.Pages {
+		if chapter.Pages[i].FileName != "" {
+			count++
+		}
+	}
+
+	return count
+}
+
+// opdsVolumeHandler Serve the chapters of a volume
+// @Summary OPDS volume chapters
+// @Description acquisition feed of the downloaded chapters of a volume, with CBZ downloads and page streaming
+// @Tags opds
+// @Produce  xml
+// @Security ApiKeyAuth
+// @Param id path int true "Volume ID"
+// @Success 200 {string} string
+// @Failure 400,401,403,404 {object} Models.Fail
+// @Router /opds/volumes/{id} [get]
+func opdsVolumeHandler(c *gin.Context, dbm *DB.DBManager) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	var volume Models.Volume
+	if err := dbm.GetVolume(&volume, id); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	self := fmt.Sprintf("/opds/volumes/%d", volume.ID)
+	feed := OPDS.NewFeed(fmt.Sprintf("urn:mangascribe:volume:%d", volume.ID), volume.Name, self, OPDS.AcquisitionType)
+	feed.Links = append(feed.Links, OPDS.Link{Rel: "up", Href: fmt.Sprintf("/opds/series/%d", volume.MangaID), Type: OPDS.NavigationType})
+
+	feed.Entries = []OPDS.Entry{}
+	for _, chapter := range volume.Chapters {
+		if chapter.State != Models.ChapterComplete {
+			continue
+		}
+
+		title := chapter.Chapter
+		if chapter.Title != "" {
+			title = fmt.Sprintf("%s: %s", chapter.Chapter, chapter.Title)
+		}
+
+		// Readers substitute pageNumber (0-based) and maxWidth in the stream link
+		stream := fmt.Sprintf("/opds/chapters/%d/pages/{pageNumber}?width={maxWidth}", chapter.ChapterID)
+		feed.Entries = append(feed.Entries, OPDS.Entry{
+			ID:      fmt.Sprintf("urn:mangascribe:chapter:%d", chapter.ChapterID),
+			Title:   title,
+			Updated: OPDS.Timestamp(chapter.UpdatedAt),
+			Links: []OPDS.Link{
+				{Rel: OPDS.RelAcquisition, Href: fmt.Sprintf("/v1/chapters/%d/cbz", chapter.ChapterID), Type: OPDS.CBZType},
+				{Rel: OPDS.RelStream, Href: stream, Type: "image/jpeg", PSECount: downloadedPages(&chapter)},
+			},
+		})
+	}
+
+	writeFeed(c, OPDS.AcquisitionType, feed)
+}
+
+// opdsPageHandler Stream a page to an OPDS reader
+// @Summary OPDS page streaming
+// @Description serve a page for the OPDS Page Streaming Extension, pages are numbered from 0
+// @Tags opds
+// @Produce  image/jpeg,image/png
+// @Security ApiKeyAuth
+// @Param id path int true "Chapter ID"
+// @Param n path int true "Page number, starting at 0"
+// @Param width query int false "Scale the page down to this width"
+// @Success 200 {file} file
+// @Success 304
+// @Failure 400,401,403,404,502 {object} Models.Fail
+// @Router /opds/chapters/{id}/pages/{n} [get]
+func opdsPageHandler(c *gin.Context, dbm *DB.DBManager) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	number, err := strconv.Atoi(c.Param("n"))
+	if err != nil || number < 0 {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: "Invalid page number"})
+		return
+	}
+
+	// Readers that don't know the width send the template back, serve the original then
+	width, err := strconv.Atoi(c.Query("width"))
+	if err != nil || width < 1 {
+		width = 0
+	}
+
+	servePage(c, dbm, id, number+1, width, func(next int) string {
+		url := fmt.Sprintf("/opds/chapters/%d/pages/%d", id, next-1)
+		if width > 0 {
+			url += fmt.Sprintf("?width=%d", width)
+		}
+		return url
+	})
+}
+
+// opdsSearchDescriptionHandler Serve the OpenSearch description of the catalog
+// @Summary OPDS search description
+// @Tags opds
+// @Produce  xml
+// @Security ApiKeyAuth
+// @Success 200 {string} string
+// @Failure 401,403 {object} Models.Fail
+// @Router /opds/search.xml [get]
+func opdsSearchDescriptionHandler(c *gin.Context) {
+	writeFeed(c, OPDS.OpenSearchType, OPDS.NewOpenSearchDescription())
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/Queue"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+	"net/http"
+)
+
+// getMangaProgressHandler Get the reading progress of the account on a manga
+// @Summary Get manga progress
+// @Description get the progress of the account on every chapter of a manga, in reading order
+// @Tags progress
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param id path int true "Manga ID"
+// @Success 200 {object} Models.Response_MangaProgress
+// @Failure 400,401,403,404,502 {object} Models.Fail
+// @Router /v1/library/{id}/progress [get]
+func getMangaProgressHandler(c *gin.Context, dbm *DB.DBManager) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+	account := currentAccount(c)
+
+	if exists, err := dbm.IsMangaIDInLibrary(id); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	} else if !exists {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: "Manga not found"})
+		return
+	}
+
+	chapters, err := dbm.GetReadingList(id)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	progress, err := dbm.GetMangaProgress(account.ID, id)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	// Chapters without progress are listed as unread
+	response := Models.Response_MangaProgress{
+		MangaID:  id,
+		Total:    len(chapters),
+		Chapters: make([]Models.ProgressJSON, len(chapters)),
+	}
+	for i, chapter := range chapters {
+		chapterProgress := progress[chapter.ChapterID]
+		chapterProgress.ChapterID = chapter.ChapterID
+		if chapterProgress.Read {
+			response.Read++
+		}
+		response.Chapters[i] = chapterProgress.ToJSON()
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// progressChanged Queues pushing new reading progress to the MangaDex account and trackers of an account
+// The progress is already saved, failing to queue a push is only logged
+func progressChanged(queue *Queue.Queue, accountID uint, mangaID uint) {
+	if err := queue.EnqueueReadMarkers(accountID, mangaID); err != nil {
+		glog.Warning("Failed to queue MangaDex read markers: ", err)
+	}
+
+	if err := queue.EnqueueTrackers(accountID, mangaID); err != nil {
+		glog.Warning("Failed to queue tracker updates: ", err)
+	}
+}
+
+// setProgressHandler Record the reading progress of the account on a chapter
+// @Summary Set chapter progress
+// @Description set the last page read and the read flag of a chapter. Pages are numbered from 1, 0 means the chapter was not started
+// @Tags progress
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param id path int true "Chapter ID"
+// @Param progress body Models.ProgressRequest true "Progress on the chapter"
+// @Success 200 {object} Models.Response_Progress
+// @Failure 400,401,403,404,502 {object} Models.Fail
+// @Router /v1/chapters/{id}/progress [put]
+func setProgressHandler(c *gin.Context, dbm *DB.DBManager, queue *Queue.Queue) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	var form Models.ProgressRequest
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	if exists, err := dbm.IsChapterIDInLibrary(id); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	} else if !exists {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: "Chapter not found"})
+		return
+	}
+
+	var chapter Models.Chapter
+	if err := dbm.GetChapter(&chapter, id); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	// Pages are numbered from 1, 0 is a chapter not started yet. Some providers do not give the page count
+	if form.LastPage < 0 || (chapter.PageNumber > 0 && form.LastPage > chapter.PageNumber) {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: fmt.Sprintf("Last page must be between 0 and %d", chapter.PageNumber)})
+		return
+	}
+
+	progress, err := dbm.SetProgress(currentAccount(c).ID, &chapter, form.LastPage, form.Read)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	progressChanged(queue, progress.AccountID, progress.MangaID)
+
+	c.JSON(http.StatusOK, Models.Response_Progress{Progress: progress.ToJSON()})
+}
+
+// markVolumeReadHandler Mark every chapter of a volume read or unread
+// @Summary Mark a volume read
+// @Description mark every chapter of a volume read or unread for the account
+// @Tags progress
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param id path int true "Volume ID"
+// @Param read body Models.MarkReadRequest true "Whether the volume is read"
+// @Success 200 {object} Models.Response_MarkRead
+// @Failure 400,401,403,404 {object} Models.Fail
+// @Router /v1/volumes/{id}/read [put]
+func markVolumeReadHandler(c *gin.Context, dbm *DB.DBManager, queue *Queue.Queue) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	var form Models.MarkReadRequest
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	updated, err := dbm.MarkVolumeRead(currentAccount(c).ID, id, form.Read)
+	if err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	var volume Models.Volume
+	if err := dbm.GetVolume(&volume, id); err == nil {
+		progressChanged(queue, currentAccount(c).ID, volume.MangaID)
+	}
+
+	c.JSON(http.StatusOK, Models.Response_MarkRead{Updated: updated})
+}
+
+// followMangaHandler Follow a manga
+// @Summary Follow a manga
+// @Description follow a manga so it shows up in continue reading
+// @Tags progress
+// @Security ApiKeyAuth
+// @Param id path int true "Manga ID"
+// @Success 204
+// @Failure 400,401,403,404,502 {object} Models.Fail
+// @Router /v1/library/{id}/follow [put]
+func followMangaHandler(c *gin.Context, dbm *DB.DBManager) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	if exists, err := dbm.IsMangaIDInLibrary(id); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	} else if !exists {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: "Manga not found"})
+		return
+	}
+
+	if err := dbm.FollowManga(currentAccount(c).ID, id); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// unfollowMangaHandler Stop following a manga
+// @Summary Unfollow a manga
+// @Description stop following a manga, its reading progress is kept
+// @Tags progress
+// @Security ApiKeyAuth
+// @Param id path int true "Manga ID"
+// @Success 204
+// @Failure 400,401,403,502 {object} Models.Fail
+// @Router /v1/library/{id}/follow [delete]
+func unfollowMangaHandler(c *gin.Context, dbm *DB.DBManager) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := dbm.UnfollowManga(currentAccount(c).ID, id); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// continueReadingHandler Get the next chapter to read in every followed manga
+// @Summary Continue reading
+// @Description get the next unread chapter of every manga the account follows
+// @Tags progress
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} Models.Response_ContinueReading
+// @Failure 401,403,502 {object} Models.Fail
+// @Router /v1/continue [get]
+func continueReadingHandler(c *gin.Context, dbm *DB.DBManager) {
+	entries, err := dbm.ContinueReading(currentAccount(c).ID)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	json_entries := make([]Models.ContinueReadingJSON, len(entries))
+	for i := range entries {
+		json_entries[i] = entries[i].ToJSON()
+	}
+
+	c.JSON(http.StatusOK, Models.Response_ContinueReading{Continue: json_entries})
+}
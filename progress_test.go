@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/Queue"
+	"github.com/gin-gonic/gin"
+)
+
+func TestSetProgressPages(t *testing.T) {
+	r, dbm, _, key := keysServer(t)
+	queue := Queue.New(dbm, Models.NewRegistry())
+	r.PUT("/v1/chapters/:id/progress", authMiddleware(dbm), requireScope(Models.ScopeReader), func(c *gin.Context) { setProgressHandler(c, dbm, queue) })
+
+	chapter := Models.Chapter{PageNumber: 20}
+	if err := dbm.DB.Create(&chapter).Error; err != nil {
+		t.Fatal(err)
+	}
+	path := fmt.Sprintf("/v1/chapters/%d/progress", chapter.ChapterID)
+
+	for _, lastPage := range []int{-1, 21} {
+		w := request(r, "PUT", path, key.Key, fmt.Sprintf(`{"last_page":%d}`, lastPage))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("got %d saving page %d of 20: %s", w.Code, lastPage, w.Body.String())
+		}
+	}
+
+	for _, lastPage := range []int{0, 20} {
+		w := request(r, "PUT", path, key.Key, fmt.Sprintf(`{"last_page":%d}`, lastPage))
+		if w.Code != http.StatusOK {
+			t.Errorf("got %d saving page %d of 20: %s", w.Code, lastPage, w.Body.String())
+		}
+	}
+
+	w := request(r, "PUT", fmt.Sprintf("/v1/chapters/%d/progress", chapter.ChapterID+1), key.Key, `{"last_page":1}`)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got %d saving progress on a missing chapter: %s", w.Code, w.Body.String())
+	}
+}
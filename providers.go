@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// listProvidersHandler List the providers manga can be added from
+// @Summary List providers
+// @Description list the registered providers by name with what they support
+// @Tags library
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} Models.Response_Providers
+// @Failure 401,403 {object} Models.Fail
+// @Router /v1/providers [get]
+func listProvidersHandler(c *gin.Context, providers *Models.Registry) {
+	list := []Models.ProviderJSON{}
+	for _, provider := range providers.List() {
+		capabilities := provider.Capabilities()
+		list = append(list, Models.ProviderJSON{
+			Name:      provider.GetProvider(),
+			Default:   provider.GetProvider() == providers.Default,
+			Search:    capabilities.Search,
+			Feed:      capabilities.Feed,
+			Datasaver: capabilities.Datasaver,
+			Languages: capabilities.Languages,
+		})
+	}
+
+	c.JSON(http.StatusOK, Models.Response_Providers{Providers: list})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/Queue"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// verifyLibraryHandler Queue a job re-hashing every downloaded page in the library
+// @Summary Verify the library
+// @Description re-hash every downloaded page, report missing or corrupted pages and queue re-downloads
+// @Tags library
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 202 {object} Models.Response_Job
+// @Failure 401,403,502 {object} Models.Fail
+// @Router /v1/library/verify [post]
+func verifyLibraryHandler(c *gin.Context, queue *Queue.Queue) {
+	job := Models.Job{Type: Models.VerifyJob, AccountID: currentAccount(c).ID}
+	if err := queue.Enqueue(&job); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, Models.Response_Job{Job: job.ToJSON()})
+}
+
+// getJobHandler Get the status of a job
+// @Summary Get a job
+// @Description get the status, report and error of a job queued by the account, admins can get any job
+// @Tags jobs
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param id path int true "Job ID"
+// @Success 200 {object} Models.Response_Job
+// @Failure 400,401,403,404 {object} Models.Fail
+// @Router /v1/jobs/{id} [get]
+func getJobHandler(c *gin.Context, dbm *DB.DBManager) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	var job Models.Job
+	if err := dbm.GetJob(&job, id); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	// Jobs can hold the reports and errors of linked accounts, so they are only shown to whoever queued them
+	account := currentAccount(c)
+	if job.AccountID != account.ID && !account.IsAdmin() {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: "Job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Models.Response_Job{Job: job.ToJSON()})
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/Tools"
+	"github.com/gin-gonic/gin"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// pageURL Returns the URL of a page, keeping the requested width
+func pageURL(chapterID uint, number int, width int) string {
+	url := fmt.Sprintf("/v1/chapters/%d/pages/%d", chapterID, number)
+	if width > 0 {
+		url += fmt.Sprintf("?width=%d", width)
+	}
+
+	return url
+}
+
+// findPage Returns the downloaded page of a chapter with the given page number, or nil
+func findPage(chapter *Models.Chapter, number int) *Models.Page {
+	for i := range chapter.Pages {
+		if chapter.Pages[i].Number() == number && chapter.Pages[i].FileName != "" {
+			return &chapter.Pages[i]
+		}
+	}
+
+	return nil
+}
+
+// getPageHandler Serve a downloaded page of a chapter
+// @Summary Get a page
+// @Description serve a downloaded page, supports range requests, conditional requests and resizing to a width
+// @Tags reader
+// @Produce  image/jpeg,image/png
+// @Security ApiKeyAuth
+// @Param id path int true "Chapter ID"
+// @Param n path int true "Page number, starting at 1"
+// @Param width query int false "Scale the page down to this width"
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Success 304
+// @Failure 400,401,403,404,502 {object} Models.Fail
+// @Router /v1/chapters/{id}/pages/{n} [get]
+func getPageHandler(c *gin.Context, dbm *DB.DBManager) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	number, err := strconv.Atoi(c.Param("n"))
+	if err != nil || number < 1 {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: "Invalid page number"})
+		return
+	}
+
+	width := 0
+	if value := c.Query("width"); value != "" {
+		width, err = strconv.Atoi(value)
+		if err != nil || width < 1 {
+			c.JSON(http.StatusBadRequest, Models.Fail{Error: "Invalid width"})
+			return
+		}
+	}
+
+	servePage(c, dbm, id, number, width, func(next int) string { return pageURL(id, next, width) })
+}
+
+// servePage Serves page number of a chapter, scaled down to width if it is set
+// nextURL builds the URLs of the following pages for the prefetch hints
+func servePage(c *gin.Context, dbm *DB.DBManager, id uint, number int, width int, nextURL func(int) string) {
+	var chapter Models.Chapter
+	if err := dbm.GetChapter(&chapter, id); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	page := findPage(&chapter, number)
+	if page == nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: "Page has not been downloaded"})
+		return
+	}
+
+	file, err := os.Open(filepath.Join(chapter.DownloadPath, page.FileName))
+	if err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: "Page file is missing"})
+		return
+	}
+	defer file.Close()
+
+	// The stored hash identifies the content, so it doubles as the ETag
+	etag := `"` + page.Hash + `"`
+	if width > 0 {
+		etag = fmt.Sprintf(`"%s-w%d"`, page.Hash, width)
+	}
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(Config.PAGE_CACHE_MAX_AGE.Seconds())))
+
+	// Hint the next pages so readers can fetch them ahead of time
+	var links []string
+	for next := number + 1; next <= number+Config.PREFETCH_PAGES; next++ {
+		if findPage(&chapter, next) != nil {
+			links = append(links, fmt.Sprintf("<%s>; rel=prefetch", nextURL(next)))
+		}
+	}
+	if len(links) > 0 {
+		c.Header("Link", strings.Join(links, ", "))
+	}
+
+	if width == 0 {
+		http.ServeContent(c.Writer, c.Request, page.FileName, page.DownloadedAt, file)
+		return
+	}
+
+	// Skip the resize if the client already has this version
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: "Failed to decode page"})
+		return
+	}
+
+	var resized bytes.Buffer
+	if err := jpeg.Encode(&resized, Tools.ResizeImage(img, width), &jpeg.Options{Quality: 85}); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: "Failed to resize page"})
+		return
+	}
+
+	name := strings.TrimSuffix(page.FileName, filepath.Ext(page.FileName)) + ".jpg"
+	http.ServeContent(c.Writer, c.Request, name, page.DownloadedAt, bytes.NewReader(resized.Bytes()))
+}
+
+// getManifestHandler List the downloaded pages of a chapter
+// @Summary Get a chapter manifest
+// @Description list the URL, dimensions, size and hash of every downloaded page of a chapter
+// @Tags reader
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param id path int true "Chapter ID"
+// @Param width query int false "Width to put in the page URLs"
+// @Success 200 {object} Models.Response_Manifest
+// @Failure 400,401,403,404 {object} Models.Fail
+// @Router /v1/chapters/{id}/manifest [get]
+func getManifestHandler(c *gin.Context, dbm *DB.DBManager) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	width, _ := strconv.Atoi(c.Query("width"))
+
+	var chapter Models.Chapter
+	if err := dbm.GetChapter(&chapter, id); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	pages := []Models.PageJSON{}
+	for i := range chapter.Pages {
+		page := &chapter.Pages[i]
+		if page.FileName == "" {
+			continue
+		}
+
+		// Pages downloaded before dimensions were recorded are measured now
+		if page.Width == 0 || page.Height == 0 {
+			page.Width, page.Height = Tools.ImageSize(filepath.Join(chapter.DownloadPath, page.FileName))
+		}
+
+		pages = append(pages, page.ToJSON(pageURL(chapter.ChapterID, page.Number(), width)))
+	}
+
+	c.JSON(http.StatusOK, Models.Response_Manifest{Chapter: chapter.ToJSON(), Pages: pages})
+}
+
+// getChapterCBZHandler Download a chapter as a CBZ archive
+// @Summary Download a chapter as CBZ
+// @Description export the downloaded pages of a chapter with a ComicInfo.xml as a CBZ archive
+// @Tags reader
+// @Produce  application/vnd.comicbook+zip
+// @Security ApiKeyAuth
+// @Param id path int true "Chapter ID"
+// @Success 200 {file} file
+// @Failure 400,401,403,404,502 {object} Models.Fail
+// @Router /v1/chapters/{id}/cbz [get]
+func getChapterCBZHandler(c *gin.Context, dbm *DB.DBManager) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	var chapter Models.Chapter
+	if err := dbm.GetChapter(&chapter, id); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	if chapter.State != Models.ChapterComplete {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: "Chapter has not been downloaded"})
+		return
+	}
+
+	var manga Models.Manga
+	if err := dbm.GetMangaMetadata(&manga, chapter.MangaID); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	name := Tools.SanitizeFilename(fmt.Sprintf("%s - %s - %s.cbz", manga.Name, chapter.Volume, chapter.Chapter))
+	c.Header("Content-Type", "application/vnd.comicbook+zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+
+	// The archive is streamed, so errors past this point can only be logged
+	info := Models.NewComicInfo(&manga, chapter.Volume, &chapter)
+	Models.WriteCBZ(c.Writer, []Models.Chapter{chapter}, info)
+}
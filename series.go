@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// createSeriesHandler Link manga from different providers as one series
+// @Summary Link manga as a series
+// @Description group manga from different providers as one series, manga already in another series are moved over
+// @Tags series
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param series body Models.CreateSeriesRequest true "Manga to link"
+// @Success 201 {object} Models.Response_Series
+// @Failure 400,401,403,404,502 {object} Models.Fail
+// @Router /v1/series [post]
+func createSeriesHandler(c *gin.Context, dbm *DB.DBManager) {
+	var form Models.CreateSeriesRequest
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	for _, id := range form.MangaIDs {
+		if exists, err := dbm.IsMangaIDInLibrary(id); err != nil {
+			c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+			return
+		} else if !exists {
+			c.JSON(http.StatusNotFound, Models.Fail{Error: fmt.Sprintf("Manga %d not found", id)})
+			return
+		}
+	}
+
+	var series Models.Series
+	if err := dbm.CreateSeries(&series, form.Name, form.MangaIDs); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	if err := dbm.GetSeries(&series, series.ID); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, Models.Response_Series{Series: series.ToJSON()})
+}
+
+// getSeriesHandler Get a series with its merged chapter list
+// @Summary Get a series
+// @Description get the manga of a series and their chapters merged by chapter number, with the source picked for each
+// @Tags series
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param id path int true "Series ID"
+// @Success 200 {object} Models.Response_Series
+// @Failure 400,401,403,404 {object} Models.Fail
+// @Router /v1/series/{id} [get]
+func getSeriesHandler(c *gin.Context, dbm *DB.DBManager) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	var series Models.Series
+	if err := dbm.GetSeries(&series, id); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Models.Response_Series{Series: series.ToJSON()})
+}
+
+// deleteSeriesHandler Unlink the manga of a series
+// @Summary Delete a series
+// @Description unlink every manga of a series, the manga stay in the library
+// @Tags series
+// @Security ApiKeyAuth
+// @Param id path int true "Series ID"
+// @Success 204
+// @Failure 400,401,403,404 {object} Models.Fail
+// @Router /v1/series/{id} [delete]
+func deleteSeriesHandler(c *gin.Context, dbm *DB.DBManager) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := dbm.DeleteSeries(id); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// addSeriesMangaHandler Link another manga to a series
+// @Summary Add a manga to a series
+// @Tags series
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param id path int true "Series ID"
+// @Param manga body Models.LinkMangaRequest true "Manga to link"
+// @Success 200 {object} Models.Response_Series
+// @Failure 400,401,403,404 {object} Models.Fail
+// @Router /v1/series/{id}/manga [post]
+func addSeriesMangaHandler(c *gin.Context, dbm *DB.DBManager) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	var form Models.LinkMangaRequest
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	if err := dbm.AddMangaToSeries(id, form.MangaID); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	var series Models.Series
+	if err := dbm.GetSeries(&series, id); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Models.Response_Series{Series: series.ToJSON()})
+}
+
+// removeSeriesMangaHandler Unlink a manga from a series
+// @Summary Remove a manga from a series
+// @Description unlink a manga, a series left with a single manga is deleted
+// @Tags series
+// @Security ApiKeyAuth
+// @Param id path int true "Series ID"
+// @Param manga_id path int true "Manga ID"
+// @Success 204
+// @Failure 400,401,403,404 {object} Models.Fail
+// @Router /v1/series/{id}/manga/{manga_id} [delete]
+func removeSeriesMangaHandler(c *gin.Context, dbm *DB.DBManager) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	mangaID, ok := parseID(c, "manga_id")
+	if !ok {
+		return
+	}
+
+	if err := dbm.RemoveMangaFromSeries(id, mangaID); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// selectSourceHandler Pick the provider a chapter of a series is read from
+// @Summary Select a chapter source
+// @Description read a chapter number of a series from the given chapter, replacing the previous pick for that number
+// @Tags series
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param id path int true "Series ID"
+// @Param source body Models.SelectSourceRequest true "Chapter to read"
+// @Success 200 {object} Models.Response_Series
+// @Failure 400,401,403,404 {object} Models.Fail
+// @Router /v1/series/{id}/sources [put]
+func selectSourceHandler(c *gin.Context, dbm *DB.DBManager) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	var form Models.SelectSourceRequest
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	var series Models.Series
+	if err := dbm.GetSeries(&series, id); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	if err := dbm.SelectChapterSource(&series, form.ChapterID); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Models.Response_Series{Series: series.ToJSON()})
+}
+
+// findDuplicatesHandler List manga that look like the same series
+// @Summary Find duplicate manga
+// @Description group manga not linked yet that share a normalized title or alternative title, or an id on another site
+// @Tags series
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} Models.Response_Duplicates
+// @Failure 401,403,502 {object} Models.Fail
+// @Router /v1/series/duplicates [get]
+func findDuplicatesHandler(c *gin.Context, dbm *DB.DBManager) {
+	groups, err := dbm.FindDuplicates()
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	duplicates := make([]Models.DuplicateJSON, len(groups))
+	for i := range groups {
+		duplicates[i] = groups[i].ToJSON()
+	}
+
+	c.JSON(http.StatusOK, Models.Response_Duplicates{Duplicates: duplicates})
+}
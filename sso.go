@@ -0,0 +1,216 @@
+package main
+
+import (
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/OIDC"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ssoAccount Finds the account of someone who logged in at the identity provider, linking or creating it if needed
+// Responds with an error and returns nil if there is no account they can use
+func ssoAccount(c *gin.Context, dbm *DB.DBManager, identity Models.Identity) *Models.Account {
+	var account Models.Account
+	if err := dbm.GetAccountBySSO(&account, identity.Subject); err == nil {
+		return &account
+	}
+
+	// An existing account with the same email is linked if that is turned on, and the provider vouches for the address
+	if err := dbm.GetAccountByEmail(&account, identity.Email); err == nil {
+		if account.SSOSubject != nil {
+			c.JSON(http.StatusConflict, Models.Fail{Error: "The account with this email is linked to another identity"})
+			return nil
+		}
+		if !identity.LinkByEmail {
+			c.JSON(http.StatusConflict, Models.Fail{Error: "An account already uses this email, log in to it with its password"})
+			return nil
+		}
+		if !identity.EmailVerified {
+			c.JSON(http.StatusConflict, Models.Fail{Error: "An account already uses this email, and the identity provider has not verified it"})
+			return nil
+		}
+
+		if err := dbm.LinkSSO(&account, identity.Subject); err != nil {
+			c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+			return nil
+		}
+
+		return &account
+	}
+
+	if !Config.OIDC_AUTO_PROVISION {
+		c.JSON(http.StatusForbidden, Models.Fail{Error: "No account is linked to this identity"})
+		return nil
+	}
+
+	// Creating an account is registering, so it is only done while registration is open
+	if open, err := dbm.RegistrationOpen(); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return nil
+	} else if !open {
+		c.JSON(http.StatusForbidden, Models.Fail{Error: "Registration is closed, no account is linked to this identity"})
+		return nil
+	}
+
+	created, err := dbm.CreateSSOAccount(identity)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return nil
+	}
+
+	return created
+}
+
+// oidcLoginHandler Start a single sign-on login
+// @Summary Log in with single sign-on
+// @Description redirect to the OpenID Connect identity provider to log in, it redirects back to /v1/oidc/callback
+// @Tags user
+// @Param label query string false "Label of the API key created for the login"
+// @Success 302
+// @Failure 400,404,502 {object} Models.Fail
+// @Router /v1/oidc/login [get]
+func oidcLoginHandler(c *gin.Context, dbm *DB.DBManager, provider *OIDC.Provider) {
+	if provider == nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: "Single sign-on is not configured"})
+		return
+	}
+
+	label := c.DefaultQuery("label", "sso")
+	if len(label) > 100 {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: "Label is too long (maximum 100 characters)"})
+		return
+	}
+
+	// The state ties the callback to this login, the nonce ties the ID token to it
+	values := make([]string, 3)
+	for i := range values {
+		value, err := OIDC.RandomString()
+		if err != nil {
+			c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+			return
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	authURL, err := provider.AuthURL(state, nonce, verifier)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	login := Models.OIDCLogin{
+		State:     Models.HashAPIKey(state),
+		Nonce:     nonce,
+		Verifier:  verifier,
+		Label:     label,
+		ExpiresAt: time.Now().Add(Config.OIDC_LOGIN_EXPIRATION),
+	}
+	if err := dbm.CreateOIDCLogin(&login); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// oidcCallbackHandler Finish a single sign-on login and return a new API key
+// @Summary Single sign-on callback
+// @Description the identity provider redirects here after logging in. The account is found by its identity, or by a verified email if OIDC_LINK_BY_EMAIL is on
+// @Description if there is none it is created while registration is open, with the role given by the groups of the user. When groups are mapped to roles, the role is updated on every login
+// @Description the identity provider handles two-factor authentication, so none is asked for here
+// @Tags user
+// @Produce  json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State of the login"
+// @Success 200 {object} Models.Response_APIKey
+// @Failure 400,401,403,404,409,502 {object} Models.Fail
+// @Router /v1/oidc/callback [get]
+func oidcCallbackHandler(c *gin.Context, dbm *DB.DBManager, provider *OIDC.Provider) {
+	if provider == nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: "Single sign-on is not configured"})
+		return
+	}
+
+	if reason := c.Query("error"); reason != "" {
+		if description := c.Query("error_description"); description != "" {
+			reason += ": " + description
+		}
+		c.JSON(http.StatusUnauthorized, Models.Fail{Error: "Identity provider refused the login: " + reason})
+		return
+	}
+
+	var login Models.OIDCLogin
+	if err := dbm.UseOIDCLogin(&login, c.Query("state")); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	claims, err := provider.Exchange(c.Query("code"), login.Verifier, login.Nonce)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	if claims.Email == "" {
+		c.JSON(http.StatusForbidden, Models.Fail{Error: "Identity provider did not share an email address"})
+		return
+	}
+
+	username := claims.PreferredUsername
+	if username == "" {
+		username = strings.Split(claims.Email, "@")[0]
+	}
+
+	identity := Models.Identity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Username:      username,
+		Role:          provider.Role(claims.Groups),
+		SyncRole:      provider.MapsGroups(),
+		LinkByEmail:   provider.LinkByEmail,
+	}
+
+	account := ssoAccount(c, dbm, identity)
+	if account == nil {
+		return
+	}
+
+	if identity.SyncRole && account.Role != identity.Role {
+		// Like through the admin endpoints, the last admin is kept, so the first account stays an admin
+		admins, err := dbm.CountAdmins()
+		if err != nil {
+			c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+			return
+		}
+
+		if !account.IsAdmin() || admins > 1 {
+			if err := dbm.SetAccountRole(account, identity.Role, account.Disabled); err != nil {
+				c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+				return
+			}
+		}
+	}
+
+	ip := c.ClientIP()
+	if account.Disabled {
+		dbm.RecordLoginAttempt(account.Username, ip, false, Models.LoginDisabled)
+		c.JSON(http.StatusForbidden, Models.Fail{Error: "Account is disabled"})
+		return
+	}
+
+	dbm.RecordLoginAttempt(account.Username, ip, true, "")
+
+	key, err := dbm.GenerateSSOAPIKey(account, login.Label, Config.DEFAULT_API_KEY_EXPIRATION)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Models.Response_APIKey{APIKey: key.ToJSON()})
+}
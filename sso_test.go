@@ -0,0 +1,179 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/OIDC"
+	"github.com/gin-gonic/gin"
+)
+
+func TestSSOAccountLinkByEmail(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(dir)
+
+	dbm := DB.Open()
+	existing, err := dbm.CreateAccount(Models.NewAccountRequest{Username: "alice", Password: "password1", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sso := func(identity Models.Identity) (*Models.Account, int) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		account := ssoAccount(c, &dbm, identity)
+		return account, w.Code
+	}
+	identity := Models.Identity{Subject: "alice-id", Email: "alice@example.com", EmailVerified: true, Username: "alice", Role: Models.RoleUser}
+
+	if account, status := sso(identity); account != nil || status != http.StatusConflict {
+		t.Fatalf("linked by email while it is off: %v %d", account, status)
+	}
+
+	identity.LinkByEmail = true
+	identity.EmailVerified = false
+	if account, status := sso(identity); account != nil || status != http.StatusConflict {
+		t.Fatalf("linked an unverified email: %v %d", account, status)
+	}
+
+	identity.EmailVerified = true
+	account, _ := sso(identity)
+	if account == nil || account.ID != existing.ID {
+		t.Fatalf("got account %v, want the one with the email linked", account)
+	}
+
+	// Later logins find the account by its identity, whatever the email
+	identity.LinkByEmail = false
+	identity.Email = "alice@elsewhere.example.com"
+	if account, _ := sso(identity); account == nil || account.ID != existing.ID {
+		t.Fatalf("got account %v, want the linked one", account)
+	}
+
+	bob := Models.Identity{Subject: "bob-id", Email: "bob@example.com", Username: "bob", Role: Models.RoleUser}
+	if account, _ := sso(bob); account == nil || account.ID == existing.ID || account.Email != bob.Email {
+		t.Fatalf("got account %v, want a new one", account)
+	}
+}
+
+func TestSSOAccountConfirmsWithoutPassword(t *testing.T) {
+	r, dbm, _, _ := keysServer(t)
+	r.DELETE("/v1/accounts/me", authMiddleware(dbm), requireScope(Models.ScopeAdmin), func(c *gin.Context) { deleteAccountHandler(c, dbm) })
+
+	create := func(name string) *Models.Account {
+		account, err := dbm.CreateSSOAccount(Models.Identity{Subject: name + "-id", Email: name + "@example.com", Username: name, Role: Models.RoleUser})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return account
+	}
+
+	bob := create("bob")
+	old, err := dbm.GenerateAPIKey(bob, "old", Models.AllScopes, Config.DEFAULT_API_KEY_EXPIRATION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := request(r, "DELETE", "/v1/accounts/me", old.Key, `{}`); w.Code != http.StatusForbidden {
+		t.Fatalf("got %d deleting with a key not from a login: %s", w.Code, w.Body.String())
+	}
+
+	login, err := dbm.GenerateSSOAPIKey(bob, "sso", Config.DEFAULT_API_KEY_EXPIRATION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := request(r, "DELETE", "/v1/accounts/me", login.Key, `{}`); w.Code != http.StatusNoContent {
+		t.Fatalf("got %d deleting with a key from a login: %s", w.Code, w.Body.String())
+	}
+
+	// With two-factor authentication the code stands in for the password, whatever the key
+	carol := create("carol")
+	if err := dbm.SetTOTPSecret(carol, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"); err != nil {
+		t.Fatal(err)
+	}
+	codes, err := dbm.EnableTOTP(carol, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := dbm.GenerateAPIKey(carol, "old", Models.AllScopes, Config.DEFAULT_API_KEY_EXPIRATION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := request(r, "DELETE", "/v1/accounts/me", key.Key, `{}`); w.Code != http.StatusUnauthorized {
+		t.Fatalf("got %d deleting without a two-factor code: %s", w.Code, w.Body.String())
+	}
+	if w := request(r, "DELETE", "/v1/accounts/me", key.Key, `{"otp":"`+codes[0]+`"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("got %d deleting with a recovery code: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSSOProvisioningFollowsRegistration(t *testing.T) {
+	r, dbm, _, _ := keysServer(t)
+
+	idp := OIDC.NewFake()
+	defer idp.Server.Close()
+	provider := idp.Provider()
+	r.GET("/v1/oidc/login", func(c *gin.Context) { oidcLoginHandler(c, dbm, provider) })
+	r.GET("/v1/oidc/callback", func(c *gin.Context) { oidcCallbackHandler(c, dbm, provider) })
+
+	// Logs in at the identity provider, returning the response of the callback
+	login := func(name string) *httptest.ResponseRecorder {
+		idp.Claims = map[string]any{"sub": name + "-id", "email": name + "@example.com", "email_verified": true, "preferred_username": name}
+
+		w := request(r, "GET", "/v1/oidc/login", "", "")
+		if w.Code != http.StatusFound {
+			t.Fatalf("got %d starting a login: %s", w.Code, w.Body.String())
+		}
+		authURL := w.Header().Get("Location")
+		code, err := idp.Authorize(authURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, _ := url.Parse(authURL)
+
+		return request(r, "GET", "/v1/oidc/callback?"+url.Values{"code": {code}, "state": {u.Query().Get("state")}}.Encode(), "", "")
+	}
+
+	setRegistration := func(open bool) {
+		var settings Models.Settings
+		if err := dbm.GetSettings(&settings); err != nil {
+			t.Fatal(err)
+		}
+		settings.OpenRegistration = open
+		if err := dbm.SaveSettings(&settings); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	setRegistration(false)
+	if w := login("bob"); w.Code != http.StatusForbidden {
+		t.Fatalf("got %d creating an account while registration is closed: %s", w.Code, w.Body.String())
+	}
+	if taken, _ := dbm.IsEmailTaken("bob@example.com"); taken {
+		t.Fatal("created an account while registration is closed")
+	}
+
+	setRegistration(true)
+	if w := login("bob"); w.Code != http.StatusOK {
+		t.Fatalf("got %d creating an account while registration is open: %s", w.Code, w.Body.String())
+	}
+	if taken, _ := dbm.IsEmailTaken("bob@example.com"); !taken {
+		t.Fatal("did not create an account while registration is open")
+	}
+
+	// Closing registration does not lock out accounts that already exist
+	setRegistration(false)
+	if w := login("bob"); w.Code != http.StatusOK {
+		t.Fatalf("got %d logging in to an existing account: %s", w.Code, w.Body.String())
+	}
+}
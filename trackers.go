@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/Queue"
+	"github.com/CookieUzen/mangascribe/Trackers"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+// getTracker Gets the tracker named in the path, responding with 404 if there is none
+func getTracker(c *gin.Context, queue *Queue.Queue) (Trackers.Tracker, bool) {
+	tracker, exists := queue.Trackers[c.Param("tracker")]
+	if !exists {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: fmt.Sprintf("Unknown tracker: %s", c.Param("tracker"))})
+		return nil, false
+	}
+
+	return tracker, true
+}
+
+// matchTracker Finds the id of a manga on a tracker from its links
+// Falls back on the links of the other manga of its series
+func matchTracker(dbm *DB.DBManager, tracker Trackers.Tracker, manga *Models.Manga) (string, bool) {
+	if id, ok := Trackers.Match(tracker, manga); ok {
+		return id, true
+	}
+
+	if manga.SeriesID == nil {
+		return "", false
+	}
+
+	var series Models.Series
+	if err := dbm.GetSeries(&series, *manga.SeriesID); err != nil {
+		return "", false
+	}
+
+	for i := range series.Manga {
+		if id, ok := Trackers.Match(tracker, &series.Manga[i]); ok {
+			return id, true
+		}
+	}
+
+	return "", false
+}
+
+// listTrackersHandler List the trackers and the ones the account is logged in to
+// @Summary List trackers
+// @Tags trackers
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} Models.Response_Trackers
+// @Failure 401,403,502 {object} Models.Fail
+// @Router /v1/trackers [get]
+func listTrackersHandler(c *gin.Context, dbm *DB.DBManager, queue *Queue.Queue) {
+	accounts, err := dbm.GetTrackerAccounts(currentAccount(c).ID)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	linked := make([]Models.TrackerAccountJSON, len(accounts))
+	for i := range accounts {
+		linked[i] = accounts[i].ToJSON()
+	}
+
+	c.JSON(http.StatusOK, Models.Response_Trackers{Available: queue.Trackers.Names(), Linked: linked})
+}
+
+// linkTrackerHandler Log in to a tracker
+// @Summary Link a tracker
+// @Description store the OAuth tokens of the account on a tracker, replacing any previous login
+// @Tags trackers
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param tracker path string true "Tracker name" Enums(anilist, myanimelist)
+// @Param tokens body Models.LinkTrackerRequest true "OAuth tokens"
+// @Success 200 {object} Models.Response_TrackerAccount
+// @Failure 400,401,403,404,502 {object} Models.Fail
+// @Router /v1/trackers/{tracker} [put]
+func linkTrackerHandler(c *gin.Context, dbm *DB.DBManager, queue *Queue.Queue) {
+	tracker, ok := getTracker(c, queue)
+	if !ok {
+		return
+	}
+
+	var form Models.LinkTrackerRequest
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	account := Models.TrackerAccount{
+		AccountID:    currentAccount(c).ID,
+		Tracker:      tracker.Name(),
+		AccessToken:  form.AccessToken,
+		RefreshToken: form.RefreshToken,
+		ClientID:     form.ClientID,
+	}
+	if form.ExpiresIn > 0 {
+		account.ExpiresAt = time.Now().Add(time.Duration(form.ExpiresIn) * time.Second)
+	}
+
+	if err := dbm.SaveTrackerAccount(&account); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Models.Response_TrackerAccount{Tracker: account.ToJSON()})
+}
+
+// unlinkTrackerHandler Log out of a tracker
+// @Summary Unlink a tracker
+// @Description forget the tokens of the account on a tracker and the manga linked to it
+// @Tags trackers
+// @Security ApiKeyAuth
+// @Param tracker path string true "Tracker name" Enums(anilist, myanimelist)
+// @Success 204
+// @Failure 401,403,404 {object} Models.Fail
+// @Router /v1/trackers/{tracker} [delete]
+func unlinkTrackerHandler(c *gin.Context, dbm *DB.DBManager, queue *Queue.Queue) {
+	tracker, ok := getTracker(c, queue)
+	if !ok {
+		return
+	}
+
+	if err := dbm.DeleteTrackerAccount(currentAccount(c).ID, tracker.Name()); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// getMangaTrackersHandler Get the tracker entries of a manga
+// @Summary Get manga tracker entries
+// @Tags trackers
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param id path int true "Manga ID"
+// @Success 200 {object} Models.Response_TrackerEntries
+// @Failure 400,401,403,502 {object} Models.Fail
+// @Router /v1/library/{id}/trackers [get]
+func getMangaTrackersHandler(c *gin.Context, dbm *DB.DBManager) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	entries, err := dbm.GetTrackerEntries(currentAccount(c).ID, id)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	json_entries := make([]Models.TrackerEntryJSON, len(entries))
+	for i := range entries {
+		json_entries[i] = entries[i].ToJSON()
+	}
+
+	c.JSON(http.StatusOK, Models.Response_TrackerEntries{Entries: json_entries})
+}
+
+// trackMangaHandler Link a manga to its entry on a tracker
+// @Summary Track a manga
+// @Description link a manga to a tracker entry, matched from the links of the manga (or its series) when no id is given, set its status and score and push the reading progress
+// @Tags trackers
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param id path int true "Manga ID"
+// @Param tracker path string true "Tracker name" Enums(anilist, myanimelist)
+// @Param entry body Models.TrackMangaRequest true "Tracker entry"
+// @Success 200 {object} Models.Response_TrackerEntry
+// @Failure 400,401,403,404,502 {object} Models.Fail
+// @Router /v1/library/{id}/trackers/{tracker} [put]
+func trackMangaHandler(c *gin.Context, dbm *DB.DBManager, queue *Queue.Queue) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	tracker, ok := getTracker(c, queue)
+	if !ok {
+		return
+	}
+
+	var form Models.TrackMangaRequest
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	account := currentAccount(c)
+	var login Models.TrackerAccount
+	if err := dbm.GetTrackerAccount(&login, account.ID, tracker.Name()); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	var manga Models.Manga
+	if err := dbm.GetMangaMetadata(&manga, id); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	var entry Models.TrackerEntry
+	if err := dbm.GetTrackerEntry(&entry, account.ID, id, tracker.Name()); err != nil {
+		entry = Models.TrackerEntry{AccountID: account.ID, MangaID: id, Tracker: tracker.Name()}
+	}
+
+	if form.RemoteID != "" {
+		entry.RemoteID = form.RemoteID
+	} else if entry.RemoteID == "" {
+		remoteID, found := matchTracker(dbm, tracker, &manga)
+		if !found {
+			c.JSON(http.StatusBadRequest, Models.Fail{Error: fmt.Sprintf("No %s link found for %s, give the id", tracker.Name(), manga.Name)})
+			return
+		}
+		entry.RemoteID = remoteID
+	}
+	entry.Status = form.Status
+	entry.Score = form.Score
+
+	if err := dbm.SaveTrackerEntry(&entry); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	if err := queue.EnqueueTrackers(account.ID, id); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Models.Response_TrackerEntry{Entry: entry.ToJSON()})
+}
+
+// untrackMangaHandler Unlink a manga from a tracker
+// @Summary Untrack a manga
+// @Description stop pushing the progress of a manga to a tracker, the entry on the tracker is left as is
+// @Tags trackers
+// @Security ApiKeyAuth
+// @Param id path int true "Manga ID"
+// @Param tracker path string true "Tracker name" Enums(anilist, myanimelist)
+// @Success 204
+// @Failure 400,401,403,404 {object} Models.Fail
+// @Router /v1/library/{id}/trackers/{tracker} [delete]
+func untrackMangaHandler(c *gin.Context, dbm *DB.DBManager, queue *Queue.Queue) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	tracker, ok := getTracker(c, queue)
+	if !ok {
+		return
+	}
+
+	if err := dbm.DeleteTrackerEntry(currentAccount(c).ID, id, tracker.Name()); err != nil {
+		c.JSON(http.StatusNotFound, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
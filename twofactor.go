@@ -0,0 +1,201 @@
+package main
+
+import (
+	"github.com/CookieUzen/mangascribe/Config"
+	"github.com/CookieUzen/mangascribe/DB"
+	"github.com/CookieUzen/mangascribe/Models"
+	"github.com/CookieUzen/mangascribe/Tools"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+// secondFactor Checks the TOTP or recovery code of an account with two-factor authentication, responding with 401 if it is wrong
+// Accounts without two-factor authentication always pass
+// Wrong codes count as failed logins, and no code is checked while they lock the account out
+func secondFactor(c *gin.Context, dbm *DB.DBManager, account *Models.Account, code string) bool {
+	if !account.TOTPEnabled {
+		return true
+	}
+
+	if code == "" {
+		c.JSON(http.StatusUnauthorized, Models.Fail{Error: "Two-factor code required"})
+		return false
+	}
+
+	if loginLocked(c, dbm, account.Username) {
+		return false
+	}
+
+	ok, err := dbm.CheckSecondFactor(account, code)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return false
+	}
+	if !ok {
+		dbm.RecordLoginAttempt(account.Username, c.ClientIP(), false, Models.LoginFailedOTP)
+		c.JSON(http.StatusUnauthorized, Models.Fail{Error: "Invalid two-factor code"})
+		return false
+	}
+
+	return true
+}
+
+// enrollTOTPHandler Start setting up two-factor authentication
+// @Summary Enroll in two-factor authentication
+// @Description create a TOTP secret to add to an authenticator app, two-factor authentication is turned on once a code is verified
+// @Tags two-factor
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param password body Models.PasswordRequest true "Current password"
+// @Success 200 {object} Models.Response_TOTPEnrollment
+// @Failure 400,401,403,409,429,502 {object} Models.Fail
+// @Router /v1/accounts/me/2fa [post]
+func enrollTOTPHandler(c *gin.Context, dbm *DB.DBManager) {
+	var form Models.PasswordRequest
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	account := currentAccount(c)
+	if account.TOTPEnabled {
+		c.JSON(http.StatusConflict, Models.Fail{Error: "Two-factor authentication is already on"})
+		return
+	}
+
+	if !checkPassword(c, dbm, account, form.Password) {
+		return
+	}
+
+	secret, err := Tools.NewTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	if err := dbm.SetTOTPSecret(account, secret); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Models.Response_TOTPEnrollment{
+		Secret: secret,
+		URI:    Tools.TOTPURI(Config.TOTP_ISSUER, account.Username, secret),
+	})
+}
+
+// confirmTOTPHandler Turn on two-factor authentication
+// @Summary Verify two-factor authentication
+// @Description turn on two-factor authentication with a code from the authenticator app, returns the recovery codes which are only shown once
+// @Tags two-factor
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param otp body Models.OTPRequest true "Code from the authenticator app"
+// @Success 200 {object} Models.Response_RecoveryCodes
+// @Failure 400,401,403,409,429,502 {object} Models.Fail
+// @Router /v1/accounts/me/2fa/verify [post]
+func confirmTOTPHandler(c *gin.Context, dbm *DB.DBManager) {
+	var form Models.OTPRequest
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	account := currentAccount(c)
+	if account.TOTPEnabled {
+		c.JSON(http.StatusConflict, Models.Fail{Error: "Two-factor authentication is already on"})
+		return
+	}
+	if account.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: "Enroll in two-factor authentication first"})
+		return
+	}
+
+	counter, ok := Tools.ValidateTOTP(account.TOTPSecret, form.OTP, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: "Invalid two-factor code"})
+		return
+	}
+
+	codes, err := dbm.EnableTOTP(account, counter)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Models.Response_RecoveryCodes{RecoveryCodes: codes})
+}
+
+// disableTOTPHandler Turn off two-factor authentication
+// @Summary Disable two-factor authentication
+// @Tags two-factor
+// @Accept  json
+// @Security ApiKeyAuth
+// @Param disable body Models.DisableTOTPRequest true "Current password and a TOTP or recovery code"
+// @Success 204
+// @Failure 400,401,403,409,429,502 {object} Models.Fail
+// @Router /v1/accounts/me/2fa [delete]
+func disableTOTPHandler(c *gin.Context, dbm *DB.DBManager) {
+	var form Models.DisableTOTPRequest
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	account := currentAccount(c)
+	if !account.TOTPEnabled {
+		c.JSON(http.StatusConflict, Models.Fail{Error: "Two-factor authentication is off"})
+		return
+	}
+
+	if !checkPassword(c, dbm, account, form.Password) || !secondFactor(c, dbm, account, form.OTP) {
+		return
+	}
+
+	if err := dbm.DisableTOTP(account); err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// recoveryCodesHandler Replace the recovery codes
+// @Summary Regenerate recovery codes
+// @Description generate new recovery codes, the old ones stop working. The codes are only shown once
+// @Tags two-factor
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param otp body Models.OTPRequest true "TOTP or recovery code"
+// @Success 200 {object} Models.Response_RecoveryCodes
+// @Failure 400,401,403,409,429,502 {object} Models.Fail
+// @Router /v1/accounts/me/2fa/recovery-codes [post]
+func recoveryCodesHandler(c *gin.Context, dbm *DB.DBManager) {
+	var form Models.OTPRequest
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	account := currentAccount(c)
+	if !account.TOTPEnabled {
+		c.JSON(http.StatusConflict, Models.Fail{Error: "Two-factor authentication is off"})
+		return
+	}
+
+	if !secondFactor(c, dbm, account, form.OTP) {
+		return
+	}
+
+	codes, err := dbm.ReplaceRecoveryCodes(account)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, Models.Fail{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Models.Response_RecoveryCodes{RecoveryCodes: codes})
+}